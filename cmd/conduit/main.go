@@ -1,12 +1,25 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"flag"
+	cryptograph "go-websocket/pkg/Cryptograph"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/content"
 	"go-websocket/pkg/db"
+	"go-websocket/pkg/imaging"
+	"go-websocket/pkg/mail"
+	"go-websocket/pkg/oidc"
+	"go-websocket/pkg/storage"
+	"go-websocket/pkg/tlsconfig"
 	"go-websocket/pkg/ws"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
@@ -22,6 +35,99 @@ func main() {
 		panic(err.Error())
 	}
 
+	// Refuse to start without a key to sign tokens with
+	keys, err := auth.NewKeyManagerFromEnv()
+	if err != nil {
+		log.Fatal("Keys: ", err)
+	}
+
+	passwordPolicy, err := auth.NewPasswordPolicyFromEnv()
+	if err != nil {
+		log.Fatal("Password policy: ", err)
+	}
+
+	hasher, err := cryptograph.HasherByName(os.Getenv("PASSWORD_HASHER"))
+	if err != nil {
+		log.Fatal("Password hasher: ", err)
+	}
+
+	mailer, err := mail.NewMailerFromEnv()
+	if err != nil {
+		log.Fatal("Mail: ", err)
+	}
+
+	mediaStorage, err := storage.NewStorageFromEnv()
+	if err != nil {
+		log.Fatal("Storage: ", err)
+	}
+
+	maxUploadSize := int64(storage.DefaultMaxSize)
+	if value := os.Getenv("MEDIA_MAX_SIZE"); value != "" {
+		maxUploadSize, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatal("MEDIA_MAX_SIZE: ", err)
+		}
+	}
+
+	// Media of each user is limited to 100 MiB unless configured otherwise
+	mediaQuota := int64(100 << 20)
+	if value := os.Getenv("MEDIA_QUOTA"); value != "" {
+		mediaQuota, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			log.Fatal("MEDIA_QUOTA: ", err)
+		}
+	}
+
+	media := storage.NewMedia(mediaStorage, maxUploadSize)
+
+	// Images are re-encoded without their metadata unless turned off. WebP
+	// cannot be decoded, so it is only accepted when they are stored as is.
+	var processor *imaging.Processor
+	if os.Getenv("IMAGE_PROCESSING") != "false" {
+		processor = imaging.NewProcessor()
+
+		media.Types = map[string]string{}
+		for contentType, extension := range storage.ImageTypes {
+			if contentType != "image/webp" {
+				media.Types[contentType] = extension
+			}
+		}
+	}
+
+	contentRules, err := content.NewRulesFromEnv()
+	if err != nil {
+		log.Fatal("Content: ", err)
+	}
+
+	uploads := storage.NewUploads(maxUploadSize)
+	uploads.Dir = os.Getenv("UPLOAD_TEMP_DIR")
+
+	// Upload URLs only work on the node that signed them unless every node
+	// shares the secret
+	uploadSecret := []byte(os.Getenv("UPLOAD_URL_SECRET"))
+	if len(uploadSecret) == 0 {
+		uploadSecret = make([]byte, 32)
+		if _, err := rand.Read(uploadSecret); err != nil {
+			log.Fatal("UPLOAD_URL_SECRET: ", err)
+		}
+	}
+
+	uploadSigner := &storage.UploadSigner{
+		Secret:  uploadSecret,
+		BaseURL: strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/") + "/upload",
+		TTL:     15 * time.Minute,
+	}
+
+	// Messages can be edited or deleted for 15 minutes unless configured
+	// otherwise
+	editWindow := 15 * time.Minute
+	if value := os.Getenv("MESSAGE_EDIT_WINDOW"); value != "" {
+		editWindow, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatal("MESSAGE_EDIT_WINDOW: ", err)
+		}
+	}
+
 	url := os.Getenv("NEO4J_URI")
 	username := os.Getenv("NEO4J_USERNAME")
 	password := os.Getenv("NEO4J_PASSWORD")
@@ -37,21 +143,206 @@ func main() {
 	defer session.Close()
 
 	var smartDB db.ISmartDBWriterReader = db.NeoHandler{
+		Session:          session,
+		Hasher:           hasher,
+		DefaultAvatarURL: os.Getenv("DEFAULT_AVATAR_URL"),
+	}
+
+	// Moderators are exactly the users listed, removing one from the list
+	// takes their access away on the next start
+	moderators := []string{}
+	for _, moderator := range strings.Split(os.Getenv("MODERATORS"), ",") {
+		if moderator = strings.TrimSpace(moderator); moderator != "" {
+			moderators = append(moderators, moderator)
+		}
+	}
+
+	if err = smartDB.SetModerators(moderators); err != nil {
+		log.Fatal("MODERATORS: ", err)
+	}
+
+	// Messages sent before messages had IDs are given one
+	if added, err := smartDB.AddMessageIDs(); err != nil {
+		log.Fatal("Message IDs: ", err)
+	} else if added > 0 {
+		log.Println("added message IDs: ", added)
+	}
+
+	// Failed logins are shared between nodes through the database
+	loginLimiter := auth.NewLoginLimiter(db.NeoAttemptStore{
+		Session: session,
+	})
+
+	var refreshStore auth.RefreshStore = db.NeoRefreshStore{
+		Session: session,
+	}
+
+	var revocationStore auth.RevocationStore = db.NeoRevocationStore{
+		Session: session,
+	}
+
+	var oneTimeStore auth.OneTimeStore = db.NeoOneTimeStore{
 		Session: session,
 	}
 
+	// Shown next to the account in authenticator apps
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Conduit"
+	}
+
+	twoFactor := auth.NewTwoFactor(db.NeoTwoFactorStore{
+		Session: session,
+	}, issuer)
+
+	hub := ws.NewHub()
+
 	var dbProxy ws.WebDataProxy = ws.WSDBProxy{
 		DatabaseManager: &smartDB,
 		IdToUsername:    make(map[string]string),
+		IdToSession:     make(map[string]string),
+		IdToExpiry:      make(map[string]int64),
+		LoginLimiter:    loginLimiter,
+		PasswordPolicy:  passwordPolicy,
+		RefreshStore:    &refreshStore,
+		RevocationStore: &revocationStore,
+		Keys:            keys,
+		OneTimeStore:    &oneTimeStore,
+		Mailer:          &mailer,
+		ResetURL:        os.Getenv("PASSWORD_RESET_URL"),
+		VerifyURL:       os.Getenv("VERIFY_EMAIL_URL"),
+		TwoFactor:       twoFactor,
+		Media:           media,
+		Imaging:         processor,
+		UploadSigner:    uploadSigner,
+		Uploads:         uploads,
+		MediaQuota:      mediaQuota,
+		Content:         contentRules,
+		EditWindow:      editWindow,
+		Hub:             hub,
 	}
 
-	hub := ws.NewHub()
 	go hub.Run()
 
+	// Signing keys are only rotated when an interval is configured
+	if interval := os.Getenv("JWT_ROTATION_INTERVAL"); interval != "" {
+		rotation, err := time.ParseDuration(interval)
+		if err != nil {
+			log.Fatal("JWT_ROTATION_INTERVAL: ", err)
+		}
+
+		// Generated keys are kept in the database, otherwise tokens signed
+		// after a rotation would only verify on the node that signed them
+		keys.Store = db.NeoKeyStore{
+			Session: session,
+		}
+
+		if err = keys.Sync(); err != nil {
+			log.Fatal("Keys: ", err)
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go keys.StartRotation(rotation, stop)
+	}
+
+	// Accounts that never confirm their email are removed after a week
+	unverifiedTTL := 7 * 24 * time.Hour
+	if value := os.Getenv("UNVERIFIED_ACCOUNT_TTL"); value != "" {
+		unverifiedTTL, err = time.ParseDuration(value)
+		if err != nil {
+			log.Fatal("UNVERIFIED_ACCOUNT_TTL: ", err)
+		}
+	}
+
+	go func() {
+		for range time.Tick(time.Hour) {
+			if removed, err := dbProxy.CleanupUnverified(unverifiedTTL); err != nil {
+				log.Println("error: could not remove unverified accounts: ", err)
+			} else if removed > 0 {
+				log.Println("removed unverified accounts: ", removed)
+			}
+		}
+	}()
+
+	// Chunked uploads that were never finished
+	go func() {
+		for range time.Tick(10 * time.Minute) {
+			uploads.Cleanup()
+		}
+	}()
+
+	// Only allow browsers on the configured origins to open a socket
+	allowedOrigins := strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",")
+	devMode := os.Getenv("DEV_MODE") == "true"
+
+	ws.SetOriginChecker(ws.NewOriginChecker(allowedOrigins, devMode))
+
+	// Public keys for other services to verify tokens with
+	http.Handle("/.well-known/jwks.json", keys)
+
+	// Logins through identity providers, only when some are configured
+	providers, err := oidc.NewProvidersFromEnv(context.Background())
+	if err != nil {
+		log.Fatal("OIDC: ", err)
+	}
+
+	if len(providers) > 0 {
+		redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+
+		oidcHandler := oidc.NewHandler(ws.ExternalLogin(&dbProxy, redirectURL), providers...)
+		oidcHandler.Error = ws.ExternalLoginError(redirectURL)
+
+		http.Handle("/auth/", oidcHandler)
+	}
+
+	http.Handle("/upload", ws.UploadHandler(&dbProxy))
+
+	// S3 serves its objects itself
+	if local, ok := mediaStorage.(storage.LocalStorage); ok {
+		http.Handle("/media/", http.StripPrefix("/media", local))
+	}
+
 	http.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		ws.ServeWs(hub, w, r, &dbProxy)
 	})
 
+	// Serve TLS directly when a certificate is configured
+	if certFile := os.Getenv("TLS_CERT_FILE"); certFile != "" {
+		tlsConfig, reloader, err := tlsconfig.Config{
+			CertFile:          certFile,
+			KeyFile:           os.Getenv("TLS_KEY_FILE"),
+			MinVersion:        os.Getenv("TLS_MIN_VERSION"),
+			CipherSuites:      strings.Split(os.Getenv("TLS_CIPHER_SUITES"), ","),
+			ClientCAFile:      os.Getenv("TLS_CLIENT_CA_FILE"),
+			RequireClientCert: os.Getenv("TLS_CLIENT_AUTH") == "require",
+		}.Build()
+
+		if err != nil {
+			log.Fatal("TLS: ", err)
+		}
+
+		stop := make(chan struct{})
+		defer close(stop)
+
+		go reloader.Watch(stop)
+
+		server := &http.Server{
+			Addr:      *addr,
+			TLSConfig: tlsConfig,
+		}
+
+		// certificate is supplied by the reloader
+		err = server.ListenAndServeTLS("", "")
+
+		if err != nil {
+			log.Fatal("ListenAndServeTLS: ", err)
+		}
+
+		return
+	}
+
 	err = http.ListenAndServe(*addr, nil)
 
 	if err != nil {
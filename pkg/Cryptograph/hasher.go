@@ -0,0 +1,274 @@
+package cryptograph
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/scrypt"
+)
+
+// Hasher hashes passwords into self-describing strings in the PHC format
+// (https://github.com/P-H-C/phc-string-format), carrying the algorithm and
+// parameters so they can be raised without breaking stored hashes.
+type Hasher interface {
+	Hash(password string) (string, error)
+
+	// Verify checks a password against a hash made by this algorithm with
+	// any parameters
+	Verify(password, encoded string) (bool, error)
+
+	// NeedsRehash is true if the hash was made with another algorithm or
+	// different parameters
+	NeedsRehash(encoded string) bool
+}
+
+// DefaultHasher is used when no other hasher is configured
+var DefaultHasher Hasher = Argon2idHasher{
+	Memory:  64 * 1024,
+	Time:    3,
+	Threads: 4,
+	KeyLen:  32,
+	SaltLen: 16,
+}
+
+// HasherByName returns the default parameters of an algorithm
+func HasherByName(name string) (Hasher, error) {
+	switch name {
+
+	case "", "argon2id":
+		return DefaultHasher, nil
+
+	case "bcrypt":
+		return BcryptHasher{Cost: 12}, nil
+
+	case "scrypt":
+		return ScryptHasher{LogN: 15, R: 8, P: 1, KeyLen: 32, SaltLen: 16}, nil
+
+	}
+
+	return nil, fmt.Errorf("unknown password hasher %q", name)
+}
+
+// algorithmOf returns the id of a PHC string, "" if it is not one
+func algorithmOf(encoded string) string {
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) < 3 || parts[0] != "" {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// Verify checks a password against a hash made by any supported algorithm
+func Verify(password, encoded string) (bool, error) {
+	switch algorithmOf(encoded) {
+
+	case "argon2id":
+		return Argon2idHasher{}.Verify(password, encoded)
+
+	case "2a", "2b", "2y":
+		return BcryptHasher{}.Verify(password, encoded)
+
+	case "scrypt":
+		return ScryptHasher{}.Verify(password, encoded)
+
+	}
+
+	return false, fmt.Errorf("unsupported password hash")
+}
+
+func encode(bytes []byte) string {
+	return base64.RawStdEncoding.EncodeToString(bytes)
+}
+
+func decode(str string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(str)
+}
+
+// Argon2idHasher encodes as $argon2id$v=19$m=<memory>,t=<time>,p=<threads>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory  uint32
+	Time    uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen int
+}
+
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := GenerateRandomSalt(h.SaltLen)
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.Memory, h.Time, h.Threads, encode(salt), encode(key)), nil
+}
+
+// parse returns the parameters, salt and key of an encoded hash
+func (h Argon2idHasher) parse(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return h, nil, nil, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return h, nil, nil, fmt.Errorf("unsupported argon2 version")
+	}
+
+	var params Argon2idHasher
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return h, nil, nil, err
+	}
+
+	salt, err := decode(parts[4])
+
+	if err != nil {
+		return h, nil, nil, err
+	}
+
+	key, err := decode(parts[5])
+
+	if err != nil {
+		return h, nil, nil, err
+	}
+
+	params.KeyLen = uint32(len(key))
+	params.SaltLen = len(salt)
+
+	return params, salt, key, nil
+}
+
+func (h Argon2idHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := h.parse(encoded)
+
+	if err != nil {
+		return false, err
+	}
+
+	attempt := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+
+	return subtle.ConstantTimeCompare(attempt, key) == 1, nil
+}
+
+func (h Argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := h.parse(encoded)
+
+	return err != nil || params != h
+}
+
+// BcryptHasher uses the modular crypt format of bcrypt, $2a$<cost>$<salt+hash>
+type BcryptHasher struct {
+	Cost int
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	// bcrypt ignores anything past 72 bytes
+	if len(password) > 72 {
+		return "", fmt.Errorf("password: bcrypt passwords cannot be longer than 72 bytes")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+
+	return string(hash), err
+}
+
+func (h BcryptHasher) Verify(password, encoded string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (h BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+
+	return err != nil || cost != h.Cost
+}
+
+// ScryptHasher encodes as $scrypt$ln=<log2 N>,r=<r>,p=<p>$<salt>$<hash>
+type ScryptHasher struct {
+	LogN    int
+	R       int
+	P       int
+	KeyLen  int
+	SaltLen int
+}
+
+func (h ScryptHasher) Hash(password string) (string, error) {
+	salt := GenerateRandomSalt(h.SaltLen)
+	key, err := scrypt.Key([]byte(password), salt, 1<<h.LogN, h.R, h.P, h.KeyLen)
+
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("$scrypt$ln=%d,r=%d,p=%d$%s$%s", h.LogN, h.R, h.P, encode(salt), encode(key)), nil
+}
+
+func (h ScryptHasher) parse(encoded string) (ScryptHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+
+	if len(parts) != 5 || parts[1] != "scrypt" {
+		return h, nil, nil, fmt.Errorf("invalid scrypt hash")
+	}
+
+	var params ScryptHasher
+
+	if _, err := fmt.Sscanf(parts[2], "ln=%d,r=%d,p=%d", &params.LogN, &params.R, &params.P); err != nil {
+		return h, nil, nil, err
+	}
+
+	// keep a stored hash from asking for an absurd amount of memory
+	if params.LogN < 1 || params.LogN > 24 {
+		return h, nil, nil, fmt.Errorf("invalid scrypt cost")
+	}
+
+	salt, err := decode(parts[3])
+
+	if err != nil {
+		return h, nil, nil, err
+	}
+
+	key, err := decode(parts[4])
+
+	if err != nil {
+		return h, nil, nil, err
+	}
+
+	params.KeyLen = len(key)
+	params.SaltLen = len(salt)
+
+	return params, salt, key, nil
+}
+
+func (h ScryptHasher) Verify(password, encoded string) (bool, error) {
+	params, salt, key, err := h.parse(encoded)
+
+	if err != nil {
+		return false, err
+	}
+
+	attempt, err := scrypt.Key([]byte(password), salt, 1<<params.LogN, params.R, params.P, params.KeyLen)
+
+	if err != nil {
+		return false, err
+	}
+
+	return subtle.ConstantTimeCompare(attempt, key) == 1, nil
+}
+
+func (h ScryptHasher) NeedsRehash(encoded string) bool {
+	params, _, _, err := h.parse(encoded)
+
+	return err != nil || params != h
+}
@@ -0,0 +1,99 @@
+package cryptograph
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hasher", func() {
+
+	// Cheap parameters keep the tests fast
+	hashers := map[string]Hasher{
+		"argon2id": Argon2idHasher{Memory: 1024, Time: 1, Threads: 1, KeyLen: 32, SaltLen: 16},
+		"bcrypt":   BcryptHasher{Cost: 4},
+		"scrypt":   ScryptHasher{LogN: 10, R: 8, P: 1, KeyLen: 32, SaltLen: 16},
+	}
+
+	for name, hasher := range hashers {
+		name, hasher := name, hasher
+
+		It(name+": Verifies the password it hashed", func() {
+			encoded, err := hasher.Hash("PasswordOne123")
+			Expect(err).To(BeNil())
+
+			Expect(hasher.Verify("PasswordOne123", encoded)).To(BeTrue())
+			Expect(Verify("PasswordOne123", encoded)).To(BeTrue())
+		})
+
+		It(name+": Refuses a different password", func() {
+			encoded, err := hasher.Hash("PasswordOne123")
+			Expect(err).To(BeNil())
+
+			Expect(Verify("PasswordOne12", encoded)).To(BeFalse())
+		})
+
+		It(name+": Does not need a rehash with the same parameters", func() {
+			encoded, err := hasher.Hash("PasswordOne123")
+			Expect(err).To(BeNil())
+
+			Expect(hasher.NeedsRehash(encoded)).To(BeFalse())
+		})
+	}
+
+	It("Encodes argon2id in the PHC format", func() {
+		encoded, err := hashers["argon2id"].Hash("PasswordOne123")
+		Expect(err).To(BeNil())
+
+		Expect(strings.HasPrefix(encoded, "$argon2id$v=19$m=1024,t=1,p=1$")).To(BeTrue())
+	})
+
+	It("Salts every hash", func() {
+		first, _ := hashers["argon2id"].Hash("PasswordOne123")
+		second, _ := hashers["argon2id"].Hash("PasswordOne123")
+
+		Expect(first).NotTo(Equal(second))
+	})
+
+	It("Needs a rehash when the cost is raised", func() {
+		encoded, _ := hashers["argon2id"].Hash("PasswordOne123")
+
+		Expect(Argon2idHasher{Memory: 1024, Time: 2, Threads: 1, KeyLen: 32, SaltLen: 16}.NeedsRehash(encoded)).To(BeTrue())
+		Expect(BcryptHasher{Cost: 5}.NeedsRehash(encoded)).To(BeTrue())
+	})
+
+	It("Needs a rehash when the algorithm changes", func() {
+		encoded, _ := hashers["bcrypt"].Hash("PasswordOne123")
+
+		Expect(hashers["argon2id"].NeedsRehash(encoded)).To(BeTrue())
+		Expect(hashers["scrypt"].NeedsRehash(encoded)).To(BeTrue())
+	})
+
+	It("Refuses unknown and malformed hashes", func() {
+		_, err := Verify("PasswordOne123", "$md5$abc")
+		Expect(err).NotTo(BeNil())
+
+		_, err = Verify("PasswordOne123", "$argon2id$v=19$m=1024$abc")
+		Expect(err).NotTo(BeNil())
+
+		_, err = Verify("PasswordOne123", "$scrypt$ln=40,r=8,p=1$c2FsdA$a2V5")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Refuses bcrypt passwords past 72 bytes", func() {
+		_, err := hashers["bcrypt"].Hash(strings.Repeat("a", 73))
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Finds hashers by name", func() {
+		for _, name := range []string{"", "argon2id", "bcrypt", "scrypt"} {
+			_, err := HasherByName(name)
+			Expect(err).To(BeNil())
+		}
+
+		_, err := HasherByName("md5")
+		Expect(err).NotTo(BeNil())
+	})
+
+})
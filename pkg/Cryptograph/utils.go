@@ -2,6 +2,7 @@ package cryptograph
 
 import (
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/base64"
 
 	"golang.org/x/crypto/argon2"
@@ -26,6 +27,8 @@ func GenerateRandomSalt(saltSize int) []byte {
 	return salt
 }
 
+// HashPassword is the legacy scheme with fixed parameters and the salt stored
+// apart from the hash, new passwords use a Hasher
 func HashPassword(password *string, salt *[]byte) (string, string) {
 	// Convert password string to byte slice
 	var passwordBytes = []byte(*password)
@@ -39,6 +42,7 @@ func HashPassword(password *string, salt *[]byte) (string, string) {
 	return base64EncodedPasswordHash, base64EncodedPasswordSalt
 }
 
+// ComparePassword checks a password against a legacy hash and salt
 func ComparePassword(passwordOne, passwordHashDB, salt *string) (bool, error) {
 
 	saltBytes, err := base64.RawStdEncoding.DecodeString(*salt)
@@ -50,5 +54,5 @@ func ComparePassword(passwordOne, passwordHashDB, salt *string) (bool, error) {
 	// Using recieved salt, hash the password
 	hashedAttempt, _ := HashPassword(passwordOne, &saltBytes)
 
-	return hashedAttempt == *passwordHashDB, nil
+	return subtle.ConstantTimeCompare([]byte(hashedAttempt), []byte(*passwordHashDB)) == 1, nil
 }
@@ -0,0 +1,623 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+const (
+	AlgorithmHS256 = "HS256"
+	AlgorithmRS256 = "RS256"
+	AlgorithmEdDSA = "EdDSA"
+
+	// How long a rotated out key is still accepted, must outlive the tokens
+	// it signed
+	DefaultKeyRetention = time.Hour
+
+	// Least time between loading the store for a token with an unknown key
+	keySyncInterval = 10 * time.Second
+)
+
+// SigningKey is a key tokens are signed or verified with. Private and Public
+// hold []byte for HS256, *rsa keys for RS256 and ed25519 keys for EdDSA.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	Private   interface{}
+	Public    interface{}
+	CreatedAt time.Time
+}
+
+// KeyManager holds every key that tokens may still be signed with, picking
+// the key to verify with from the "kid" header of the token.
+type KeyManager struct {
+	Algorithm string
+	Retention time.Duration
+
+	// Generated keys are saved to and loaded from the store when set, the
+	// newest key in it signs new tokens
+	Store KeyStore
+
+	mu      sync.RWMutex
+	keys    map[string]*SigningKey
+	active  string
+	retired map[string]time.Time
+	synced  time.Time
+}
+
+func NewKeyManager(algorithm string) (*KeyManager, error) {
+	if _, err := methodFor(algorithm); err != nil {
+		return nil, err
+	}
+
+	return &KeyManager{
+		Algorithm: algorithm,
+		Retention: DefaultKeyRetention,
+		keys:      make(map[string]*SigningKey),
+		retired:   make(map[string]time.Time),
+	}, nil
+}
+
+func methodFor(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+
+	case AlgorithmHS256:
+		return jwt.SigningMethodHS256, nil
+
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+
+	case AlgorithmEdDSA:
+		return SigningMethodEdDSA, nil
+
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm %q", algorithm)
+}
+
+// keyID derives a stable id from the public part of a key
+func keyID(public interface{}) string {
+	var material []byte
+
+	switch key := public.(type) {
+
+	case []byte:
+		material = key
+
+	case ed25519.PublicKey:
+		material = key
+
+	default:
+		material, _ = x509.MarshalPKIXPublicKey(key)
+
+	}
+
+	sum := sha256.Sum256(material)
+
+	return hex.EncodeToString(sum[:8])
+}
+
+// Add registers a key, the first key added or any added with activate set is
+// used to sign new tokens
+func (k *KeyManager) Add(key *SigningKey, activate bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.keys[key.ID] = key
+
+	if activate || k.active == "" {
+		k.active = key.ID
+	}
+}
+
+// AddSecret adds an HS256 secret
+func (k *KeyManager) AddSecret(secret []byte, activate bool) error {
+	if k.Algorithm != AlgorithmHS256 {
+		return fmt.Errorf("secrets can only be used with %s", AlgorithmHS256)
+	}
+
+	if len(secret) < 32 {
+		return fmt.Errorf("secret must be at least 32 bytes")
+	}
+
+	k.Add(&SigningKey{
+		ID:        keyID(secret),
+		Method:    jwt.SigningMethodHS256,
+		Private:   secret,
+		Public:    secret,
+		CreatedAt: time.Now(),
+	}, activate)
+
+	return nil
+}
+
+// AddPEM adds a PKCS#1 or PKCS#8 private key
+func (k *KeyManager) AddPEM(data []byte, activate bool) error {
+	key, err := k.parsePEM(data)
+
+	if err != nil {
+		return err
+	}
+
+	k.Add(key, activate)
+
+	return nil
+}
+
+func (k *KeyManager) parsePEM(data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found")
+	}
+
+	var private interface{}
+	var err error
+
+	if block.Type == "RSA PRIVATE KEY" {
+		private, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	} else {
+		private, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return k.keyFor(private)
+}
+
+func (k *KeyManager) keyFor(private interface{}) (*SigningKey, error) {
+	key := &SigningKey{Private: private, CreatedAt: time.Now()}
+
+	switch private := private.(type) {
+
+	case *rsa.PrivateKey:
+		if k.Algorithm != AlgorithmRS256 {
+			return nil, fmt.Errorf("rsa key cannot be used with %s", k.Algorithm)
+		}
+
+		key.Method = jwt.SigningMethodRS256
+		key.Public = &private.PublicKey
+
+	case ed25519.PrivateKey:
+		if k.Algorithm != AlgorithmEdDSA {
+			return nil, fmt.Errorf("ed25519 key cannot be used with %s", k.Algorithm)
+		}
+
+		key.Method = SigningMethodEdDSA
+		key.Public = private.Public()
+
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", private)
+
+	}
+
+	key.ID = keyID(key.Public)
+
+	return key, nil
+}
+
+// Generate creates a new key for the algorithm of the manager
+func (k *KeyManager) Generate() (*SigningKey, error) {
+	switch k.Algorithm {
+
+	case AlgorithmHS256:
+		secret := make([]byte, 32)
+
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+
+		return &SigningKey{
+			ID:        keyID(secret),
+			Method:    jwt.SigningMethodHS256,
+			Private:   secret,
+			Public:    secret,
+			CreatedAt: time.Now(),
+		}, nil
+
+	case AlgorithmRS256:
+		private, err := rsa.GenerateKey(rand.Reader, 2048)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return k.keyFor(private)
+
+	case AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return k.keyFor(private)
+
+	}
+
+	return nil, fmt.Errorf("unsupported signing algorithm %q", k.Algorithm)
+}
+
+// Rotate signs new tokens with a freshly generated key. The previous key
+// keeps verifying for the retention period. With a store the key is saved
+// there for the other nodes.
+func (k *KeyManager) Rotate() error {
+	key, err := k.Generate()
+
+	if err != nil {
+		return err
+	}
+
+	if k.Store != nil {
+		material, err := keyMaterial(key)
+
+		if err != nil {
+			return err
+		}
+
+		err = k.Store.Save(StoredKey{
+			ID:        key.ID,
+			Material:  material,
+			CreatedAt: key.CreatedAt,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return k.Sync()
+	}
+
+	now := time.Now()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.active != "" {
+		k.retired[k.active] = now.Add(k.Retention)
+	}
+
+	k.keys[key.ID] = key
+	k.active = key.ID
+
+	// forget keys whose tokens have all expired
+	for id, until := range k.retired {
+		if now.After(until) {
+			delete(k.keys, id)
+			delete(k.retired, id)
+		}
+	}
+
+	return nil
+}
+
+// Sync loads the keys in the store. The newest signs new tokens, older ones
+// verify until the retention period after the key that replaced them was
+// made, and are then removed from the store.
+func (k *KeyManager) Sync() error {
+	if k.Store == nil {
+		return fmt.Errorf("no key store has been configured")
+	}
+
+	stored, err := k.Store.Load()
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(stored, func(i, j int) bool {
+		return stored[i].CreatedAt.Before(stored[j].CreatedAt)
+	})
+
+	keys := make([]*SigningKey, 0, len(stored))
+
+	for _, s := range stored {
+		key, err := k.storedKey(s)
+
+		if err != nil {
+			return fmt.Errorf("stored key %s: %v", s.ID, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	now := time.Now()
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.synced = now
+
+	for i, key := range keys {
+		if i == len(keys)-1 {
+			if k.active != "" && k.active != key.ID {
+				if _, ok := k.retired[k.active]; !ok {
+					k.retired[k.active] = now.Add(k.Retention)
+				}
+			}
+
+			k.keys[key.ID] = key
+			k.active = key.ID
+			delete(k.retired, key.ID)
+
+			continue
+		}
+
+		until := keys[i+1].CreatedAt.Add(k.Retention)
+
+		if now.After(until) {
+			if err = k.Store.Delete(key.ID); err != nil {
+				return err
+			}
+
+			delete(k.keys, key.ID)
+			delete(k.retired, key.ID)
+
+			continue
+		}
+
+		k.keys[key.ID] = key
+		k.retired[key.ID] = until
+	}
+
+	for id, until := range k.retired {
+		if now.After(until) {
+			delete(k.keys, id)
+			delete(k.retired, id)
+		}
+	}
+
+	return nil
+}
+
+func (k *KeyManager) storedKey(stored StoredKey) (*SigningKey, error) {
+	var key *SigningKey
+
+	if k.Algorithm == AlgorithmHS256 {
+		key = &SigningKey{
+			ID:      keyID(stored.Material),
+			Method:  jwt.SigningMethodHS256,
+			Private: stored.Material,
+			Public:  stored.Material,
+		}
+	} else {
+		var err error
+
+		if key, err = k.parsePEM(stored.Material); err != nil {
+			return nil, err
+		}
+	}
+
+	key.CreatedAt = stored.CreatedAt
+
+	return key, nil
+}
+
+// keyMaterial is how a generated key is kept in a store
+func keyMaterial(key *SigningKey) ([]byte, error) {
+	if secret, ok := key.Private.([]byte); ok {
+		return secret, nil
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key.Private)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// StartRotation rotates the active key every interval until stop is closed.
+// With a store the keys of other nodes are loaded first, and the key is only
+// rotated when no node has done so within the interval.
+func (k *KeyManager) StartRotation(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if k.Store != nil {
+				if err := k.Sync(); err != nil {
+					log.Printf("keys: could not load signing keys: %v", err)
+					continue
+				}
+
+				if !k.activeOlderThan(interval) {
+					continue
+				}
+			}
+
+			if err := k.Rotate(); err != nil {
+				log.Printf("keys: could not rotate signing key: %v", err)
+			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (k *KeyManager) activeOlderThan(age time.Duration) bool {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	key, ok := k.keys[k.active]
+
+	return !ok || time.Since(key.CreatedAt) >= age
+}
+
+// Sign signs the claims with the active key
+func (k *KeyManager) Sign(claims jwt.Claims) (string, error) {
+	k.mu.RLock()
+	key, ok := k.keys[k.active]
+	k.mu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("no signing key has been configured")
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Private)
+}
+
+// Keyfunc is passed to jwt.Parse to find the key a token was signed with
+func (k *KeyManager) Keyfunc(token *jwt.Token) (interface{}, error) {
+	id, _ := token.Header["kid"].(string)
+
+	k.mu.RLock()
+	key, ok := k.keys[id]
+	synced := k.synced
+	k.mu.RUnlock()
+
+	// another node may have rotated since the store was last loaded
+	if !ok && k.Store != nil && time.Since(synced) >= keySyncInterval {
+		if err := k.Sync(); err != nil {
+			log.Printf("keys: could not load signing keys: %v", err)
+		}
+
+		k.mu.RLock()
+		key, ok = k.keys[id]
+		k.mu.RUnlock()
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", id)
+	}
+
+	// never let the token pick a different algorithm for the key
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	return key.Public, nil
+}
+
+// JSONWebKey is a public key in the format of RFC 7517
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public keys, HS256 secrets are never published
+func (k *KeyManager) JWKS() JSONWebKeySet {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+
+	for _, key := range k.keys {
+		switch public := key.Public.(type) {
+
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				Kty: "RSA",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: AlgorithmRS256,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				Kty: "OKP",
+				Kid: key.ID,
+				Use: "sig",
+				Alg: AlgorithmEdDSA,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(public),
+			})
+
+		}
+	}
+
+	return set
+}
+
+// ServeHTTP serves the JWKS so other services can verify tokens
+func (k *KeyManager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "max-age=300")
+
+	json.NewEncoder(w).Encode(k.JWKS())
+}
+
+// NewKeyManagerFromEnv builds the key manager from JWT_ALGORITHM and either
+// JWT_KEY_FILES (comma separated pem files) or ACCESS_SECRET (comma separated
+// secrets for HS256). The first key signs, the rest only verify. An error is
+// returned if no key is configured so the server refuses to start.
+func NewKeyManagerFromEnv() (*KeyManager, error) {
+	algorithm := os.Getenv("JWT_ALGORITHM")
+
+	if algorithm == "" {
+		algorithm = AlgorithmHS256
+	}
+
+	keys, err := NewKeyManager(algorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if files := os.Getenv("JWT_KEY_FILES"); files != "" && algorithm != AlgorithmHS256 {
+		for i, file := range strings.Split(files, ",") {
+			data, err := os.ReadFile(strings.TrimSpace(file))
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err = keys.AddPEM(data, i == 0); err != nil {
+				return nil, fmt.Errorf("%s: %v", file, err)
+			}
+		}
+	}
+
+	if secrets := os.Getenv("ACCESS_SECRET"); secrets != "" && algorithm == AlgorithmHS256 {
+		for i, secret := range strings.Split(secrets, ",") {
+			if err = keys.AddSecret([]byte(secret), i == 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if keys.active == "" {
+		return nil, fmt.Errorf("no signing key configured for %s", algorithm)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func signAndParse(signer, verifier *KeyManager) error {
+	token, err := signer.Sign(jwt.StandardClaims{
+		Subject:   "some-user",
+		ExpiresAt: time.Now().Add(time.Hour).Unix(),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	_, err = jwt.ParseWithClaims(token, &jwt.StandardClaims{}, verifier.Keyfunc)
+
+	return err
+}
+
+var _ = Describe("KeyManager", func() {
+
+	It("Sign: every algorithm verifies with its own key", func() {
+		for _, algorithm := range []string{AlgorithmHS256, AlgorithmRS256, AlgorithmEdDSA} {
+			keys, err := NewKeyManager(algorithm)
+			Expect(err).To(BeNil())
+			Expect(keys.Rotate()).To(BeNil())
+
+			Expect(signAndParse(keys, keys)).To(BeNil(), "%s token should verify", algorithm)
+		}
+	})
+
+	It("Sign: no key configured is an error", func() {
+		keys, _ := NewKeyManager(AlgorithmHS256)
+
+		_, err := keys.Sign(jwt.StandardClaims{})
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("Rotate: old keys still verify", func() {
+		keys, _ := NewKeyManager(AlgorithmEdDSA)
+		Expect(keys.Rotate()).To(BeNil())
+
+		token, err := keys.Sign(jwt.StandardClaims{Subject: "some-user"})
+		Expect(err).To(BeNil())
+
+		Expect(keys.Rotate()).To(BeNil())
+
+		_, err = jwt.ParseWithClaims(token, &jwt.StandardClaims{}, keys.Keyfunc)
+		Expect(err).To(BeNil(), "Token signed before rotation should verify")
+		Expect(keys.JWKS().Keys).To(HaveLen(2))
+	})
+
+	It("Rotate: retired keys are removed after retention", func() {
+		keys, _ := NewKeyManager(AlgorithmEdDSA)
+		keys.Retention = -time.Second
+
+		keys.Rotate()
+		keys.Rotate()
+		keys.Rotate()
+
+		Expect(keys.JWKS().Keys).To(HaveLen(1))
+	})
+
+	It("Store: a key rotated on one node verifies on another", func() {
+		for _, algorithm := range []string{AlgorithmHS256, AlgorithmEdDSA} {
+			store := NewMemoryKeyStore()
+
+			one, _ := NewKeyManager(algorithm)
+			one.Store = store
+
+			other, _ := NewKeyManager(algorithm)
+			other.Store = store
+
+			Expect(one.Rotate()).To(BeNil())
+			Expect(signAndParse(one, other)).To(BeNil(), "%s token should verify on the other node", algorithm)
+		}
+	})
+
+	It("Store: a restarted node signs with the newest stored key", func() {
+		store := NewMemoryKeyStore()
+
+		keys, _ := NewKeyManager(AlgorithmEdDSA)
+		keys.Store = store
+		Expect(keys.Rotate()).To(BeNil())
+
+		token, err := keys.Sign(jwt.StandardClaims{Subject: "some-user"})
+		Expect(err).To(BeNil())
+
+		restarted, _ := NewKeyManager(AlgorithmEdDSA)
+		restarted.Store = store
+		Expect(restarted.Sync()).To(BeNil())
+
+		Expect(restarted.active).To(Equal(keys.active))
+
+		_, err = jwt.ParseWithClaims(token, &jwt.StandardClaims{}, restarted.Keyfunc)
+		Expect(err).To(BeNil(), "Token signed before the restart should verify")
+	})
+
+	It("Store: replaced keys are removed after retention", func() {
+		store := NewMemoryKeyStore()
+
+		keys, _ := NewKeyManager(AlgorithmHS256)
+		keys.Store = store
+		keys.Retention = -time.Second
+
+		Expect(keys.Rotate()).To(BeNil())
+		Expect(keys.Rotate()).To(BeNil())
+		Expect(keys.Rotate()).To(BeNil())
+
+		stored, _ := store.Load()
+		Expect(stored).To(HaveLen(1))
+		Expect(keys.keys).To(HaveLen(1))
+	})
+
+	It("Keyfunc: unknown kid is rejected", func() {
+		keys, _ := NewKeyManager(AlgorithmRS256)
+		keys.Rotate()
+
+		other, _ := NewKeyManager(AlgorithmRS256)
+		other.Rotate()
+
+		Expect(signAndParse(other, keys)).ToNot(BeNil(), "Token from another key should not verify")
+	})
+
+	It("Keyfunc: algorithm cannot be swapped", func() {
+		keys, _ := NewKeyManager(AlgorithmRS256)
+		keys.Rotate()
+
+		// sign with HS256 using the id of the rsa key
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{})
+		token.Header["kid"] = keys.active
+		signed, _ := token.SignedString([]byte("anything"))
+
+		_, err := jwt.Parse(signed, keys.Keyfunc)
+		Expect(err).ToNot(BeNil())
+	})
+
+	It("JWKS: secrets are never published", func() {
+		keys, _ := NewKeyManager(AlgorithmHS256)
+		Expect(keys.AddSecret([]byte("a-secret-that-is-at-least-32-bytes"), true)).To(BeNil())
+
+		Expect(keys.JWKS().Keys).To(BeEmpty())
+	})
+
+	It("AddPEM: loads a PKCS#8 ed25519 key", func() {
+		_, private, _ := ed25519.GenerateKey(rand.Reader)
+		der, _ := x509.MarshalPKCS8PrivateKey(private)
+
+		keys, _ := NewKeyManager(AlgorithmEdDSA)
+		Expect(keys.AddPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), true)).To(BeNil())
+
+		Expect(signAndParse(keys, keys)).To(BeNil())
+
+		rsaKeys, _ := NewKeyManager(AlgorithmRS256)
+		Expect(rsaKeys.AddPEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), true)).ToNot(BeNil(), "Key should match the algorithm")
+	})
+
+	It("Env: startup fails without a key", func() {
+		os.Setenv("JWT_ALGORITHM", AlgorithmHS256)
+		os.Setenv("ACCESS_SECRET", "")
+		defer os.Unsetenv("JWT_ALGORITHM")
+
+		_, err := NewKeyManagerFromEnv()
+		Expect(err).ToNot(BeNil())
+
+		os.Setenv("ACCESS_SECRET", "a-secret-that-is-at-least-32-bytes,an-older-secret-still-32-bytes-long")
+		defer os.Unsetenv("ACCESS_SECRET")
+
+		keys, err := NewKeyManagerFromEnv()
+		Expect(err).To(BeNil())
+		Expect(signAndParse(keys, keys)).To(BeNil())
+	})
+
+})
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// StoredKey is a generated signing key as a PEM private key, or the secret
+// itself for HS256
+type StoredKey struct {
+	ID        string
+	Material  []byte
+	CreatedAt time.Time
+}
+
+// KeyStore shares generated signing keys between nodes so that a token
+// signed after a rotation verifies on every node, and keys outlive restarts.
+type KeyStore interface {
+	Save(key StoredKey) error
+	Load() ([]StoredKey, error)
+	Delete(id string) error
+}
+
+// MemoryKeyStore keeps keys in memory, only suitable for a single node.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]StoredKey
+}
+
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]StoredKey)}
+}
+
+func (m *MemoryKeyStore) Save(key StoredKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.keys[key.ID] = key
+
+	return nil
+}
+
+func (m *MemoryKeyStore) Load() ([]StoredKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	keys := make([]StoredKey, 0, len(m.keys))
+
+	for _, key := range m.keys {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (m *MemoryKeyStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.keys, id)
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Number of failures before the key is locked out
+	DefaultLockoutThreshold = 10
+
+	// Delay after the first failure, doubled for each following failure
+	DefaultBaseDelay = time.Second
+
+	// Longest delay that backoff can reach before a lockout
+	DefaultMaxDelay = 5 * time.Minute
+
+	// How long a key stays locked once the threshold has been reached
+	DefaultLockoutDuration = 30 * time.Minute
+)
+
+// AttemptRecord is the failed login history stored for a single key.
+type AttemptRecord struct {
+	Failures    int64
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore persists failed login attempts. Implementations must be safe
+// to share between nodes, so every write is expected to be atomic.
+type AttemptStore interface {
+	// Get returns the record for key, or an empty record if there is none
+	Get(key string) (AttemptRecord, error)
+
+	// Fail increments the failure count for key and returns the new record
+	Fail(key string, at time.Time) (AttemptRecord, error)
+
+	// Lock marks the key as locked until the given time
+	Lock(key string, until time.Time) error
+
+	// Reset removes all history for key
+	Reset(key string) error
+}
+
+// LockoutError is returned when a login is refused before the password is
+// checked.
+type LockoutError struct {
+	// true if the threshold was hit, false if only backing off
+	Locked bool
+
+	// time until another attempt is allowed
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	if e.Locked {
+		return fmt.Sprintf("locked: account is locked for %v", e.RetryAfter)
+	}
+
+	return fmt.Sprintf("backoff: retry login in %v", e.RetryAfter)
+}
+
+// LoginLimiter tracks failed logins per email and per IP address.
+type LoginLimiter struct {
+	Store           AttemptStore
+	Threshold       int64
+	BaseDelay       time.Duration
+	MaxDelay        time.Duration
+	LockoutDuration time.Duration
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+}
+
+func NewLoginLimiter(store AttemptStore) *LoginLimiter {
+	return &LoginLimiter{
+		Store:           store,
+		Threshold:       DefaultLockoutThreshold,
+		BaseDelay:       DefaultBaseDelay,
+		MaxDelay:        DefaultMaxDelay,
+		LockoutDuration: DefaultLockoutDuration,
+	}
+}
+
+func (l *LoginLimiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+
+	return time.Now()
+}
+
+func emailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// delay returns how long must pass after the last failure
+func (l *LoginLimiter) delay(failures int64) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+
+	delay := l.BaseDelay
+
+	for i := int64(1); i < failures; i++ {
+		delay *= 2
+
+		if delay >= l.MaxDelay {
+			return l.MaxDelay
+		}
+	}
+
+	return delay
+}
+
+func (l *LoginLimiter) checkKey(key string, now time.Time) error {
+	record, err := l.Store.Get(key)
+
+	if err != nil {
+		return err
+	}
+
+	if now.Before(record.LockedUntil) {
+		return &LockoutError{Locked: true, RetryAfter: record.LockedUntil.Sub(now)}
+	}
+
+	// lockout has passed, history is kept until a successful login
+	if !record.LockedUntil.IsZero() {
+		return nil
+	}
+
+	if wait := record.LastFailure.Add(l.delay(record.Failures)).Sub(now); wait > 0 {
+		return &LockoutError{RetryAfter: wait}
+	}
+
+	return nil
+}
+
+// Check returns a *LockoutError if a login for email from ip should not be
+// attempted yet.
+func (l *LoginLimiter) Check(email, ip string) error {
+	now := l.now()
+
+	if err := l.checkKey(emailKey(email), now); err != nil {
+		return err
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	return l.checkKey(ipKey(ip), now)
+}
+
+func (l *LoginLimiter) failKey(key string, now time.Time) error {
+	record, err := l.Store.Fail(key, now)
+
+	if err != nil {
+		return err
+	}
+
+	if record.Failures >= l.Threshold {
+		return l.Store.Lock(key, now.Add(l.LockoutDuration))
+	}
+
+	return nil
+}
+
+// RecordFailure registers a failed login for both the email and the ip.
+func (l *LoginLimiter) RecordFailure(email, ip string) error {
+	now := l.now()
+
+	if err := l.failKey(emailKey(email), now); err != nil {
+		return err
+	}
+
+	if ip == "" {
+		return nil
+	}
+
+	return l.failKey(ipKey(ip), now)
+}
+
+// RecordSuccess clears the history of the email. The ip history is left
+// alone so that one valid account cannot be used to reset a guessing run.
+func (l *LoginLimiter) RecordSuccess(email string) error {
+	return l.Store.Reset(emailKey(email))
+}
+
+// Unlock removes a lockout on an email before it expires.
+func (l *LoginLimiter) Unlock(email string) error {
+	return l.Store.Reset(emailKey(email))
+}
+
+// UnlockIP removes a lockout on an ip address before it expires.
+func (l *LoginLimiter) UnlockIP(ip string) error {
+	return l.Store.Reset(ipKey(ip))
+}
+
+// MemoryAttemptStore keeps attempts in memory, only suitable for a single node.
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	records map[string]AttemptRecord
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{records: make(map[string]AttemptRecord)}
+}
+
+func (m *MemoryAttemptStore) Get(key string) (AttemptRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.records[key], nil
+}
+
+func (m *MemoryAttemptStore) Fail(key string, at time.Time) (AttemptRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[key]
+
+	// a lockout that has run out starts a fresh count
+	if !record.LockedUntil.IsZero() && !at.Before(record.LockedUntil) {
+		record = AttemptRecord{}
+	}
+
+	record.Failures++
+	record.LastFailure = at
+	m.records[key] = record
+
+	return record, nil
+}
+
+func (m *MemoryAttemptStore) Lock(key string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[key]
+	record.LockedUntil = until
+	m.records[key] = record
+
+	return nil
+}
+
+func (m *MemoryAttemptStore) Reset(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, key)
+
+	return nil
+}
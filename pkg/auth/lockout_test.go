@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("LoginLimiter", func() {
+
+	var now time.Time
+	var limiter *LoginLimiter
+
+	BeforeEach(func() {
+		now = time.Unix(1000000, 0)
+
+		limiter = NewLoginLimiter(NewMemoryAttemptStore())
+		limiter.Threshold = 3
+		limiter.Now = func() time.Time { return now }
+	})
+
+	It("Check: no failures allows a login", func() {
+		Expect(limiter.Check("some-user@example.com", "127.0.0.1")).To(BeNil(), "Login should be allowed")
+	})
+
+	It("Backoff: must wait after a failure", func() {
+		Expect(limiter.RecordFailure("some-user@example.com", "127.0.0.1")).To(BeNil())
+
+		var lockoutErr *LockoutError
+		err := limiter.Check("some-user@example.com", "127.0.0.1")
+
+		Expect(errors.As(err, &lockoutErr)).To(BeTrue(), "Login should be backing off")
+		Expect(lockoutErr.Locked).To(BeFalse(), "Account should not be locked yet")
+		Expect(lockoutErr.RetryAfter).To(Equal(time.Second))
+
+		now = now.Add(time.Second)
+		Expect(limiter.Check("some-user@example.com", "127.0.0.1")).To(BeNil(), "Login should be allowed after the delay")
+	})
+
+	It("Backoff: delay doubles with each failure", func() {
+		limiter.Threshold = 10
+
+		limiter.RecordFailure("some-user@example.com", "")
+		limiter.RecordFailure("some-user@example.com", "")
+		limiter.RecordFailure("some-user@example.com", "")
+
+		var lockoutErr *LockoutError
+		Expect(errors.As(limiter.Check("some-user@example.com", ""), &lockoutErr)).To(BeTrue())
+		Expect(lockoutErr.RetryAfter).To(Equal(4 * time.Second))
+	})
+
+	It("Lockout: threshold locks the email", func() {
+		for i := 0; i < 3; i++ {
+			Expect(limiter.RecordFailure("some-user@example.com", "127.0.0.1")).To(BeNil())
+		}
+
+		var lockoutErr *LockoutError
+		Expect(errors.As(limiter.Check("SOME-USER@example.com", "10.0.0.1"), &lockoutErr)).To(BeTrue())
+		Expect(lockoutErr.Locked).To(BeTrue(), "Email should be locked regardless of case or ip")
+
+		now = now.Add(DefaultLockoutDuration)
+		Expect(limiter.Check("some-user@example.com", "10.0.0.1")).To(BeNil(), "Lockout should expire")
+	})
+
+	It("Lockout: threshold locks the ip for other emails", func() {
+		for i := 0; i < 3; i++ {
+			limiter.RecordFailure("user-"+string(rune('a'+i))+"@example.com", "127.0.0.1")
+		}
+
+		var lockoutErr *LockoutError
+		Expect(errors.As(limiter.Check("new@example.com", "127.0.0.1"), &lockoutErr)).To(BeTrue())
+		Expect(lockoutErr.Locked).To(BeTrue(), "IP should be locked")
+	})
+
+	It("Unlock: admin can remove a lockout", func() {
+		for i := 0; i < 3; i++ {
+			limiter.RecordFailure("some-user@example.com", "")
+		}
+
+		Expect(limiter.Unlock("some-user@example.com")).To(BeNil())
+		Expect(limiter.Check("some-user@example.com", "")).To(BeNil(), "Login should be allowed after unlocking")
+	})
+
+	It("Success: clears the email history", func() {
+		limiter.RecordFailure("some-user@example.com", "")
+		Expect(limiter.RecordSuccess("some-user@example.com")).To(BeNil())
+
+		Expect(limiter.Check("some-user@example.com", "")).To(BeNil(), "Login should be allowed after success")
+	})
+
+})
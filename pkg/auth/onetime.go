@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Purposes of one-time tokens, a token only works for the purpose it was
+// issued for
+const (
+	PurposePasswordReset  = "password_reset"
+	PurposeVerifyEmail    = "verify_email"
+	PurposeTwoFactorLogin = "two_factor_login"
+)
+
+var ErrOneTimeInvalid = errors.New("invalid: token is invalid or expired")
+
+// OneTimeToken is a token sent to the user out of band, such as by email. Like
+// refresh tokens only the hash is stored.
+type OneTimeToken struct {
+	Hash    string
+	Purpose string
+
+	// Who the token was issued for, the email it was sent to
+	Subject   string
+	ExpiresAt time.Time
+}
+
+type OneTimeStore interface {
+	// Create replaces any earlier token for the same purpose and subject
+	Create(token OneTimeToken) error
+
+	// Get returns the token without using it up
+	Get(hash, purpose string, now time.Time) (OneTimeToken, error)
+
+	// Consume deletes the token, only one caller can consume it
+	Consume(hash, purpose string, now time.Time) (OneTimeToken, error)
+}
+
+// MemoryOneTimeStore keeps tokens in memory, only suitable for a single node.
+type MemoryOneTimeStore struct {
+	mu     sync.Mutex
+	tokens map[string]OneTimeToken
+}
+
+func NewMemoryOneTimeStore() *MemoryOneTimeStore {
+	return &MemoryOneTimeStore{tokens: make(map[string]OneTimeToken)}
+}
+
+func (m *MemoryOneTimeStore) Create(token OneTimeToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for hash, existing := range m.tokens {
+		if existing.Purpose == token.Purpose && existing.Subject == token.Subject {
+			delete(m.tokens, hash)
+		}
+	}
+
+	m.tokens[token.Hash] = token
+
+	return nil
+}
+
+func (m *MemoryOneTimeStore) Get(hash, purpose string, now time.Time) (OneTimeToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.get(hash, purpose, now)
+}
+
+func (m *MemoryOneTimeStore) Consume(hash, purpose string, now time.Time) (OneTimeToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, err := m.get(hash, purpose, now)
+
+	if err != nil {
+		return OneTimeToken{}, err
+	}
+
+	delete(m.tokens, hash)
+
+	return token, nil
+}
+
+func (m *MemoryOneTimeStore) get(hash, purpose string, now time.Time) (OneTimeToken, error) {
+	token, ok := m.tokens[hash]
+
+	if !ok || token.Purpose != purpose || !now.Before(token.ExpiresAt) {
+		return OneTimeToken{}, ErrOneTimeInvalid
+	}
+
+	return token, nil
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OneTimeStore", func() {
+
+	var store *MemoryOneTimeStore
+	var now time.Time
+
+	BeforeEach(func() {
+		store = NewMemoryOneTimeStore()
+		now = time.Unix(1000000, 0)
+
+		Expect(store.Create(OneTimeToken{
+			Hash:      HashToken("token"),
+			Purpose:   PurposePasswordReset,
+			Subject:   "someone@example.com",
+			ExpiresAt: now.Add(time.Hour),
+		})).To(BeNil())
+	})
+
+	It("Consume: returns the token once", func() {
+		token, err := store.Consume(HashToken("token"), PurposePasswordReset, now)
+		Expect(err).To(BeNil())
+		Expect(token.Subject).To(Equal("someone@example.com"))
+
+		_, err = store.Consume(HashToken("token"), PurposePasswordReset, now)
+		Expect(err).To(Equal(ErrOneTimeInvalid))
+	})
+
+	It("Get: does not use the token up", func() {
+		_, err := store.Get(HashToken("token"), PurposePasswordReset, now)
+		Expect(err).To(BeNil())
+
+		_, err = store.Consume(HashToken("token"), PurposePasswordReset, now)
+		Expect(err).To(BeNil())
+	})
+
+	It("Consume: expired token is invalid", func() {
+		_, err := store.Consume(HashToken("token"), PurposePasswordReset, now.Add(time.Hour))
+		Expect(err).To(Equal(ErrOneTimeInvalid))
+	})
+
+	It("Consume: token only works for its purpose", func() {
+		_, err := store.Consume(HashToken("token"), "other", now)
+		Expect(err).To(Equal(ErrOneTimeInvalid))
+	})
+
+	It("Create: replaces the earlier token of the subject", func() {
+		Expect(store.Create(OneTimeToken{
+			Hash:      HashToken("newer"),
+			Purpose:   PurposePasswordReset,
+			Subject:   "someone@example.com",
+			ExpiresAt: now.Add(time.Hour),
+		})).To(BeNil())
+
+		_, err := store.Consume(HashToken("token"), PurposePasswordReset, now)
+		Expect(err).To(Equal(ErrOneTimeInvalid))
+
+		_, err = store.Consume(HashToken("newer"), PurposePasswordReset, now)
+		Expect(err).To(BeNil())
+	})
+
+})
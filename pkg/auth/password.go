@@ -0,0 +1,306 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Reasons a password can be refused, sent to the client as is
+const (
+	PasswordTooShort       = "too_short"
+	PasswordTooLong        = "too_long"
+	PasswordMissingUpper   = "missing_upper"
+	PasswordMissingLower   = "missing_lower"
+	PasswordMissingNumber  = "missing_number"
+	PasswordMissingSymbol  = "missing_symbol"
+	PasswordBanned         = "banned"
+	PasswordBreached       = "breached"
+	PasswordContainsDetail = "contains_account_detail"
+)
+
+// PasswordPolicy decides which passwords can be chosen. It is only applied
+// when a password is set, never when logging in, so it can be tightened
+// without locking anyone out.
+type PasswordPolicy struct {
+	MinLength int
+
+	// Bounds the cost of hashing, 0 for no limit
+	MaxLength int
+
+	RequireUpper  bool
+	RequireLower  bool
+	RequireNumber bool
+	RequireSymbol bool
+
+	// Lower case passwords that are never allowed
+	Banned map[string]bool
+
+	// Optional list of passwords seen in breaches
+	Breached *BreachedList
+}
+
+// PolicyError lists every reason the password was refused
+type PolicyError struct {
+	Reasons []string
+}
+
+func (e *PolicyError) Error() string {
+	return "password: " + strings.Join(e.Reasons, ", ")
+}
+
+func DefaultPasswordPolicy() *PasswordPolicy {
+	return &PasswordPolicy{
+		MinLength:     10,
+		MaxLength:     128,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireNumber: true,
+		Banned:        make(map[string]bool),
+	}
+}
+
+// Check returns a *PolicyError if the password is not allowed. Details of the
+// account such as the username or email cannot be part of the password.
+func (p *PasswordPolicy) Check(password string, accountDetails ...string) error {
+	reasons := []string{}
+	length := utf8.RuneCountInString(password)
+
+	if length < p.MinLength {
+		reasons = append(reasons, PasswordTooShort)
+	}
+
+	if p.MaxLength > 0 && length > p.MaxLength {
+		reasons = append(reasons, PasswordTooLong)
+	}
+
+	var hasUpper, hasLower, hasNumber, hasSymbol bool
+
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			hasUpper = true
+		case unicode.IsLower(char):
+			hasLower = true
+		case unicode.IsNumber(char):
+			hasNumber = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char) || unicode.IsSpace(char):
+			hasSymbol = true
+		}
+	}
+
+	if p.RequireUpper && !hasUpper {
+		reasons = append(reasons, PasswordMissingUpper)
+	}
+
+	if p.RequireLower && !hasLower {
+		reasons = append(reasons, PasswordMissingLower)
+	}
+
+	if p.RequireNumber && !hasNumber {
+		reasons = append(reasons, PasswordMissingNumber)
+	}
+
+	if p.RequireSymbol && !hasSymbol {
+		reasons = append(reasons, PasswordMissingSymbol)
+	}
+
+	lower := strings.ToLower(password)
+
+	if p.Banned[lower] {
+		reasons = append(reasons, PasswordBanned)
+	}
+
+	for _, detail := range accountDetails {
+		// the local part of an email is what people reuse
+		detail = strings.ToLower(strings.Split(detail, "@")[0])
+
+		if len(detail) >= 3 && strings.Contains(lower, detail) {
+			reasons = append(reasons, PasswordContainsDetail)
+			break
+		}
+	}
+
+	if p.Breached != nil {
+		breached, err := p.Breached.Contains(password)
+
+		if err != nil {
+			return err
+		}
+
+		if breached {
+			reasons = append(reasons, PasswordBreached)
+		}
+	}
+
+	if len(reasons) > 0 {
+		return &PolicyError{Reasons: reasons}
+	}
+
+	return nil
+}
+
+// BreachedList looks passwords up by SHA-1 hash. It is either a single file
+// of "HASH[:COUNT]" lines, or a directory of k-anonymity range files named by
+// the first five characters of the hash holding "SUFFIX[:COUNT]" lines, the
+// layout used by the Pwned Passwords range API.
+type BreachedList struct {
+	dir string
+
+	// prefix -> suffixes, only used for a single file
+	hashes map[string]map[string]bool
+}
+
+func LoadBreachedList(path string) (*BreachedList, error) {
+	info, err := os.Stat(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// range files are read on demand
+	if info.IsDir() {
+		return &BreachedList{dir: path}, nil
+	}
+
+	file, err := os.Open(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	list := &BreachedList{hashes: make(map[string]map[string]bool)}
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		hash := strings.ToUpper(strings.TrimSpace(strings.Split(scanner.Text(), ":")[0]))
+
+		if len(hash) != 40 {
+			continue
+		}
+
+		if list.hashes[hash[:5]] == nil {
+			list.hashes[hash[:5]] = make(map[string]bool)
+		}
+
+		list.hashes[hash[:5]][hash[5:]] = true
+	}
+
+	return list, scanner.Err()
+}
+
+func (b *BreachedList) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if b.dir == "" {
+		return b.hashes[prefix][suffix], nil
+	}
+
+	file, err := os.Open(filepath.Join(b.dir, prefix))
+
+	// no range file means nothing with that prefix was breached
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+
+	for scanner.Scan() {
+		if strings.EqualFold(strings.TrimSpace(strings.Split(scanner.Text(), ":")[0]), suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+// NewPasswordPolicyFromEnv builds the policy from the PASSWORD_* variables,
+// anything unset keeps the default
+func NewPasswordPolicyFromEnv() (*PasswordPolicy, error) {
+	policy := DefaultPasswordPolicy()
+
+	if value := os.Getenv("PASSWORD_MIN_LENGTH"); value != "" {
+		length, err := strconv.Atoi(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("PASSWORD_MIN_LENGTH: %v", err)
+		}
+
+		policy.MinLength = length
+	}
+
+	if value := os.Getenv("PASSWORD_MAX_LENGTH"); value != "" {
+		length, err := strconv.Atoi(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("PASSWORD_MAX_LENGTH: %v", err)
+		}
+
+		policy.MaxLength = length
+	}
+
+	if value, ok := os.LookupEnv("PASSWORD_REQUIRE"); ok {
+		policy.RequireUpper = false
+		policy.RequireLower = false
+		policy.RequireNumber = false
+
+		for _, class := range strings.Split(value, ",") {
+			switch strings.TrimSpace(class) {
+			case "upper":
+				policy.RequireUpper = true
+			case "lower":
+				policy.RequireLower = true
+			case "number":
+				policy.RequireNumber = true
+			case "symbol":
+				policy.RequireSymbol = true
+			case "":
+			default:
+				return nil, fmt.Errorf("PASSWORD_REQUIRE: unknown character class %q", class)
+			}
+		}
+	}
+
+	if path := os.Getenv("PASSWORD_BANNED_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				policy.Banned[strings.ToLower(line)] = true
+			}
+		}
+	}
+
+	if path := os.Getenv("PASSWORD_BREACHED_PATH"); path != "" {
+		breached, err := LoadBreachedList(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		policy.Breached = breached
+	}
+
+	return policy, nil
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func reasonsOf(err error) []string {
+	var policyErr *PolicyError
+
+	if errors.As(err, &policyErr) {
+		return policyErr.Reasons
+	}
+
+	return nil
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+var _ = Describe("PasswordPolicy", func() {
+
+	It("Check: valid password passes the default policy", func() {
+		Expect(DefaultPasswordPolicy().Check("PasswordOne123")).To(BeNil())
+	})
+
+	It("Check: every failed rule is reported", func() {
+		err := DefaultPasswordPolicy().Check("short")
+
+		Expect(reasonsOf(err)).To(ConsistOf(PasswordTooShort, PasswordMissingUpper, PasswordMissingNumber))
+	})
+
+	It("Check: length is counted in characters", func() {
+		policy := &PasswordPolicy{MinLength: 4, MaxLength: 4}
+
+		Expect(policy.Check("äöüß")).To(BeNil())
+		Expect(reasonsOf(policy.Check("äöüßx"))).To(ConsistOf(PasswordTooLong))
+	})
+
+	It("Check: banned passwords ignore case", func() {
+		policy := DefaultPasswordPolicy()
+		policy.Banned["password123abc"] = true
+
+		Expect(reasonsOf(policy.Check("Password123ABC"))).To(ConsistOf(PasswordBanned))
+	})
+
+	It("Check: password cannot contain the username or email", func() {
+		policy := DefaultPasswordPolicy()
+
+		Expect(reasonsOf(policy.Check("Some-user123", "some-user", "other@example.com"))).To(ConsistOf(PasswordContainsDetail))
+		Expect(reasonsOf(policy.Check("MyName12345", "someone", "myname@example.com"))).To(ConsistOf(PasswordContainsDetail))
+	})
+
+	It("Breached: single file of hashes", func() {
+		dir, _ := os.MkdirTemp("", "breached")
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "hashes.txt")
+		os.WriteFile(path, []byte(sha1Hex("Breached12345")+":42\n"), 0600)
+
+		breached, err := LoadBreachedList(path)
+		Expect(err).To(BeNil())
+
+		policy := DefaultPasswordPolicy()
+		policy.Breached = breached
+
+		Expect(reasonsOf(policy.Check("Breached12345"))).To(ConsistOf(PasswordBreached))
+		Expect(policy.Check("NotBreached12345")).To(BeNil())
+	})
+
+	It("Breached: directory of range files", func() {
+		dir, _ := os.MkdirTemp("", "breached")
+		defer os.RemoveAll(dir)
+
+		hash := sha1Hex("Breached12345")
+		os.WriteFile(filepath.Join(dir, hash[:5]), []byte("0000000000000000000000000000000000A:1\n"+strings.ToLower(hash[5:])+":42\n"), 0600)
+
+		breached, err := LoadBreachedList(dir)
+		Expect(err).To(BeNil())
+
+		Expect(breached.Contains("Breached12345")).To(BeTrue())
+		Expect(breached.Contains("NotBreached12345")).To(BeFalse())
+	})
+
+	It("Env: character classes can be configured", func() {
+		os.Setenv("PASSWORD_MIN_LENGTH", "12")
+		os.Setenv("PASSWORD_REQUIRE", "lower,symbol")
+		defer os.Unsetenv("PASSWORD_MIN_LENGTH")
+		defer os.Unsetenv("PASSWORD_REQUIRE")
+
+		policy, err := NewPasswordPolicyFromEnv()
+		Expect(err).To(BeNil())
+
+		Expect(policy.Check("correct horse")).To(BeNil())
+		Expect(reasonsOf(policy.Check("correcthorse"))).To(ConsistOf(PasswordMissingSymbol))
+	})
+
+})
@@ -0,0 +1,185 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRefreshInvalid = errors.New("invalid: refresh token is invalid or expired")
+
+	// Returned when a used token is presented again, the family is revoked
+	ErrRefreshReused = errors.New("reused: refresh token has already been used")
+)
+
+// RefreshRecord is what is stored for a refresh token. The token itself is
+// never stored, only its hash. Every token rotated from the same login shares
+// a family.
+type RefreshRecord struct {
+	Hash      string
+	Family    string
+	Username  string
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	Used      bool
+	Revoked   bool
+
+	// Device the token was issued to
+	UserAgent string
+	IP        string
+}
+
+// Session is a login on one device, the token family is its id
+type Session struct {
+	ID        string
+	Username  string
+	UserAgent string
+	IP        string
+	CreatedAt time.Time
+	LastUsed  time.Time
+}
+
+type RefreshStore interface {
+	Create(record RefreshRecord) error
+
+	// Rotate atomically marks the token for oldHash as used and stores next
+	// in the same family, returning the old record. If the old token had
+	// already been used the family is revoked and ErrRefreshReused returned.
+	Rotate(oldHash string, next RefreshRecord, now time.Time) (RefreshRecord, error)
+
+	RevokeFamily(family string) error
+
+	// ListSessions returns every family of the user that can still refresh
+	ListSessions(username string, now time.Time) ([]Session, error)
+}
+
+// NewRefreshToken returns a random token and the hash to store for it
+func NewRefreshToken() (string, string) {
+	token := make([]byte, 32)
+
+	if _, err := rand.Read(token); err != nil {
+		panic(err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(token)
+
+	return encoded, HashToken(encoded)
+}
+
+// NewFamily returns a random id for a new token family
+func NewFamily() string {
+	family := make([]byte, 16)
+
+	if _, err := rand.Read(family); err != nil {
+		panic(err)
+	}
+
+	return hex.EncodeToString(family)
+}
+
+// HashToken is used for anything stored that works like a password, the
+// tokens are random so a fast hash is enough
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryRefreshStore keeps tokens in memory, only suitable for a single node.
+type MemoryRefreshStore struct {
+	mu      sync.Mutex
+	records map[string]RefreshRecord
+}
+
+func NewMemoryRefreshStore() *MemoryRefreshStore {
+	return &MemoryRefreshStore{records: make(map[string]RefreshRecord)}
+}
+
+func (m *MemoryRefreshStore) Create(record RefreshRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.records[record.Hash] = record
+
+	return nil
+}
+
+func (m *MemoryRefreshStore) Rotate(oldHash string, next RefreshRecord, now time.Time) (RefreshRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	old, ok := m.records[oldHash]
+
+	if !ok || old.Revoked || !now.Before(old.ExpiresAt) {
+		return RefreshRecord{}, ErrRefreshInvalid
+	}
+
+	if old.Used {
+		m.revokeFamily(old.Family)
+		return RefreshRecord{}, ErrRefreshReused
+	}
+
+	old.Used = true
+	m.records[oldHash] = old
+
+	next.Family = old.Family
+	next.Username = old.Username
+	m.records[next.Hash] = next
+
+	return old, nil
+}
+
+func (m *MemoryRefreshStore) RevokeFamily(family string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.revokeFamily(family)
+
+	return nil
+}
+
+func (m *MemoryRefreshStore) ListSessions(username string, now time.Time) ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	created := make(map[string]time.Time)
+
+	for _, record := range m.records {
+		if first, ok := created[record.Family]; !ok || record.IssuedAt.Before(first) {
+			created[record.Family] = record.IssuedAt
+		}
+	}
+
+	sessions := []Session{}
+
+	// the unused token of a family is the latest one
+	for _, record := range m.records {
+		if record.Username != username || record.Used || record.Revoked || !now.Before(record.ExpiresAt) {
+			continue
+		}
+
+		sessions = append(sessions, Session{
+			ID:        record.Family,
+			Username:  record.Username,
+			UserAgent: record.UserAgent,
+			IP:        record.IP,
+			CreatedAt: created[record.Family],
+			LastUsed:  record.IssuedAt,
+		})
+	}
+
+	return sessions, nil
+}
+
+func (m *MemoryRefreshStore) revokeFamily(family string) {
+	for hash, record := range m.records {
+		if record.Family == family {
+			record.Revoked = true
+			m.records[hash] = record
+		}
+	}
+}
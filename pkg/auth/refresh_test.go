@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RefreshStore", func() {
+
+	var store *MemoryRefreshStore
+	var now time.Time
+	var token string
+
+	BeforeEach(func() {
+		store = NewMemoryRefreshStore()
+		now = time.Unix(1000000, 0)
+
+		var hash string
+		token, hash = NewRefreshToken()
+
+		Expect(store.Create(RefreshRecord{
+			Hash:      hash,
+			Family:    "family",
+			Username:  "some-user",
+			IssuedAt:  now,
+			ExpiresAt: now.Add(time.Hour),
+		})).To(BeNil())
+	})
+
+	next := func() (string, RefreshRecord) {
+		token, hash := NewRefreshToken()
+		return token, RefreshRecord{Hash: hash, IssuedAt: now, ExpiresAt: now.Add(time.Hour)}
+	}
+
+	It("Rotate: returns the old record and keeps the family", func() {
+		nextToken, record := next()
+
+		old, err := store.Rotate(HashToken(token), record, now)
+		Expect(err).To(BeNil())
+		Expect(old.Username).To(Equal("some-user"))
+
+		_, another := next()
+		rotated, err := store.Rotate(HashToken(nextToken), another, now)
+		Expect(err).To(BeNil(), "New token should be usable")
+		Expect(rotated.Family).To(Equal("family"))
+	})
+
+	It("Rotate: unknown token is invalid", func() {
+		_, record := next()
+
+		_, err := store.Rotate(HashToken("unknown"), record, now)
+		Expect(err).To(Equal(ErrRefreshInvalid))
+	})
+
+	It("Rotate: expired token is invalid", func() {
+		_, record := next()
+
+		_, err := store.Rotate(HashToken(token), record, now.Add(time.Hour))
+		Expect(err).To(Equal(ErrRefreshInvalid))
+	})
+
+	It("Rotate: reuse revokes the whole family", func() {
+		nextToken, record := next()
+		_, err := store.Rotate(HashToken(token), record, now)
+		Expect(err).To(BeNil())
+
+		_, replay := next()
+		_, err = store.Rotate(HashToken(token), replay, now)
+		Expect(err).To(Equal(ErrRefreshReused), "Old token should be detected as reused")
+
+		_, legitimate := next()
+		_, err = store.Rotate(HashToken(nextToken), legitimate, now)
+		Expect(err).To(Equal(ErrRefreshInvalid), "Descendant token should be revoked")
+	})
+
+})
+
+var _ = Describe("Sessions", func() {
+
+	now := time.Unix(1000000, 0)
+
+	It("ListSessions: one session per family with the latest device", func() {
+		store := NewMemoryRefreshStore()
+
+		token, hash := NewRefreshToken()
+		store.Create(RefreshRecord{Hash: hash, Family: "one", Username: "some-user", IssuedAt: now, ExpiresAt: now.Add(time.Hour), UserAgent: "phone"})
+
+		_, other := NewRefreshToken()
+		store.Create(RefreshRecord{Hash: other, Family: "two", Username: "some-user", IssuedAt: now, ExpiresAt: now.Add(time.Hour), UserAgent: "laptop"})
+
+		_, someoneElse := NewRefreshToken()
+		store.Create(RefreshRecord{Hash: someoneElse, Family: "three", Username: "another-user", IssuedAt: now, ExpiresAt: now.Add(time.Hour)})
+
+		_, next := NewRefreshToken()
+		later := now.Add(time.Minute)
+		_, err := store.Rotate(HashToken(token), RefreshRecord{Hash: next, IssuedAt: later, ExpiresAt: later.Add(time.Hour), UserAgent: "phone", IP: "10.0.0.1"}, later)
+		Expect(err).To(BeNil())
+
+		sessions, err := store.ListSessions("some-user", later)
+		Expect(err).To(BeNil())
+		Expect(sessions).To(HaveLen(2))
+
+		for _, session := range sessions {
+			if session.ID == "one" {
+				Expect(session.CreatedAt).To(Equal(now))
+				Expect(session.LastUsed).To(Equal(later))
+				Expect(session.IP).To(Equal("10.0.0.1"))
+			}
+		}
+
+		store.RevokeFamily("two")
+
+		sessions, _ = store.ListSessions("some-user", later)
+		Expect(sessions).To(HaveLen(1), "Revoked session should not be listed")
+	})
+
+	It("Revocation: revoked until the access token expires", func() {
+		current := now
+		store := NewMemoryRevocationStore()
+		store.Now = func() time.Time { return current }
+
+		Expect(store.Revoke("one", now.Add(time.Minute))).To(BeNil())
+
+		revoked, _ := store.IsRevoked("one")
+		Expect(revoked).To(BeTrue())
+
+		revoked, _ = store.IsRevoked("two")
+		Expect(revoked).To(BeFalse())
+
+		current = now.Add(2 * time.Minute)
+		revoked, _ = store.IsRevoked("one")
+		Expect(revoked).To(BeFalse(), "Revocation should lapse with the token")
+	})
+
+})
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// RevocationStore records sessions whose access tokens must no longer be
+// accepted. Entries only need to live as long as the longest access token.
+type RevocationStore interface {
+	Revoke(sessionID string, until time.Time) error
+	IsRevoked(sessionID string) (bool, error)
+}
+
+// MemoryRevocationStore keeps revocations in memory, only suitable for a
+// single node.
+type MemoryRevocationStore struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+}
+
+func NewMemoryRevocationStore() *MemoryRevocationStore {
+	return &MemoryRevocationStore{revoked: make(map[string]time.Time)}
+}
+
+func (m *MemoryRevocationStore) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+
+	return time.Now()
+}
+
+func (m *MemoryRevocationStore) Revoke(sessionID string, until time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	// drop entries whose tokens have expired anyway
+	for id, expires := range m.revoked {
+		if now.After(expires) {
+			delete(m.revoked, id)
+		}
+	}
+
+	m.revoked[sessionID] = until
+
+	return nil
+}
+
+func (m *MemoryRevocationStore) IsRevoked(sessionID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	until, ok := m.revoked[sessionID]
+
+	return ok && !m.now().After(until), nil
+}
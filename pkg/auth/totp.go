@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP generates and checks time based one-time passwords (RFC 6238) with
+// HMAC-SHA1, which is what authenticator apps expect.
+type TOTP struct {
+	Digits int
+	Period time.Duration
+
+	// Steps either side of now that are accepted, for clock drift
+	Skew int64
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+}
+
+func DefaultTOTP() *TOTP {
+	return &TOTP{Digits: 6, Period: 30 * time.Second, Skew: 1}
+}
+
+func (t *TOTP) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+
+	return time.Now()
+}
+
+// NewTOTPSecret returns a random secret encoded as base32 without padding
+func NewTOTPSecret() string {
+	secret := make([]byte, 20)
+
+	if _, err := rand.Read(secret); err != nil {
+		panic(err)
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret)
+}
+
+// Counter returns the time step of the time
+func (t *TOTP) Counter(at time.Time) int64 {
+	return at.Unix() / int64(t.Period/time.Second)
+}
+
+// Code returns the code of the secret for the time step
+func (t *TOTP) Code(secret string, counter int64) (string, error) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+
+	if err != nil {
+		return "", err
+	}
+
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message[:])
+	sum := mac.Sum(nil)
+
+	// dynamic truncation from RFC 4226
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	modulo := uint32(1)
+	for i := 0; i < t.Digits; i++ {
+		modulo *= 10
+	}
+
+	return fmt.Sprintf("%0*d", t.Digits, value%modulo), nil
+}
+
+// Verify returns the time step the code is valid for, trying the steps
+// within Skew of now
+func (t *TOTP) Verify(secret, code string) (int64, bool) {
+	if len(code) != t.Digits {
+		return 0, false
+	}
+
+	now := t.Counter(t.now())
+
+	for counter := now - t.Skew; counter <= now+t.Skew; counter++ {
+		expected, err := t.Code(secret, counter)
+
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// ProvisioningURI returns the otpauth URI shown as a QR code to add the
+// secret to an authenticator app
+func (t *TOTP) ProvisioningURI(issuer, account, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(t.Digits))
+	query.Set("period", fmt.Sprint(int64(t.Period/time.Second)))
+
+	label := url.PathEscape(issuer) + ":" + url.PathEscape(account)
+
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TOTP", func() {
+
+	// "12345678901234567890" from the RFC 6238 test vectors
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+	var totp *TOTP
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Unix(59, 0)
+		totp = DefaultTOTP()
+		totp.Now = func() time.Time { return now }
+	})
+
+	It("Code: matches the RFC 6238 test vectors", func() {
+		totp.Digits = 8
+
+		for unix, expected := range map[int64]string{
+			59:         "94287082",
+			1111111109: "07081804",
+			1234567890: "89005924",
+			2000000000: "69279037",
+		} {
+			code, err := totp.Code(secret, totp.Counter(time.Unix(unix, 0)))
+			Expect(err).To(BeNil())
+			Expect(code).To(Equal(expected))
+		}
+	})
+
+	It("Verify: accepts the current code and returns its step", func() {
+		code, _ := totp.Code(secret, totp.Counter(now))
+
+		counter, ok := totp.Verify(secret, code)
+		Expect(ok).To(BeTrue())
+		Expect(counter).To(Equal(int64(1)))
+	})
+
+	It("Verify: accepts a code one step either side", func() {
+		code, _ := totp.Code(secret, totp.Counter(now))
+
+		now = now.Add(30 * time.Second)
+		_, ok := totp.Verify(secret, code)
+		Expect(ok).To(BeTrue(), "Previous step should be accepted")
+
+		now = now.Add(30 * time.Second)
+		_, ok = totp.Verify(secret, code)
+		Expect(ok).To(BeFalse(), "Two steps later should be refused")
+	})
+
+	It("Verify: refuses wrong and badly formed codes", func() {
+		_, ok := totp.Verify(secret, "000000")
+		Expect(ok).To(BeFalse())
+
+		_, ok = totp.Verify(secret, "12345")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("ProvisioningURI: carries the secret and issuer", func() {
+		uri := totp.ProvisioningURI("Conduit", "someone@example.com", secret)
+
+		Expect(strings.HasPrefix(uri, "otpauth://totp/Conduit:someone@example.com?")).To(BeTrue())
+		Expect(uri).To(ContainSubstring("secret=" + secret))
+		Expect(uri).To(ContainSubstring("issuer=Conduit"))
+		Expect(uri).To(ContainSubstring("digits=6"))
+		Expect(uri).To(ContainSubstring("period=30"))
+	})
+
+})
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"sync"
+)
+
+var (
+	// Returned by a correct password when a code is still needed
+	ErrTwoFactorRequired = errors.New("2fa required: a code is needed to finish logging in")
+
+	ErrTwoFactorInvalid  = errors.New("2fa: code is invalid")
+	ErrTwoFactorEnabled  = errors.New("2fa state: two-factor authentication is already enabled")
+	ErrTwoFactorDisabled = errors.New("2fa state: two-factor authentication is not enabled")
+)
+
+// Number of recovery codes given when 2FA is enabled
+const recoveryCodeCount = 10
+
+// TwoFactorRecord is the 2FA state of a user. Recovery codes are only stored
+// hashed, the secret has to be stored as is to check codes.
+type TwoFactorRecord struct {
+	Enabled bool
+	Secret  string
+
+	// Secret waiting for its first code before 2FA is enabled
+	PendingSecret string
+
+	// Last time step a code was used for, a code only works once
+	LastCounter int64
+
+	RecoveryCodes []string
+}
+
+type TwoFactorStore interface {
+	// Get returns an empty record for users without 2FA
+	Get(username string) (TwoFactorRecord, error)
+
+	SetPending(username, secret string) error
+
+	// Enable moves the pending secret into use with new recovery codes
+	Enable(username string, recoveryHashes []string) error
+
+	Disable(username string) error
+
+	// UseCounter records that a code for the time step was used, false if
+	// one for it or a later step already was
+	UseCounter(username string, counter int64) (bool, error)
+
+	// UseRecoveryCode removes the recovery code, false if it was not there
+	UseRecoveryCode(username, hash string) (bool, error)
+}
+
+// TwoFactor runs enrollment and verification of TOTP codes.
+type TwoFactor struct {
+	Store TwoFactorStore
+	TOTP  *TOTP
+
+	// Shown in authenticator apps next to the account
+	Issuer string
+}
+
+func NewTwoFactor(store TwoFactorStore, issuer string) *TwoFactor {
+	return &TwoFactor{Store: store, TOTP: DefaultTOTP(), Issuer: issuer}
+}
+
+func (t *TwoFactor) Enabled(username string) (bool, error) {
+	record, err := t.Store.Get(username)
+
+	return record.Enabled, err
+}
+
+// Enroll starts enabling 2FA, returning the provisioning URI of a new secret.
+// Nothing changes until Confirm is given a code from it.
+func (t *TwoFactor) Enroll(username, account string) (string, error) {
+	record, err := t.Store.Get(username)
+
+	if err != nil {
+		return "", err
+	}
+
+	if record.Enabled {
+		return "", ErrTwoFactorEnabled
+	}
+
+	secret := NewTOTPSecret()
+
+	if err = t.Store.SetPending(username, secret); err != nil {
+		return "", err
+	}
+
+	return t.TOTP.ProvisioningURI(t.Issuer, account, secret), nil
+}
+
+// Confirm enables 2FA once a code from the pending secret is given, returning
+// the recovery codes. They are only ever shown this once.
+func (t *TwoFactor) Confirm(username, code string) ([]string, error) {
+	record, err := t.Store.Get(username)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Enabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	if record.PendingSecret == "" {
+		return nil, ErrTwoFactorDisabled
+	}
+
+	counter, ok := t.TOTP.Verify(record.PendingSecret, code)
+
+	if !ok {
+		return nil, ErrTwoFactorInvalid
+	}
+
+	codes, hashes := NewRecoveryCodes(recoveryCodeCount)
+
+	if err = t.Store.Enable(username, hashes); err != nil {
+		return nil, err
+	}
+
+	// the confirming code cannot be used again to log in
+	if _, err = t.Store.UseCounter(username, counter); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// Verify checks a code from the authenticator app or a recovery code, either
+// only works once
+func (t *TwoFactor) Verify(username, code string) error {
+	record, err := t.Store.Get(username)
+
+	if err != nil {
+		return err
+	}
+
+	if !record.Enabled {
+		return ErrTwoFactorDisabled
+	}
+
+	code = strings.TrimSpace(code)
+
+	if counter, ok := t.TOTP.Verify(record.Secret, code); ok {
+		used, err := t.Store.UseCounter(username, counter)
+
+		if err != nil {
+			return err
+		}
+
+		if !used {
+			return ErrTwoFactorInvalid
+		}
+
+		return nil
+	}
+
+	used, err := t.Store.UseRecoveryCode(username, HashToken(normaliseRecoveryCode(code)))
+
+	if err != nil {
+		return err
+	}
+
+	if !used {
+		return ErrTwoFactorInvalid
+	}
+
+	return nil
+}
+
+// Disable turns 2FA off after checking a code
+func (t *TwoFactor) Disable(username, code string) error {
+	if err := t.Verify(username, code); err != nil {
+		return err
+	}
+
+	return t.Store.Disable(username)
+}
+
+// NewRecoveryCodes returns codes formatted as xxxxx-xxxxx and their hashes
+func NewRecoveryCodes(count int) ([]string, []string) {
+	codes := make([]string, count)
+	hashes := make([]string, count)
+
+	for i := range codes {
+		random := make([]byte, 7)
+
+		if _, err := rand.Read(random); err != nil {
+			panic(err)
+		}
+
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(random))[:10]
+
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = HashToken(code)
+	}
+
+	return codes, hashes
+}
+
+// normaliseRecoveryCode lets codes be typed without the dash or in upper case
+func normaliseRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// MemoryTwoFactorStore keeps 2FA in memory, only suitable for tests.
+type MemoryTwoFactorStore struct {
+	mu      sync.Mutex
+	records map[string]TwoFactorRecord
+}
+
+func NewMemoryTwoFactorStore() *MemoryTwoFactorStore {
+	return &MemoryTwoFactorStore{records: make(map[string]TwoFactorRecord)}
+}
+
+func (m *MemoryTwoFactorStore) Get(username string) (TwoFactorRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.records[username], nil
+}
+
+func (m *MemoryTwoFactorStore) SetPending(username, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[username]
+	record.PendingSecret = secret
+	m.records[username] = record
+
+	return nil
+}
+
+func (m *MemoryTwoFactorStore) Enable(username string, recoveryHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[username]
+	record.Enabled = true
+	record.Secret = record.PendingSecret
+	record.PendingSecret = ""
+	record.RecoveryCodes = recoveryHashes
+	m.records[username] = record
+
+	return nil
+}
+
+func (m *MemoryTwoFactorStore) Disable(username string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.records, username)
+
+	return nil
+}
+
+func (m *MemoryTwoFactorStore) UseCounter(username string, counter int64) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[username]
+
+	if counter <= record.LastCounter {
+		return false, nil
+	}
+
+	record.LastCounter = counter
+	m.records[username] = record
+
+	return true, nil
+}
+
+func (m *MemoryTwoFactorStore) UseRecoveryCode(username, hash string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record := m.records[username]
+
+	for i, stored := range record.RecoveryCodes {
+		if stored == hash {
+			record.RecoveryCodes = append(append([]string{}, record.RecoveryCodes[:i]...), record.RecoveryCodes[i+1:]...)
+			m.records[username] = record
+
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"net/url"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("TwoFactor", func() {
+
+	var twoFactor *TwoFactor
+	var now time.Time
+
+	BeforeEach(func() {
+		now = time.Unix(1000000, 0)
+
+		twoFactor = NewTwoFactor(NewMemoryTwoFactorStore(), "Conduit")
+		twoFactor.TOTP.Now = func() time.Time { return now }
+	})
+
+	secretOf := func(uri string) string {
+		parsed, err := url.Parse(uri)
+		Expect(err).To(BeNil())
+
+		return parsed.Query().Get("secret")
+	}
+
+	codeAt := func(secret string, at time.Time) string {
+		code, err := twoFactor.TOTP.Code(secret, twoFactor.TOTP.Counter(at))
+		Expect(err).To(BeNil())
+
+		return code
+	}
+
+	enable := func() (string, []string) {
+		uri, err := twoFactor.Enroll("some-user", "someone@example.com")
+		Expect(err).To(BeNil())
+
+		secret := secretOf(uri)
+
+		codes, err := twoFactor.Confirm("some-user", codeAt(secret, now))
+		Expect(err).To(BeNil())
+
+		return secret, codes
+	}
+
+	It("Enroll: is not enabled until confirmed", func() {
+		_, err := twoFactor.Enroll("some-user", "someone@example.com")
+		Expect(err).To(BeNil())
+
+		Expect(twoFactor.Enabled("some-user")).To(BeFalse())
+	})
+
+	It("Confirm: refuses a wrong code", func() {
+		_, err := twoFactor.Enroll("some-user", "someone@example.com")
+		Expect(err).To(BeNil())
+
+		_, err = twoFactor.Confirm("some-user", "000000")
+		Expect(err).To(Equal(ErrTwoFactorInvalid))
+		Expect(twoFactor.Enabled("some-user")).To(BeFalse())
+	})
+
+	It("Confirm: enables 2FA and returns recovery codes", func() {
+		_, codes := enable()
+
+		Expect(twoFactor.Enabled("some-user")).To(BeTrue())
+		Expect(codes).To(HaveLen(recoveryCodeCount))
+	})
+
+	It("Enroll: refused once enabled", func() {
+		enable()
+
+		_, err := twoFactor.Enroll("some-user", "someone@example.com")
+		Expect(err).To(Equal(ErrTwoFactorEnabled))
+	})
+
+	It("Verify: the confirming code cannot be used to log in", func() {
+		secret, _ := enable()
+
+		Expect(twoFactor.Verify("some-user", codeAt(secret, now))).To(Equal(ErrTwoFactorInvalid))
+	})
+
+	It("Verify: accepts a later code only once", func() {
+		secret, _ := enable()
+
+		now = now.Add(30 * time.Second)
+		code := codeAt(secret, now)
+
+		Expect(twoFactor.Verify("some-user", code)).To(BeNil())
+		Expect(twoFactor.Verify("some-user", code)).To(Equal(ErrTwoFactorInvalid), "Code should not be replayed")
+	})
+
+	It("Verify: refuses a code that has expired", func() {
+		secret, _ := enable()
+
+		code := codeAt(secret, now.Add(30*time.Second))
+		now = now.Add(2 * time.Minute)
+
+		Expect(twoFactor.Verify("some-user", code)).To(Equal(ErrTwoFactorInvalid))
+	})
+
+	It("Verify: recovery codes work once and ignore formatting", func() {
+		_, codes := enable()
+
+		Expect(twoFactor.Verify("some-user", codes[0])).To(BeNil())
+		Expect(twoFactor.Verify("some-user", codes[0])).To(Equal(ErrTwoFactorInvalid))
+
+		upper := []byte(codes[1])
+		for i := range upper {
+			if upper[i] >= 'a' && upper[i] <= 'z' {
+				upper[i] -= 'a' - 'A'
+			}
+		}
+
+		Expect(twoFactor.Verify("some-user", string(upper))).To(BeNil())
+	})
+
+	It("Verify: refused for users without 2FA", func() {
+		Expect(twoFactor.Verify("some-user", "123456")).To(Equal(ErrTwoFactorDisabled))
+	})
+
+	It("Disable: needs a valid code", func() {
+		secret, _ := enable()
+
+		Expect(twoFactor.Disable("some-user", "000000")).To(Equal(ErrTwoFactorInvalid))
+		Expect(twoFactor.Enabled("some-user")).To(BeTrue())
+
+		now = now.Add(30 * time.Second)
+		Expect(twoFactor.Disable("some-user", codeAt(secret, now))).To(BeNil())
+		Expect(twoFactor.Enabled("some-user")).To(BeFalse())
+	})
+
+})
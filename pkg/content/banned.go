@@ -0,0 +1,84 @@
+package content
+
+import (
+	"os"
+	"strings"
+	"unicode"
+)
+
+// BannedWords are words and phrases text cannot contain. They are matched
+// as whole words ignoring case, so banning "ass" does not refuse "class".
+type BannedWords struct {
+	words   map[string]bool
+	phrases []string
+}
+
+func NewBannedWords(words []string) *BannedWords {
+	banned := &BannedWords{words: make(map[string]bool)}
+
+	for _, word := range words {
+		tokens := tokenize(word)
+
+		switch len(tokens) {
+		case 0:
+		case 1:
+			banned.words[tokens[0]] = true
+		default:
+			banned.phrases = append(banned.phrases, " "+strings.Join(tokens, " ")+" ")
+		}
+	}
+
+	return banned
+}
+
+// LoadBannedWords reads a file of banned words or phrases, one per line.
+// Lines starting with # are comments.
+func LoadBannedWords(path string) (*BannedWords, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	words := []string{}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+
+	return NewBannedWords(words), nil
+}
+
+// Contains is true if the text has any of the words or phrases
+func (b *BannedWords) Contains(text string) bool {
+	tokens := tokenize(text)
+
+	for _, token := range tokens {
+		if b.words[token] {
+			return true
+		}
+	}
+
+	if len(b.phrases) == 0 {
+		return false
+	}
+
+	joined := " " + strings.Join(tokens, " ") + " "
+
+	for _, phrase := range b.phrases {
+		if strings.Contains(joined, phrase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// tokenize splits the text into lower case words of letters and numbers
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(char rune) bool {
+		return !unicode.IsLetter(char) && !unicode.IsNumber(char)
+	})
+}
@@ -0,0 +1,135 @@
+package content
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Policy decides how text from users is cleaned and when it is refused
+type Policy struct {
+	// Longest text in characters once cleaned, 0 for no limit
+	MaxLength int
+
+	// New lines and tabs are kept, otherwise they become spaces
+	Multiline bool
+
+	// Stored text has <, >, &, ' and " escaped so it can be put in a page as
+	// is
+	EscapeHTML bool
+
+	// Text with links is refused when false
+	AllowLinks bool
+
+	// Empty text is allowed
+	Optional bool
+
+	// Optional, nothing is banned when nil
+	Banned *BannedWords
+}
+
+// Result is cleaned text and the links found in it
+type Result struct {
+	Text  string
+	Links []string
+}
+
+// Clean normalises the text, strips characters that should not be in it and
+// checks it against the policy. Errors start with "content", the part before
+// ":" says why it was refused.
+func (p *Policy) Clean(text string) (Result, error) {
+
+	// JSON already replaces invalid bytes, this covers anything else
+	if !utf8.ValidString(text) {
+		text = strings.ToValidUTF8(text, "\uFFFD")
+	}
+
+	// the same text can be written with composed or decomposed characters,
+	// which would get past the length and banned word checks differently
+	text = strings.TrimSpace(strip(norm.NFC.String(text), p.Multiline))
+
+	if text == "" {
+		if p.Optional {
+			return Result{}, nil
+		}
+
+		return Result{}, fmt.Errorf("content: text is empty")
+	}
+
+	if p.MaxLength > 0 && utf8.RuneCountInString(text) > p.MaxLength {
+		return Result{}, fmt.Errorf("content length: text is limited to %d characters", p.MaxLength)
+	}
+
+	if p.Banned != nil && p.Banned.Contains(text) {
+		return Result{}, fmt.Errorf("content banned: text contains a banned word")
+	}
+
+	links := FindLinks(text)
+
+	if !p.AllowLinks && len(links) > 0 {
+		return Result{}, fmt.Errorf("content links: links are not allowed")
+	}
+
+	if p.EscapeHTML {
+		text = html.EscapeString(text)
+	}
+
+	return Result{Text: text, Links: links}, nil
+}
+
+// strip removes control and invisible formatting characters. Direction
+// overrides can make text read differently to what it is, so only the
+// joiners that emoji and some scripts need are kept.
+func strip(text string, multiline bool) string {
+	var builder strings.Builder
+	builder.Grow(len(text))
+
+	for i, char := range text {
+		switch {
+
+		case char == '\r':
+			// \r\n is one new line
+			if i+1 < len(text) && text[i+1] == '\n' {
+				continue
+			}
+
+			builder.WriteRune(newline(multiline))
+
+		// line and paragraph separators are new lines too
+		case char == '\n' || char == '\u2028' || char == '\u2029':
+			builder.WriteRune(newline(multiline))
+
+		case char == '\t':
+			if multiline {
+				builder.WriteRune('\t')
+			} else {
+				builder.WriteRune(' ')
+			}
+
+		// zero width non-joiner and joiner
+		case char == '\u200C' || char == '\u200D':
+			builder.WriteRune(char)
+
+		case unicode.IsControl(char) || unicode.Is(unicode.Cf, char):
+			// dropped
+
+		default:
+			builder.WriteRune(char)
+
+		}
+	}
+
+	return builder.String()
+}
+
+func newline(multiline bool) rune {
+	if multiline {
+		return '\n'
+	}
+
+	return ' '
+}
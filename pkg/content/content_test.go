@@ -0,0 +1,134 @@
+package content
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Content", func() {
+
+	message := DefaultRules().Message
+	title := DefaultRules().ListingTitle
+
+	It("Clean: normal text is kept", func() {
+		result, err := message.Clean("  Is this still for sale?\nI can pick it up today 👍 ")
+		Expect(err).To(BeNil())
+		Expect(result.Text).To(Equal("Is this still for sale?\nI can pick it up today 👍"))
+		Expect(result.Links).To(BeEmpty())
+	})
+
+	It("Clean: text is normalised to composed characters", func() {
+		result, _ := message.Clean("Zu\u0308rich")
+		Expect(result.Text).To(Equal("Z\u00FCrich"))
+	})
+
+	It("Clean: control and direction characters are stripped", func() {
+		result, _ := message.Clean("invoice\u202Efdp.exe\x00\x1b[31m")
+		Expect(result.Text).To(Equal("invoicefdp.exe[31m"))
+
+		result, _ = message.Clean("family 👨\u200D👩\u200D👧")
+		Expect(result.Text).To(Equal("family 👨\u200D👩\u200D👧"), "Joiners are kept for emoji")
+	})
+
+	It("Clean: new lines are only kept when multiline", func() {
+		result, _ := message.Clean("one\r\ntwo\rthree\u2028four")
+		Expect(result.Text).To(Equal("one\ntwo\nthree\nfour"))
+
+		result, _ = title.Clean("one\ntwo\tthree")
+		Expect(result.Text).To(Equal("one two three"))
+	})
+
+	It("Clean: HTML is escaped", func() {
+		result, err := message.Clean(`<script>alert("hi")</script> & more`)
+		Expect(err).To(BeNil())
+		Expect(result.Text).To(Equal("&lt;script&gt;alert(&#34;hi&#34;)&lt;/script&gt; &amp; more"))
+	})
+
+	It("Clean: length is counted in characters before escaping", func() {
+		policy := Policy{MaxLength: 5, EscapeHTML: true}
+
+		_, err := policy.Clean("ééééé")
+		Expect(err).To(BeNil())
+
+		_, err = policy.Clean("<<<<<")
+		Expect(err).To(BeNil())
+
+		_, err = policy.Clean("éééééé")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("content length:"))
+	})
+
+	It("Clean: empty text is refused", func() {
+		_, err := message.Clean(" \n\u200B\x00 ")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("content:"))
+
+		result, err := DefaultRules().ListingDescription.Clean(" ")
+		Expect(err).To(BeNil(), "Descriptions are optional")
+		Expect(result.Text).To(Equal(""))
+	})
+
+	It("Links: are found with or without a scheme", func() {
+		Expect(FindLinks("see https://example.com/a?b=c, or www.example.org.")).To(Equal([]string{"https://example.com/a?b=c", "www.example.org"}))
+		Expect(FindLinks("pay at scam-shop.xyz/checkout now")).To(Equal([]string{"scam-shop.xyz/checkout"}))
+		Expect(FindLinks("e.g. it is fine, i.e. no links")).To(BeEmpty())
+	})
+
+	It("Links: are refused when not allowed", func() {
+		_, err := title.Clean("Bike, details at bikes.com")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("content links:"))
+
+		result, err := message.Clean("Bike, details at bikes.com")
+		Expect(err).To(BeNil())
+		Expect(result.Links).To(Equal([]string{"bikes.com"}))
+	})
+
+	It("Banned: words match whole words ignoring case", func() {
+		banned := NewBannedWords([]string{"scam", "western union"})
+
+		Expect(banned.Contains("This is a SCAM!")).To(BeTrue())
+		Expect(banned.Contains("Pay by Western  Union")).To(BeTrue())
+		Expect(banned.Contains("scampi for dinner")).To(BeFalse())
+		Expect(banned.Contains("western unions")).To(BeFalse())
+
+		policy := Policy{Banned: banned}
+		_, err := policy.Clean("total scam")
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("content banned:"))
+	})
+
+	It("Banned: words can be loaded from a file", func() {
+		dir, _ := ioutil.TempDir("", "content")
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "banned.txt")
+		ioutil.WriteFile(path, []byte("# comment\nscam\n\nwire transfer\n"), 0600)
+
+		banned, err := LoadBannedWords(path)
+		Expect(err).To(BeNil())
+		Expect(banned.Contains("only by wire transfer")).To(BeTrue())
+		Expect(banned.Contains("comment")).To(BeFalse())
+	})
+
+	It("Env: limits and links can be configured", func() {
+		os.Setenv("MESSAGE_MAX_LENGTH", "10")
+		os.Setenv("MESSAGE_LINKS", "false")
+		defer os.Unsetenv("MESSAGE_MAX_LENGTH")
+		defer os.Unsetenv("MESSAGE_LINKS")
+
+		rules, err := NewRulesFromEnv()
+		Expect(err).To(BeNil())
+		Expect(rules.Message.MaxLength).To(Equal(10))
+		Expect(rules.Message.AllowLinks).To(BeFalse())
+
+		_, err = rules.Message.Clean(strings.Repeat("a", 11))
+		Expect(err).NotTo(BeNil())
+	})
+
+})
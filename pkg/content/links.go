@@ -0,0 +1,21 @@
+package content
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Links with a scheme or www, and bare domains under common top level domains
+var linkPattern = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp)://|www\.)[^\s<>"']+|\b(?:[a-z0-9](?:[a-z0-9-]*[a-z0-9])?\.)+(?:com|net|org|info|biz|io|co|me|app|dev|xyz|ly|gg|link|site|online|shop|ru|cn|tk)\b(?:/[^\s<>"']*)?`)
+
+// FindLinks returns the links in the text, without punctuation that ends the
+// sentence around them
+func FindLinks(text string) []string {
+	links := linkPattern.FindAllString(text, -1)
+
+	for i, link := range links {
+		links[i] = strings.TrimRight(link, ".,:;!?)]}")
+	}
+
+	return links
+}
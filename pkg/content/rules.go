@@ -0,0 +1,86 @@
+package content
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Rules are the policies for each kind of text users send
+type Rules struct {
+	Message            Policy
+	ListingTitle       Policy
+	ListingDescription Policy
+	GroupName          Policy
+}
+
+func DefaultRules() *Rules {
+	return &Rules{
+		Message:            Policy{MaxLength: 2000, Multiline: true, EscapeHTML: true, AllowLinks: true},
+		ListingTitle:       Policy{MaxLength: 100, EscapeHTML: true},
+		ListingDescription: Policy{MaxLength: 5000, Multiline: true, EscapeHTML: true, AllowLinks: true, Optional: true},
+		GroupName:          Policy{MaxLength: 64, EscapeHTML: true},
+	}
+}
+
+// NewRulesFromEnv builds the rules from the environment, anything unset
+// keeps the default
+func NewRulesFromEnv() (*Rules, error) {
+	rules := DefaultRules()
+
+	lengths := map[string]*int{
+		"MESSAGE_MAX_LENGTH":             &rules.Message.MaxLength,
+		"LISTING_TITLE_MAX_LENGTH":       &rules.ListingTitle.MaxLength,
+		"LISTING_DESCRIPTION_MAX_LENGTH": &rules.ListingDescription.MaxLength,
+	}
+
+	for name, length := range lengths {
+		if value := os.Getenv(name); value != "" {
+			parsed, err := strconv.Atoi(value)
+
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+
+			*length = parsed
+		}
+	}
+
+	if value := os.Getenv("MESSAGE_LINKS"); value != "" {
+		allow, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("MESSAGE_LINKS: %v", err)
+		}
+
+		rules.Message.AllowLinks = allow
+	}
+
+	if value := os.Getenv("CONTENT_ESCAPE_HTML"); value != "" {
+		escape, err := strconv.ParseBool(value)
+
+		if err != nil {
+			return nil, fmt.Errorf("CONTENT_ESCAPE_HTML: %v", err)
+		}
+
+		rules.Message.EscapeHTML = escape
+		rules.ListingTitle.EscapeHTML = escape
+		rules.ListingDescription.EscapeHTML = escape
+		rules.GroupName.EscapeHTML = escape
+	}
+
+	if path := os.Getenv("BANNED_WORDS_FILE"); path != "" {
+		banned, err := LoadBannedWords(path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		rules.Message.Banned = banned
+		rules.ListingTitle.Banned = banned
+		rules.ListingDescription.Banned = banned
+		rules.GroupName.Banned = banned
+	}
+
+	return rules, nil
+}
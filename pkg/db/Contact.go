@@ -3,4 +3,10 @@ package db
 type Contact struct {
 	Username  string
 	AvatarURL string
+
+	// Listing the conversation is about, nil when it is not about one
+	Listing *int64
+
+	// Title of the listing, empty once it is hidden
+	ListingTitle string
 }
@@ -0,0 +1,14 @@
+package db
+
+// ExternalIdentity is an account at an identity provider such as Google,
+// linked to a Person the first time it logs in
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+
+	Email         string
+	EmailVerified bool
+
+	// Username to create the account with, a suffix is added if it is taken
+	Username string
+}
@@ -0,0 +1,32 @@
+package db
+
+// Roles of a group member, admins add and remove members
+const (
+	GroupRoleAdmin  = "admin"
+	GroupRoleMember = "member"
+)
+
+// Group is a conversation between any number of users
+type Group struct {
+	ID        string
+	Name      string
+	CreatedAt int64
+
+	// Oldest member first, empty when listing groups
+	Members []GroupMember
+}
+
+type GroupMember struct {
+	Username  string
+	AvatarURL string
+	Role      string
+}
+
+type GroupMessage struct {
+	// ULID, sorts in the order the messages were sent
+	ID string
+
+	Sender   string
+	Contents string
+	Time     int64
+}
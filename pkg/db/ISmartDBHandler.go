@@ -1,21 +1,59 @@
 package db
 
 type ISmartDBReader interface {
-	GetMessages(recieverUsername, senderUsername *string, timeOfLastMessage *int64) ([]Messages, error)
+	GetMessages(recieverUsername, senderUsername *string, timeOfLastMessage *int64, listingID *int64) ([]Messages, error)
+	GetMessage(id *string) (Message, error)
 	GetListing(listingID *int64) (Listing, error)
 	CheckLogin(username, password *string) (string, error)
 	GetContacts(username *string) ([]Contact, error)
-	//GetProfile(profileUsername *string) (string, error)
+	GetUsername(email *string) (string, error)
+	IsVerified(username *string) (bool, error)
+	GetEmail(username *string) (string, error)
+	ResolveUsername(username *string) (string, error)
+	OwnsMedia(username *string, keys []string) (bool, error)
+	MediaUsage(username *string) (int64, error)
+	GetProfile(username *string) (Profile, error)
+	GetBlocked(username *string) ([]Contact, error)
+	IsBlocked(username, otherUsername *string) (bool, error)
+	GetReports(status string, limit int64) ([]Report, error)
+	GetReport(id *string) (Report, error)
+	IsModerator(username *string) (bool, error)
+	IsSuspended(username *string) (bool, error)
+	GetGroup(id *string) (Group, error)
+	GetGroups(username *string) ([]Group, error)
+	GetGroupMessages(id *string, timeOfLastMessage *int64) ([]GroupMessage, error)
 	//GetUnreadNotifications(profileID *string) (string, error)
 }
 
 type ISmartDBWriter interface {
 
 	// Writer Methods
-	CreateMessage(senderUsername, receiverUsername, message *string) error
+	CreateMessage(senderUsername, receiverUsername, message *string, listingID *int64) (string, error)
+	EditMessage(senderUsername, id *string, message *string) error
+	DeleteMessage(senderUsername, id *string) error
+	AddMessageIDs() (int64, error)
+	CreateGroup(creator, name *string, members []string) (string, error)
+	SetGroupMember(id, username *string, role string) error
+	RemoveGroupMember(id, username *string) error
+	CreateGroupMessage(senderUsername, id, message *string) (string, error)
 	UploadListing(username *string, listing *Listing) (int64, error)
 	BuyListing(buyerID *string, listingID *int64, amount *int64) error
 	CreateProfile(username, email, password *string) error
+	SetPassword(email, password *string) error
+	VerifyEmail(email *string) error
+	ChangeEmail(username, email *string) error
+	ChangeUsername(username, newUsername *string, changedBefore int64) error
+	DeleteUnverified(createdBefore int64) (int64, error)
+	LoginExternal(identity *ExternalIdentity) (string, bool, error)
+	UpdateProfile(username *string, update *ProfileUpdate) error
+	RateSeller(buyerUsername *string, listingID *int64, score int64) error
+	AddMedia(username *string, media *Media) error
+	RemoveMedia(key *string) error
+	BlockUser(username, blockedUsername *string) error
+	UnblockUser(username, blockedUsername *string) error
+	CreateReport(report *Report) error
+	ModerateReport(moderator, id *string, action *ModerationAction) error
+	SetModerators(usernames []string) error
 }
 
 type ISmartDBWriterReader interface {
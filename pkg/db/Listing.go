@@ -9,4 +9,10 @@ type Listing struct {
 	Sym        string // which token is being used
 	Active     bool
 	Owner      string
+
+	// Hidden by a moderator
+	Hidden bool
+
+	// Variant name to key for each of the images, in the same order
+	ImageVariants []map[string]string
 }
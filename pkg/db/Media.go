@@ -0,0 +1,22 @@
+package db
+
+// Media is an uploaded file, the object itself is in storage under Key
+type Media struct {
+	Key         string
+	ContentType string
+	Size        int64
+
+	// What it was uploaded for, "avatar" or "listing"
+	Purpose string
+
+	// Smaller copies of the image made when it was uploaded
+	Variants []MediaVariant
+}
+
+// MediaVariant is a copy of an image at another size, stored under Key
+type MediaVariant struct {
+	Name        string
+	Key         string
+	ContentType string
+	Size        int64
+}
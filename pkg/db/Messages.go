@@ -1,8 +1,29 @@
 package db
 
 type Messages struct {
+	// ULID, sorts in the order the messages were sent
+	ID string
+
 	Contents string
 	Time     int64
 	Read     int64
 	Sender   bool
+
+	// Unix time of the last edit, 0 if never edited
+	Edited int64
+
+	// Deleted messages are kept without their contents
+	Deleted bool
+}
+
+// Message is a single message between two users
+type Message struct {
+	ID       string
+	Sender   string
+	Receiver string
+	Time     int64
+	Deleted  bool
+
+	// Listing the message is about, nil when it is not about one
+	Listing *int64
 }
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// NeoAttemptStore stores failed logins as LoginAttempt nodes so that every
+// node sharing the database sees the same counts.
+type NeoAttemptStore struct {
+	Session neo4j.Session
+}
+
+func unixToTime(value interface{}) time.Time {
+	if unix, ok := value.(int64); ok && unix > 0 {
+		return time.Unix(unix, 0)
+	}
+
+	return time.Time{}
+}
+
+func (db NeoAttemptStore) Get(key string) (auth.AttemptRecord, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (a:LoginAttempt {key: $key})
+			RETURN a.failures, a.lastFailure, a.lockedUntil
+			`,
+			map[string]interface{}{
+				"key": key,
+			})
+
+		// Check that transaction worked
+		if err != nil {
+			return nil, err
+		}
+
+		// No attempts is not an error
+		if !result.Next() {
+			return auth.AttemptRecord{}, result.Err()
+		}
+
+		failures, _ := result.Record().Values[0].(int64)
+
+		return auth.AttemptRecord{
+			Failures:    failures,
+			LastFailure: unixToTime(result.Record().Values[1]),
+			LockedUntil: unixToTime(result.Record().Values[2]),
+		}, nil
+	})
+
+	if err != nil {
+		return auth.AttemptRecord{}, err
+	}
+
+	if record, ok := value.(auth.AttemptRecord); ok {
+		return record, nil
+	}
+
+	return auth.AttemptRecord{}, fmt.Errorf("cannot cast to AttemptRecord")
+}
+
+func (db NeoAttemptStore) Fail(key string, at time.Time) (auth.AttemptRecord, error) {
+
+	value, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		// An expired lockout starts a fresh count
+		result, err := transaction.Run(
+			`
+			MERGE (a:LoginAttempt {key: $key})
+			WITH a, (a.lockedUntil IS NOT NULL AND a.lockedUntil <= $time) AS expired
+			SET a.failures = CASE WHEN expired THEN 1 ELSE coalesce(a.failures, 0) + 1 END,
+				a.lockedUntil = CASE WHEN expired THEN null ELSE a.lockedUntil END,
+				a.lastFailure = $time
+			RETURN a.failures, a.lastFailure, a.lockedUntil
+			`,
+			map[string]interface{}{
+				"key":  key,
+				"time": at.Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, fmt.Errorf("unexpected error: neo4j login attempt could not be recorded")
+		}
+
+		failures, _ := result.Record().Values[0].(int64)
+
+		return auth.AttemptRecord{
+			Failures:    failures,
+			LastFailure: unixToTime(result.Record().Values[1]),
+			LockedUntil: unixToTime(result.Record().Values[2]),
+		}, nil
+	})
+
+	if err != nil {
+		return auth.AttemptRecord{}, err
+	}
+
+	if record, ok := value.(auth.AttemptRecord); ok {
+		return record, nil
+	}
+
+	return auth.AttemptRecord{}, fmt.Errorf("cannot cast to AttemptRecord")
+}
+
+func (db NeoAttemptStore) Lock(key string, until time.Time) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MERGE (a:LoginAttempt {key: $key})
+			SET a.lockedUntil = $until
+			`,
+			map[string]interface{}{
+				"key":   key,
+				"until": until.Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+func (db NeoAttemptStore) Reset(key string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (a:LoginAttempt {key: $key})
+			DELETE a
+			`,
+			map[string]interface{}{
+				"key": key,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
@@ -1,8 +1,10 @@
 package db
 
 import (
+	"crypto/rand"
 	"fmt"
 	cryptograph "go-websocket/pkg/Cryptograph"
+	"log"
 	"strings"
 	"time"
 
@@ -11,21 +13,66 @@ import (
 
 type NeoHandler struct {
 	Session neo4j.Session
+
+	// Hashes new passwords, cryptograph.DefaultHasher when nil
+	Hasher cryptograph.Hasher
+
+	// Avatar of accounts that have not set one
+	DefaultAvatarURL string
+}
+
+// Accounts used to be made with this in place of an avatar
+const legacyAvatar = "baseImageURL"
+
+// PendingEmailTTL is how long a changed email is held for the account, the
+// same as the verification email lasts. Older claims let anyone take it.
+const PendingEmailTTL = 48 * time.Hour
+
+// pendingAfter is the unix time pending emails have to be claimed after
+func pendingAfter() int64 {
+	return time.Now().Add(-PendingEmailTTL).Unix()
+}
+
+// sameListing is a Cypher condition for a message m being about $listing,
+// or about no listing when it is null
+const sameListing = `(m.listing = $listing OR ($listing IS NULL AND m.listing IS NULL))`
+
+// optionalID is the ID as a query parameter, null when it is nil
+func optionalID(id *int64) interface{} {
+	if id == nil {
+		return nil
+	}
+
+	return *id
+}
+
+// avatarOf is a Cypher expression for the avatar of the node it is formatted
+// with, it needs the $defaultAvatar and $legacyAvatar parameters
+const avatarOf = `CASE WHEN %[1]s.avatar IS NULL OR %[1]s.avatar = $legacyAvatar THEN $defaultAvatar ELSE %[1]s.avatar END`
+
+func (db NeoHandler) hasher() cryptograph.Hasher {
+	if db.Hasher == nil {
+		return cryptograph.DefaultHasher
+	}
+
+	return db.Hasher
 }
 
 func (db NeoHandler) CreateProfile(username, email, password *string) error {
 
 	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 
-		// Check if account exists for email submitted
+		// Check if account exists for email submitted, or is waiting to
+		// change to it
 		result, err := transaction.Run(
 			`
 			MATCH (n:Person)
-			WHERE n.email = $email 
+			WHERE n.email = $email OR (n.pendingEmail = $email AND n.pendingEmailAt > $pendingAfter)
 			RETURN COUNT(n)
 			`,
 			map[string]interface{}{
-				"email": *email,
+				"email":        *email,
+				"pendingAfter": pendingAfter(),
 			})
 
 		// Check that transaction worked
@@ -47,11 +94,12 @@ func (db NeoHandler) CreateProfile(username, email, password *string) error {
 			return nil, fmt.Errorf("email: cannot create account with that email")
 		}
 
-		// Check if account exists
+		// Check if account exists, old usernames stay taken so they keep
+		// pointing at the same person
 		result, err = transaction.Run(
 			`
 			MATCH (n:Person)
-			WHERE n.username = $username
+			WHERE n.username = $username OR $username IN coalesce(n.previousUsernames, [])
 			RETURN COUNT(n)
 			`,
 			map[string]interface{}{
@@ -78,9 +126,13 @@ func (db NeoHandler) CreateProfile(username, email, password *string) error {
 			return nil, fmt.Errorf("username: cannot create account that username")
 		}
 
-		// Create the account if no account exists
-		salt := cryptograph.GenerateRandomSalt(32)
-		passwordStr, saltStr := cryptograph.HashPassword(password, &salt)
+		// Create the account if no account exists, it is unverified until
+		// the email is confirmed
+		passwordStr, err := db.hasher().Hash(*password)
+
+		if err != nil {
+			return nil, err
+		}
 
 		result, err = transaction.Run(
 			`
@@ -89,17 +141,15 @@ func (db NeoHandler) CreateProfile(username, email, password *string) error {
 					username: $username, 
 					email: $email,
 					password: $password,
-					salt: $salt,
-					avatar: $avatar
+					verified: false,
+					createdAt: $currentTime
 				})
 			`,
 			map[string]interface{}{
 				"username":    *username,
 				"email":       *email,
 				"password":    passwordStr,
-				"salt":        saltStr,
 				"currentTime": time.Now().Unix(),
-				"avatar":      "baseImageURL",
 			})
 
 		if err != nil {
@@ -112,19 +162,27 @@ func (db NeoHandler) CreateProfile(username, email, password *string) error {
 	return err
 }
 
-func (db NeoHandler) CreateMessage(senderUsername, receiverUsername, message *string) error {
+// CreateMessage sends the message and returns its ID, the message is about
+// the listing when it is not nil
+func (db NeoHandler) CreateMessage(senderUsername, receiverUsername, message *string, listingID *int64) (string, error) {
+
+	now := time.Now()
+	id := newULID(now)
 
 	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 		result, err := transaction.Run(
 			`
 			MATCH (sender: Person {username: $usernameOne}), (reciever: Person {username: $usernameTwo})
-			CREATE (sender)-[r:Message {message: $message, time: $currentTime, timeOfRead: 0}]->(reciever)
+			CREATE (sender)-[r:Message {id: $id, message: $message, time: $currentTime, timeOfRead: 0, listing: $listing}]->(reciever)
+			RETURN r.id
 			`,
 			map[string]interface{}{
+				"id":          id,
+				"listing":     optionalID(listingID),
 				"message":     *message,
 				"usernameOne": *senderUsername,
 				"usernameTwo": *receiverUsername,
-				"currentTime": time.Now().Unix(),
+				"currentTime": now.Unix(),
 			})
 
 		if err != nil {
@@ -135,6 +193,138 @@ func (db NeoHandler) CreateMessage(senderUsername, receiverUsername, message *st
 			return result.Record().Values[0], nil
 		}
 
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		return nil, fmt.Errorf("username: no account with that username")
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetMessage returns who sent and received the message with the ID
+func (db NeoHandler) GetMessage(id *string) (Message, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (sender:Person)-[m:Message {id: $id}]->(receiver:Person)
+			RETURN sender.username, receiver.username, m.time, m.deletedAt IS NOT NULL, m.listing
+			`,
+			map[string]interface{}{
+				"id": *id,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("message not found: %s", *id)
+		}
+
+		record := result.Record()
+
+		message := Message{ID: *id}
+		message.Sender, _ = record.Values[0].(string)
+		message.Receiver, _ = record.Values[1].(string)
+		message.Time, _ = record.Values[2].(int64)
+		message.Deleted, _ = record.Values[3].(bool)
+
+		if listing, ok := record.Values[4].(int64); ok {
+			message.Listing = &listing
+		}
+
+		return message, nil
+	})
+
+	if err != nil {
+		return Message{}, err
+	}
+
+	return value.(Message), nil
+}
+
+// EditMessage replaces the text of a message the sender sent, the old text is
+// added to the history kept on the message
+func (db NeoHandler) EditMessage(senderUsername, id *string, message *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (:Person {username: $sender})-[m:Message {id: $id}]->(:Person)
+			WHERE m.deletedAt IS NULL
+			SET m.history = coalesce(m.history, []) + m.message,
+				m.historyTimes = coalesce(m.historyTimes, []) + coalesce(m.editedAt, m.time),
+				m.message = $message,
+				m.editedAt = $now
+			RETURN COUNT(m)
+			`,
+			map[string]interface{}{
+				"sender":  *senderUsername,
+				"id":      *id,
+				"message": *message,
+				"now":     time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("message not found: %s", *id)
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// DeleteMessage leaves a tombstone of a message the sender sent, its text
+// and history are removed
+func (db NeoHandler) DeleteMessage(senderUsername, id *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (:Person {username: $sender})-[m:Message {id: $id}]->(:Person)
+			WHERE m.deletedAt IS NULL
+			SET m.message = "", m.deletedAt = $now
+			REMOVE m.history, m.historyTimes
+			RETURN COUNT(m)
+			`,
+			map[string]interface{}{
+				"sender": *senderUsername,
+				"id":     *id,
+				"now":    time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("message not found: %s", *id)
+		}
+
 		return nil, result.Err()
 	})
 
@@ -310,7 +500,9 @@ func (db NeoHandler) BuyListing(buyerUsername *string, listingID *int64, amount
 }
 
 // Should not be able to call if the thread that calls is not the same as recieverUsername
-func (db NeoHandler) GetMessages(recieverUsername, senderUsername *string, timeOfLastMessage *int64) ([]Messages, error) {
+// GetMessages returns up to 10 messages between the users about the listing,
+// or not about any listing when it is nil
+func (db NeoHandler) GetMessages(recieverUsername, senderUsername *string, timeOfLastMessage *int64, listingID *int64) ([]Messages, error) {
 	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 		var result neo4j.Result
 		var err error
@@ -320,28 +512,31 @@ func (db NeoHandler) GetMessages(recieverUsername, senderUsername *string, timeO
 			result, err = transaction.Run(
 				`
 			MATCH (one: Person {username: $usernameOne})-[m:Message]-(two: Person {username: $usernameTwo})
-			WHERE m.time > $time
-			RETURN m.message, m.time, m.timeOfRead, (startNode(m) = one)
-			ORDER BY m.time
+			WHERE m.time > $time AND `+sameListing+`
+			RETURN m.message, m.time, m.timeOfRead, (startNode(m) = one), coalesce(m.editedAt, 0), m.deletedAt IS NOT NULL, coalesce(m.id, "")
+			ORDER BY m.time, m.id
 			LIMIT 10
 			`,
 				map[string]interface{}{
 					"usernameOne": *recieverUsername,
 					"usernameTwo": *senderUsername,
 					"time":        *timeOfLastMessage,
+					"listing":     optionalID(listingID),
 				})
 
 		} else {
 			result, err = transaction.Run(
 				`
 			MATCH (one: Person {username: $usernameOne})-[m:Message]-(two: Person {username: $usernameTwo})
-			RETURN m.message, m.time, m.timeOfRead, (startNode(m) = one)
-			ORDER BY m.time
+			WHERE `+sameListing+`
+			RETURN m.message, m.time, m.timeOfRead, (startNode(m) = one), coalesce(m.editedAt, 0), m.deletedAt IS NOT NULL, coalesce(m.id, "")
+			ORDER BY m.time, m.id
 			LIMIT 10
 			`,
 				map[string]interface{}{
 					"usernameOne": *recieverUsername,
 					"usernameTwo": *senderUsername,
+					"listing":     optionalID(listingID),
 				})
 		}
 
@@ -355,10 +550,13 @@ func (db NeoHandler) GetMessages(recieverUsername, senderUsername *string, timeO
 
 		for result.Next() {
 			messages = append(messages, Messages{
+				ID:       result.Record().Values[6].(string),
 				Contents: result.Record().Values[0].(string),
 				Time:     result.Record().Values[1].(int64),
 				Read:     result.Record().Values[2].(int64),
 				Sender:   result.Record().Values[3].(bool),
+				Edited:   result.Record().Values[4].(int64),
+				Deleted:  result.Record().Values[5].(bool),
 			})
 		}
 
@@ -388,7 +586,7 @@ func (db NeoHandler) GetListing(listingID *int64) (Listing, error) {
 			`
 			MATCH (p:Person)-[s:Selling]->(item: Listing)
 			WHERE id(item) = $listingID
-			RETURN item.title, item.description, item.images, item.price, item.sym, item.active, p.username
+			RETURN item.title, item.description, item.images, item.price, item.sym, item.active, p.username, coalesce(item.hidden, false)
 			`,
 			map[string]interface{}{
 				"listingID": *listingID,
@@ -416,6 +614,48 @@ func (db NeoHandler) GetListing(listingID *int64) (Listing, error) {
 			Sym:        result.Record().Values[4].(string),
 			Active:     result.Record().Values[5].(bool),
 			Owner:      result.Record().Values[6].(string),
+			Hidden:     result.Record().Values[7].(bool),
+		}
+
+		result, err = transaction.Run(
+			`
+			MATCH (m:Media)-[v:Variant]->(x:Media)
+			WHERE m.key IN $images
+			RETURN m.key, v.name, x.key
+			`,
+			map[string]interface{}{
+				"images": images,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		variants := map[string]map[string]string{}
+
+		for result.Next() {
+			key, _ := result.Record().Values[0].(string)
+			name, _ := result.Record().Values[1].(string)
+			variant, _ := result.Record().Values[2].(string)
+
+			if variants[key] == nil {
+				variants[key] = map[string]string{}
+			}
+
+			variants[key][name] = variant
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		// images uploaded before variants were made have none
+		if len(variants) > 0 {
+			listing.ImageVariants = make([]map[string]string, len(images))
+
+			for i, image := range images {
+				listing.ImageVariants[i] = variants[image]
+			}
 		}
 
 		return listing, nil
@@ -437,7 +677,7 @@ func (db NeoHandler) GetListing(listingID *int64) (Listing, error) {
 
 func (db NeoHandler) CheckLogin(email, password *string) (string, error) {
 
-	username, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 
 		// Get Salt and Password for someone with the same username
 		result, err := transaction.Run(
@@ -462,16 +702,102 @@ func (db NeoHandler) CheckLogin(email, password *string) (string, error) {
 		salt, _ := result.Record().Values[1].(string)
 		passwordDB, _ := result.Record().Values[2].(string)
 
-		match, err := cryptograph.ComparePassword(password, &passwordDB, &salt)
+		return []string{username, salt, passwordDB}, nil
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	stored := value.([]string)
+	username, salt, passwordDB := stored[0], stored[1], stored[2]
+
+	var match bool
+
+	// Accounts made before encoded hashes keep a separate salt
+	if salt != "" {
+		match, err = cryptograph.ComparePassword(password, &passwordDB, &salt)
+	} else {
+		match, err = cryptograph.Verify(*password, passwordDB)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	if !match {
+		return "", fmt.Errorf("password do not match")
+	}
+
+	// The password is only known now, so this is the chance to upgrade the hash
+	if salt != "" || db.hasher().NeedsRehash(passwordDB) {
+		if err := db.rehashPassword(email, &passwordDB, password); err != nil {
+			log.Printf("error: could not rehash password: %v", err)
+		}
+	}
+
+	return username, nil
+}
+
+// rehashPassword replaces the stored hash with one from the current hasher,
+// unless the password was changed since it was read
+func (db NeoHandler) rehashPassword(email, oldHash, password *string) error {
+
+	passwordStr, err := db.hasher().Hash(*password)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {email: $email})
+			WHERE n.password = $oldPassword
+			SET n.password = $password
+			REMOVE n.salt
+			`,
+			map[string]interface{}{
+				"email":       *email,
+				"oldPassword": *oldHash,
+				"password":    passwordStr,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// GetUsername returns the username of the account with the email
+func (db NeoHandler) GetUsername(email *string) (string, error) {
+
+	username, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {email: $email})
+			RETURN n.username
+			`,
+			map[string]interface{}{
+				"email": *email,
+			})
 
 		if err != nil {
 			return nil, err
 		}
 
-		if !match {
-			return nil, fmt.Errorf("password do not match")
+		if !result.Next() {
+			return nil, fmt.Errorf("email: no account with that email")
 		}
 
+		username, _ := result.Record().Values[0].(string)
+
 		return username, nil
 	})
 
@@ -482,48 +808,1913 @@ func (db NeoHandler) CheckLogin(email, password *string) (string, error) {
 	return username.(string), err
 }
 
-func (db NeoHandler) GetContacts(username *string) ([]Contact, error) {
+// SetPassword replaces the password of the account with the email
+func (db NeoHandler) SetPassword(email, password *string) error {
 
-	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+	passwordStr, err := db.hasher().Hash(*password)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
 
-		// Get Salt and Password for someone with the same username
 		result, err := transaction.Run(
 			`
-			MATCH (n:Person {username: $username})-[:Message]-(m: Person)
-			RETURN distinct m.username, m.avatar
+			MATCH (n:Person {email: $email})
+			SET n.password = $password
+			REMOVE n.salt
+			RETURN COUNT(n)
 			`,
 			map[string]interface{}{
-				"username": *username,
+				"email":    *email,
+				"password": passwordStr,
 			})
 
-		// Check that transaction worked
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 
-		//Get all the messages you have access to
-		contacts := []Contact{}
+		if !result.Next() {
+			return nil, result.Err()
+		}
 
-		for result.Next() {
-			contacts = append(contacts, Contact{
-				Username:  result.Record().Values[0].(string),
-				AvatarURL: result.Record().Values[1].(string),
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("email: no account with that email")
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// IsVerified reports if the email of the account has been confirmed, accounts
+// from before verification count as verified
+func (db NeoHandler) IsVerified(username *string) (bool, error) {
+
+	verified, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			RETURN coalesce(n.verified, true)
+			`,
+			map[string]interface{}{
+				"username": *username,
 			})
 
+		if err != nil {
+			return nil, err
 		}
 
-		return contacts, nil
+		if !result.Next() {
+			return nil, fmt.Errorf("username: no account with that username")
+		}
+
+		verified, _ := result.Record().Values[0].(bool)
+
+		return verified, nil
 	})
 
-	// Fails if it does not work
-	if err != nil {
-		return []Contact{}, err
+	if verified == nil {
+		return false, err
 	}
 
-	if contacts, ok := value.([]Contact); ok {
-		return contacts, nil
-	}
+	return verified.(bool), err
+}
 
-	return []Contact{}, fmt.Errorf("could not cast to []Contact")
+// VerifyEmail marks the email of the account as confirmed, an email the
+// account is changing to replaces the current one
+func (db NeoHandler) VerifyEmail(email *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person)
+			WHERE n.email = $email OR (n.pendingEmail = $email AND n.pendingEmailAt > $pendingAfter)
+			SET n.verified = true,
+				n.email = $email,
+				n.pendingEmailAt = CASE WHEN n.pendingEmail = $email THEN null ELSE n.pendingEmailAt END,
+				n.pendingEmail = CASE WHEN n.pendingEmail = $email THEN null ELSE n.pendingEmail END
+			RETURN COUNT(n)
+			`,
+			map[string]interface{}{
+				"email":        *email,
+				"pendingAfter": pendingAfter(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("email: no account with that email")
+		}
+
+		// the email belongs to this account now, stale claims on it by
+		// other accounts are dropped
+		result, err = transaction.Run(
+			`
+			MATCH (n:Person {pendingEmail: $email})
+			REMOVE n.pendingEmail, n.pendingEmailAt
+			`,
+			map[string]interface{}{
+				"email": *email,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// DeleteUnverified removes accounts created before the unix time that never
+// confirmed their email, returning how many were removed
+func (db NeoHandler) DeleteUnverified(createdBefore int64) (int64, error) {
+
+	count, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		// Refresh tokens go too, so they cannot sign in to a new account
+		// that takes the same username, and so do linked identities
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person)
+			WHERE n.verified = false AND n.createdAt < $createdBefore
+			WITH n, n.username AS username
+			OPTIONAL MATCH (t:RefreshToken {username: username})
+			OPTIONAL MATCH (i:ExternalIdentity)-[:IDENTIFIES]->(n)
+			DETACH DELETE t, i, n
+			RETURN COUNT(DISTINCT username)
+			`,
+			map[string]interface{}{
+				"createdBefore": createdBefore,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return int64(0), result.Err()
+		}
+
+		count, _ := result.Record().Values[0].(int64)
+
+		return count, nil
+	})
+
+	if count == nil {
+		return 0, err
+	}
+
+	return count.(int64), err
+}
+
+// GetEmail returns the email of the account with the username
+func (db NeoHandler) GetEmail(username *string) (string, error) {
+
+	email, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			RETURN n.email
+			`,
+			map[string]interface{}{
+				"username": *username,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, fmt.Errorf("username: no account with that username")
+		}
+
+		email, _ := result.Record().Values[0].(string)
+
+		return email, nil
+	})
+
+	if email == nil {
+		return "", err
+	}
+
+	return email.(string), err
+}
+
+// ResolveUsername returns the current username of whoever has or had the
+// username, so old usernames keep working
+func (db NeoHandler) ResolveUsername(username *string) (string, error) {
+
+	current, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person)
+			WHERE n.username = $username OR $username IN coalesce(n.previousUsernames, [])
+			RETURN n.username, n.username = $username AS exact
+			ORDER BY exact DESC
+			LIMIT 1
+			`,
+			map[string]interface{}{
+				"username": *username,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, fmt.Errorf("username: no account with that username")
+		}
+
+		current, _ := result.Record().Values[0].(string)
+
+		return current, nil
+	})
+
+	if current == nil {
+		return "", err
+	}
+
+	return current.(string), err
+}
+
+// ChangeEmail starts moving the account to a new email. The account keeps its
+// current email until the new one is verified with VerifyEmail, and the new
+// one is held for it for PendingEmailTTL.
+func (db NeoHandler) ChangeEmail(username, email *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person)
+			WHERE n.email = $email OR (n.pendingEmail = $email AND n.pendingEmailAt > $pendingAfter AND n.username <> $username)
+			RETURN COUNT(n)
+			`,
+			map[string]interface{}{
+				"username":     *username,
+				"email":        *email,
+				"pendingAfter": pendingAfter(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, fmt.Errorf("unexpected: neo4j account could not be counted")
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count != 0 {
+			return nil, fmt.Errorf("email: cannot change to that email")
+		}
+
+		result, err = transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			SET n.pendingEmail = $email, n.pendingEmailAt = $now
+			RETURN COUNT(n)
+			`,
+			map[string]interface{}{
+				"username": *username,
+				"email":    *email,
+				"now":      time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("username: no account with that username")
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// ChangeUsername renames the account, unless it was last renamed at or after
+// the unix time changedBefore. The old username is kept so it still resolves.
+func (db NeoHandler) ChangeUsername(username, newUsername *string, changedBefore int64) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		// Lock the account first so two renames cannot both pass the cooldown
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			SET n.locked = true
+			RETURN coalesce(n.usernameChangedAt, 0)
+			`,
+			map[string]interface{}{
+				"username": *username,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, fmt.Errorf("username: no account with that username")
+		}
+
+		if changedAt, _ := result.Record().Values[0].(int64); changedAt >= changedBefore {
+			return nil, fmt.Errorf("cooldown: username was changed too recently")
+		}
+
+		// Only the account itself may go back to one of its old usernames
+		result, err = transaction.Run(
+			`
+			MATCH (n:Person)
+			WHERE n.username <> $username
+				AND (n.username = $newUsername OR $newUsername IN coalesce(n.previousUsernames, []))
+			RETURN COUNT(n)
+			`,
+			map[string]interface{}{
+				"username":    *username,
+				"newUsername": *newUsername,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, fmt.Errorf("unexpected: neo4j account could not be counted")
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count != 0 {
+			return nil, fmt.Errorf("username: cannot change to that username")
+		}
+
+		// Refresh tokens follow the account so other devices stay signed in
+		result, err = transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			SET n.previousUsernames = [name IN coalesce(n.previousUsernames, []) WHERE name <> $newUsername] + $username,
+				n.username = $newUsername,
+				n.usernameChangedAt = $currentTime
+			REMOVE n.locked
+			WITH n
+			OPTIONAL MATCH (t:RefreshToken {username: $username})
+			SET t.username = $newUsername
+			`,
+			map[string]interface{}{
+				"username":    *username,
+				"newUsername": *newUsername,
+				"currentTime": time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+func (db NeoHandler) GetContacts(username *string) ([]Contact, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		// Get Salt and Password for someone with the same username
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})-[message:Message]-(m: Person)
+			WHERE NOT (n)-[:BLOCKED]-(m)
+			WITH DISTINCT m, message.listing AS listing
+			OPTIONAL MATCH (item:Listing)
+			WHERE id(item) = listing
+			RETURN m.username, `+fmt.Sprintf(avatarOf, "m")+`, listing,
+				CASE WHEN coalesce(item.hidden, false) = false THEN item.title END
+			ORDER BY m.username, listing IS NOT NULL, listing
+			`,
+			map[string]interface{}{
+				"username":      *username,
+				"defaultAvatar": db.DefaultAvatarURL,
+				"legacyAvatar":  legacyAvatar,
+			})
+
+		// Check that transaction worked
+		if err != nil {
+			return false, err
+		}
+
+		//Get all the messages you have access to
+		contacts := []Contact{}
+
+		for result.Next() {
+			contact := Contact{
+				Username:  result.Record().Values[0].(string),
+				AvatarURL: result.Record().Values[1].(string),
+			}
+
+			if listing, ok := result.Record().Values[2].(int64); ok {
+				contact.Listing = &listing
+				contact.ListingTitle, _ = result.Record().Values[3].(string)
+			}
+
+			contacts = append(contacts, contact)
+		}
+
+		return contacts, nil
+	})
+
+	// Fails if it does not work
+	if err != nil {
+		return []Contact{}, err
+	}
+
+	if contacts, ok := value.([]Contact); ok {
+		return contacts, nil
+	}
+
+	return []Contact{}, fmt.Errorf("could not cast to []Contact")
+
+}
+
+// LoginExternal returns the username linked to the identity, and whether the
+// account was made for it. An identity seen for the first time is linked to
+// the account with the same email, or a new account without a password is
+// made for it.
+func (db NeoHandler) LoginExternal(identity *ExternalIdentity) (string, bool, error) {
+
+	created := false
+
+	username, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		created = false
+
+		result, err := transaction.Run(
+			`
+			MATCH (:ExternalIdentity {provider: $provider, subject: $subject})-[:IDENTIFIES]->(n:Person)
+			RETURN n.username
+			`,
+			map[string]interface{}{
+				"provider": identity.Provider,
+				"subject":  identity.Subject,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Next() {
+			return result.Record().Values[0], nil
+		}
+
+		result, err = transaction.Run(
+			`
+			MATCH (n:Person {email: $email})
+			RETURN n.username, coalesce(n.verified, true)
+			`,
+			map[string]interface{}{
+				"email": identity.Email,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if result.Next() {
+
+			// Both sides have to have proven the email, or anyone could sign
+			// up at a provider with someone else's email and take the account
+			verified, _ := result.Record().Values[1].(bool)
+
+			if !identity.EmailVerified || !verified {
+				return nil, fmt.Errorf("email: cannot link the account with that email")
+			}
+
+			username := result.Record().Values[0]
+
+			return username, db.linkIdentity(transaction, identity, username)
+		}
+
+		username, err := db.freeUsername(transaction, identity.Username)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result, err = transaction.Run(
+			`
+			CREATE (n:Person 
+				{
+					username: $username, 
+					email: $email,
+					verified: $verified,
+					createdAt: $currentTime
+				})
+			`,
+			map[string]interface{}{
+				"username":    username,
+				"email":       identity.Email,
+				"verified":    identity.EmailVerified,
+				"currentTime": time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		created = true
+
+		return username, db.linkIdentity(transaction, identity, username)
+	})
+
+	if err != nil {
+		return "", false, err
+	}
+
+	if username, ok := username.(string); ok {
+		return username, created, nil
+	}
+
+	return "", false, fmt.Errorf("cannot cast to username")
+}
+
+func (db NeoHandler) linkIdentity(transaction neo4j.Transaction, identity *ExternalIdentity, username interface{}) error {
+
+	result, err := transaction.Run(
+		`
+		MATCH (n:Person {username: $username})
+		CREATE (:ExternalIdentity {provider: $provider, subject: $subject, createdAt: $currentTime})-[:IDENTIFIES]->(n)
+		`,
+		map[string]interface{}{
+			"username":    username,
+			"provider":    identity.Provider,
+			"subject":     identity.Subject,
+			"currentTime": time.Now().Unix(),
+		})
+
+	if err != nil {
+		return err
+	}
+
+	return result.Err()
+}
+
+// freeUsername returns the username, or it with a random suffix if someone
+// has or had it
+func (db NeoHandler) freeUsername(transaction neo4j.Transaction, username string) (string, error) {
+
+	candidate := username
+
+	for i := 0; i < 5; i++ {
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person)
+			WHERE n.username = $username OR $username IN coalesce(n.previousUsernames, [])
+			RETURN COUNT(n)
+			`,
+			map[string]interface{}{
+				"username": candidate,
+			})
+
+		if err != nil {
+			return "", err
+		}
+
+		if !result.Next() {
+			return "", fmt.Errorf("unexpected: neo4j account could not be counted")
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return candidate, nil
+		}
+
+		suffix := make([]byte, 2)
+
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+
+		candidate = fmt.Sprintf("%s-%x", username, suffix)
+	}
+
+	return "", fmt.Errorf("username: could not find a free username")
+}
+
+// RateSeller records the score the buyer gives the seller of a listing they
+// bought, rating the same listing again replaces the score
+func (db NeoHandler) RateSeller(buyerUsername *string, listingID *int64, score int64) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (buyer:Person {username: $buyer})-[:brought]->(l:Listing)<-[:Selling]-(seller:Person)
+			WHERE id(l) = $listing
+			MERGE (buyer)-[r:Rated {listing: $listing}]->(seller)
+			SET r.score = $score, r.time = $now
+			RETURN COUNT(r)
+			`,
+			map[string]interface{}{
+				"buyer":   *buyerUsername,
+				"listing": *listingID,
+				"score":   score,
+				"now":     time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("rating: only the buyer of a listing can rate its seller")
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// GetProfile returns the profile of the user, private fields included
+func (db NeoHandler) GetProfile(username *string) (Profile, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			OPTIONAL MATCH (n)-[:Selling]->(l:Listing {active: true})
+			WITH n, COUNT(l) AS listings
+			OPTIONAL MATCH (:Person)-[r:Rated]->(n)
+			RETURN n.username, coalesce(n.displayName, ""), coalesce(n.bio, ""), coalesce(n.location, ""),
+				`+fmt.Sprintf(avatarOf, "n")+`,
+				listings, coalesce(n.createdAt, 0), coalesce(avg(r.score), 0.0), COUNT(r),
+				coalesce(n.privateFields, [])
+			`,
+			map[string]interface{}{
+				"username":      *username,
+				"defaultAvatar": db.DefaultAvatarURL,
+				"legacyAvatar":  legacyAvatar,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("profile not found: no account with that username")
+		}
+
+		values := result.Record().Values
+
+		profile := Profile{}
+		profile.Username, _ = values[0].(string)
+		profile.DisplayName, _ = values[1].(string)
+		profile.Bio, _ = values[2].(string)
+		profile.Location, _ = values[3].(string)
+		profile.AvatarURL, _ = values[4].(string)
+		profile.ListingCount, _ = values[5].(int64)
+		profile.JoinedAt, _ = values[6].(int64)
+		profile.Rating, _ = values[7].(float64)
+		profile.RatingCount, _ = values[8].(int64)
+
+		private, _ := values[9].([]interface{})
+
+		for _, field := range private {
+			if name, ok := field.(string); ok {
+				profile.Private = append(profile.Private, name)
+			}
+		}
+
+		return profile, nil
+	})
+
+	if err != nil {
+		return Profile{}, err
+	}
+
+	if profile, ok := value.(Profile); ok {
+		return profile, nil
+	}
+
+	return Profile{}, fmt.Errorf("cannot cast to profile")
+}
+
+// UpdateProfile sets the fields of the update that are not nil
+func (db NeoHandler) UpdateProfile(username *string, update *ProfileUpdate) error {
+
+	// Setting a property to null removes it, so empty fields go back to
+	// their defaults
+	fields := map[string]interface{}{}
+
+	set := func(name string, value *string) {
+		if value == nil {
+			return
+		}
+
+		if *value == "" {
+			fields[name] = nil
+		} else {
+			fields[name] = *value
+		}
+	}
+
+	set("displayName", update.DisplayName)
+	set("bio", update.Bio)
+	set("location", update.Location)
+	set("avatar", update.AvatarURL)
+
+	if update.Private != nil {
+		fields["privateFields"] = *update.Private
+	}
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			SET n += $fields
+			RETURN COUNT(n)
+			`,
+			map[string]interface{}{
+				"username": *username,
+				"fields":   fields,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("profile not found: no account with that username")
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// AddMedia records that the user uploaded the media
+func (db NeoHandler) AddMedia(username *string, media *Media) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			CREATE (n)-[:Uploaded]->(:Media {key: $key, contentType: $contentType, size: $size, purpose: $purpose, createdAt: $currentTime})
+			RETURN COUNT(n)
+			`,
+			map[string]interface{}{
+				"username":    *username,
+				"key":         media.Key,
+				"contentType": media.ContentType,
+				"size":        media.Size,
+				"purpose":     media.Purpose,
+				"currentTime": time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("account does not exist")
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		for _, variant := range media.Variants {
+			result, err = transaction.Run(
+				`
+				MATCH (m:Media {key: $key})
+				CREATE (m)-[:Variant {name: $name}]->(:Media {key: $variantKey, contentType: $contentType, size: $size, purpose: $purpose, createdAt: $currentTime})
+				`,
+				map[string]interface{}{
+					"key":         media.Key,
+					"name":        variant.Name,
+					"variantKey":  variant.Key,
+					"contentType": variant.ContentType,
+					"size":        variant.Size,
+					"purpose":     media.Purpose,
+					"currentTime": time.Now().Unix(),
+				})
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+		}
+
+		return nil, nil
+	})
+
+	return err
+}
+
+// OwnsMedia is true if the user uploaded every one of the keys
+func (db NeoHandler) OwnsMedia(username *string, keys []string) (bool, error) {
+
+	owns, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (:Person {username: $username})-[:Uploaded]->(m:Media)
+			WHERE m.key IN $keys
+			RETURN COUNT(DISTINCT m.key)
+			`,
+			map[string]interface{}{
+				"username": *username,
+				"keys":     keys,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return false, result.Err()
+		}
+
+		// keys may repeat, the same image can be shown twice
+		unique := map[string]bool{}
+
+		for _, key := range keys {
+			unique[key] = true
+		}
+
+		count, _ := result.Record().Values[0].(int64)
+
+		return count == int64(len(unique)), nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return owns.(bool), nil
+}
+
+// MediaUsage returns how many bytes of media the user has uploaded,
+// variants included
+func (db NeoHandler) MediaUsage(username *string) (int64, error) {
+
+	usage, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			OPTIONAL MATCH (:Person {username: $username})-[:Uploaded]->(:Media)-[:Variant*0..1]->(m:Media)
+			RETURN coalesce(sum(m.size), 0)
+			`,
+			map[string]interface{}{
+				"username": *username,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return int64(0), result.Err()
+		}
+
+		usage, _ := result.Record().Values[0].(int64)
+
+		return usage, nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+
+	return usage.(int64), nil
+}
+
+// RemoveMedia forgets the media and its variants once their objects are
+// deleted
+func (db NeoHandler) RemoveMedia(key *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (m:Media {key: $key})
+			OPTIONAL MATCH (m)-[:Variant]->(v:Media)
+			DETACH DELETE m, v
+			`,
+			map[string]interface{}{
+				"key": *key,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// BlockUser records that the user blocked the other user, blocking twice
+// keeps the first time
+func (db NeoHandler) BlockUser(username, blockedUsername *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username}), (m:Person {username: $blockedUsername})
+			MERGE (n)-[b:BLOCKED]->(m)
+			ON CREATE SET b.createdAt = $currentTime
+			RETURN COUNT(m)
+			`,
+			map[string]interface{}{
+				"username":        *username,
+				"blockedUsername": *blockedUsername,
+				"currentTime":     time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("profile not found: no user with that username")
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// UnblockUser removes the block, if there is one
+func (db NeoHandler) UnblockUser(username, blockedUsername *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (:Person {username: $username})-[b:BLOCKED]->(:Person {username: $blockedUsername})
+			DELETE b
+			`,
+			map[string]interface{}{
+				"username":        *username,
+				"blockedUsername": *blockedUsername,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// GetBlocked returns the users the user has blocked
+func (db NeoHandler) GetBlocked(username *string) ([]Contact, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (:Person {username: $username})-[:BLOCKED]->(m:Person)
+			RETURN m.username, `+fmt.Sprintf(avatarOf, "m")+`
+			ORDER BY m.username
+			`,
+			map[string]interface{}{
+				"username":      *username,
+				"defaultAvatar": db.DefaultAvatarURL,
+				"legacyAvatar":  legacyAvatar,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		blocked := []Contact{}
+
+		for result.Next() {
+			blocked = append(blocked, Contact{
+				Username:  result.Record().Values[0].(string),
+				AvatarURL: result.Record().Values[1].(string),
+			})
+		}
+
+		return blocked, result.Err()
+	})
+
+	if err != nil {
+		return []Contact{}, err
+	}
+
+	if blocked, ok := value.([]Contact); ok {
+		return blocked, nil
+	}
+
+	return []Contact{}, fmt.Errorf("could not cast to []Contact")
+}
+
+// IsBlocked is true if either of the users has blocked the other
+func (db NeoHandler) IsBlocked(username, otherUsername *string) (bool, error) {
+
+	blocked, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username}), (m:Person {username: $otherUsername})
+			RETURN EXISTS ((n)-[:BLOCKED]-(m))
+			`,
+			map[string]interface{}{
+				"username":      *username,
+				"otherUsername": *otherUsername,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return false, result.Err()
+		}
+
+		blocked, _ := result.Record().Values[0].(bool)
+
+		return blocked, nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return blocked.(bool), nil
+}
+
+// reportFields are the columns a report is read from, it needs the report
+// as rep and the reporter as reporter
+const reportFields = `rep.id, reporter.username, rep.type, coalesce(rep.listing, 0),
+	[(rep)-[:About]->(t) | CASE WHEN t:Listing THEN [(s:Person)-[:Selling]->(t) | s.username][0] ELSE t.username END][0],
+	coalesce(rep.messageId, ""), rep.content, rep.reason, rep.details, rep.status, rep.createdAt`
+
+func reportFrom(record *neo4j.Record) Report {
+	report := Report{}
+
+	report.ID, _ = record.Values[0].(string)
+	report.Reporter, _ = record.Values[1].(string)
+	report.Type, _ = record.Values[2].(string)
+	report.Listing, _ = record.Values[3].(int64)
+	report.Username, _ = record.Values[4].(string)
+	report.MessageID, _ = record.Values[5].(string)
+	report.Content, _ = record.Values[6].(string)
+	report.Reason, _ = record.Values[7].(string)
+	report.Details, _ = record.Values[8].(string)
+	report.Status, _ = record.Values[9].(string)
+	report.CreatedAt, _ = record.Values[10].(int64)
+
+	return report
+}
+
+// CreateReport files the report from its reporter, filling in its ID, the
+// user it is about and a copy of what was reported
+func (db NeoHandler) CreateReport(report *Report) error {
+
+	id := make([]byte, 16)
+
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	report.ID = fmt.Sprintf("%x", id)
+	report.Status = ReportOpen
+	report.CreatedAt = time.Now().Unix()
+
+	var target string
+
+	// the target is matched as t, and the content copied from c
+	switch report.Type {
+
+	case ReportListing:
+		target = `
+			MATCH (t:Listing)
+			WHERE id(t) = $listing AND NOT (reporter)-[:Selling]->(t)
+			WITH reporter, t, t.title AS c`
+
+	case ReportUser:
+		target = `
+			MATCH (t:Person {username: $username})
+			WHERE t <> reporter
+			WITH reporter, t, '' AS c`
+
+	// a direct message sent to the reporter, or one posted to their group
+	case ReportMessage:
+		target = `
+			OPTIONAL MATCH (sender:Person)-[m:Message {id: $messageID}]->(reporter)
+			WHERE m.deletedAt IS NULL
+			OPTIONAL MATCH (poster:Person)-[p:Posted {id: $messageID}]->(:Conversation)<-[:MemberOf]-(reporter)
+			WHERE poster <> reporter
+			WITH reporter, coalesce(sender, poster) AS t, coalesce(m.message, p.message) AS c
+			WHERE t IS NOT NULL`
+
+	default:
+		return fmt.Errorf("report: cannot report a %q", report.Type)
+
+	}
+
+	value, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (reporter:Person {username: $reporter})
+			`+target+`
+			CREATE (reporter)-[:Filed]->(rep:Report {
+				id: $id,
+				type: $type,
+				listing: $listing,
+				messageId: $messageID,
+				content: c,
+				reason: $reason,
+				details: $details,
+				status: $status,
+				createdAt: $currentTime
+			})-[:About]->(t)
+			RETURN `+reportFields,
+			map[string]interface{}{
+				"reporter":    report.Reporter,
+				"id":          report.ID,
+				"type":        report.Type,
+				"listing":     report.Listing,
+				"username":    report.Username,
+				"messageID":   report.MessageID,
+				"reason":      report.Reason,
+				"details":     report.Details,
+				"status":      report.Status,
+				"currentTime": report.CreatedAt,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("report: nothing to report with those details")
+		}
+
+		return reportFrom(result.Record()), nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	*report = value.(Report)
+
+	return nil
+}
+
+// GetReports returns reports with the status oldest first, or every report
+// when status is ""
+func (db NeoHandler) GetReports(status string, limit int64) ([]Report, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (reporter:Person)-[:Filed]->(rep:Report)
+			WHERE $status = '' OR rep.status = $status
+			RETURN `+reportFields+`
+			ORDER BY rep.createdAt
+			LIMIT $limit
+			`,
+			map[string]interface{}{
+				"status": status,
+				"limit":  limit,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		reports := []Report{}
+
+		for result.Next() {
+			reports = append(reports, reportFrom(result.Record()))
+		}
+
+		return reports, result.Err()
+	})
+
+	if err != nil {
+		return []Report{}, err
+	}
+
+	if reports, ok := value.([]Report); ok {
+		return reports, nil
+	}
+
+	return []Report{}, fmt.Errorf("could not cast to []Report")
+}
+
+// GetReport returns the report with what moderators did about it
+func (db NeoHandler) GetReport(id *string) (Report, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (reporter:Person)-[:Filed]->(rep:Report {id: $id})
+			RETURN `+reportFields,
+			map[string]interface{}{
+				"id": *id,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("report not found: no report with that id")
+		}
+
+		report := reportFrom(result.Record())
+		report.Actions = []ModerationAction{}
+
+		result, err = transaction.Run(
+			`
+			MATCH (moderator:Person)-[:Took]->(a:ModerationAction)-[:On]->(:Report {id: $id})
+			RETURN moderator.username, a.action, a.note, a.createdAt
+			ORDER BY a.createdAt
+			`,
+			map[string]interface{}{
+				"id": *id,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		for result.Next() {
+			action := ModerationAction{}
+
+			action.Moderator, _ = result.Record().Values[0].(string)
+			action.Action, _ = result.Record().Values[1].(string)
+			action.Note, _ = result.Record().Values[2].(string)
+			action.CreatedAt, _ = result.Record().Values[3].(int64)
+
+			report.Actions = append(report.Actions, action)
+		}
+
+		return report, result.Err()
+	})
+
+	if err != nil {
+		return Report{}, err
+	}
+
+	return value.(Report), nil
+}
+
+// ModerateReport carries out the action on what the report is about and
+// records that the moderator took it
+func (db NeoHandler) ModerateReport(moderator, id *string, action *ModerationAction) error {
+
+	var apply string
+	status := ReportActioned
+
+	switch action.Action {
+
+	case ActionHideListing:
+		apply = `
+			MATCH (:Report {id: $id})-[:About]->(l:Listing)
+			SET l.hidden = true
+			RETURN COUNT(l)`
+
+	case ActionSuspendUser:
+		apply = `
+			MATCH (:Report {id: $id})-[:About]->(t)
+			MATCH (u:Person)
+			WHERE u = t OR (u)-[:Selling]->(t)
+			SET u.suspended = true
+			RETURN COUNT(u)`
+
+	case ActionDeleteMessage:
+		apply = `
+			MATCH (reporter:Person)-[:Filed]->(rep:Report {id: $id})-[:About]->(sender:Person)
+			OPTIONAL MATCH (sender)-[m:Message]->(reporter)
+			WHERE m.id = rep.messageId
+			OPTIONAL MATCH (sender)-[p:Posted]->(:Conversation)
+			WHERE p.id = rep.messageId
+			DELETE m, p
+			RETURN COUNT(m) + COUNT(p)`
+
+	case ActionDismiss:
+		status = ReportDismissed
+
+	default:
+		return fmt.Errorf("report: %q is not an action", action.Action)
+
+	}
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (moderator:Person {username: $moderator}), (rep:Report {id: $id})
+			CREATE (moderator)-[:Took]->(:ModerationAction {action: $action, note: $note, createdAt: $currentTime})-[:On]->(rep)
+			SET rep.status = $status
+			RETURN COUNT(rep)
+			`,
+			map[string]interface{}{
+				"moderator":   *moderator,
+				"id":          *id,
+				"action":      action.Action,
+				"note":        action.Note,
+				"status":      status,
+				"currentTime": time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("report not found: no report with that id")
+		}
+
+		if apply == "" {
+			return nil, result.Err()
+		}
+
+		result, err = transaction.Run(apply, map[string]interface{}{
+			"id": *id,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		// a message that is already deleted is not an error, the action
+		// is still recorded
+		if count, _ := result.Record().Values[0].(int64); count == 0 && action.Action != ActionDeleteMessage {
+			return nil, fmt.Errorf("report: %s does not apply to this report", action.Action)
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// IsModerator is true if the user can see reports and act on them
+func (db NeoHandler) IsModerator(username *string) (bool, error) {
+	return db.personFlag(username, "moderator")
+}
+
+// IsSuspended is true if a moderator suspended the user
+func (db NeoHandler) IsSuspended(username *string) (bool, error) {
+	return db.personFlag(username, "suspended")
+}
+
+// personFlag reads a boolean property of the user, false when it is not set
+func (db NeoHandler) personFlag(username *string, flag string) (bool, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			RETURN coalesce(n[$flag], false)
+			`,
+			map[string]interface{}{
+				"username": *username,
+				"flag":     flag,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return false, result.Err()
+		}
+
+		value, _ := result.Record().Values[0].(bool)
+
+		return value, nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	return value.(bool), nil
+}
+
+// SetModerators makes exactly the users moderators, anyone else stops
+// being one
+func (db NeoHandler) SetModerators(usernames []string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person)
+			WHERE n.moderator = true OR n.username IN $usernames
+			SET n.moderator = n.username IN $usernames
+			`,
+			map[string]interface{}{
+				"usernames": usernames,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// AddMessageIDs gives an ID to the messages sent before messages had them,
+// and moves reports of those messages over to the ID. It returns how many
+// messages were given one.
+func (db NeoHandler) AddMessageIDs() (int64, error) {
+
+	var added int64
+
+	for {
+		value, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+			result, err := transaction.Run(
+				`
+				MATCH ()-[m:Message]->()
+				WHERE m.id IS NULL
+				RETURN id(m), m.time
+				ORDER BY m.time
+				LIMIT 1000
+				`,
+				map[string]interface{}{})
+
+			if err != nil {
+				return nil, err
+			}
+
+			ids := []map[string]interface{}{}
+
+			for result.Next() {
+				sentAt, _ := result.Record().Values[1].(int64)
+
+				ids = append(ids, map[string]interface{}{
+					"message": result.Record().Values[0],
+					"id":      newULID(time.Unix(sentAt, 0)),
+				})
+			}
+
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			result, err = transaction.Run(
+				`
+				UNWIND $ids AS row
+				MATCH ()-[m:Message]->()
+				WHERE id(m) = row.message
+				SET m.id = row.id
+				`,
+				map[string]interface{}{
+					"ids": ids,
+				})
+
+			if err != nil {
+				return nil, err
+			}
+
+			return int64(len(ids)), result.Err()
+		})
+
+		if err != nil {
+			return added, err
+		}
+
+		count := value.(int64)
+		added += count
+
+		if count == 0 {
+			break
+		}
+	}
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (reporter:Person)-[:Filed]->(rep:Report {type: $type})-[:About]->(:Person)-[m:Message]->(reporter)
+			WHERE rep.messageId IS NULL AND m.time = rep.messageTime
+			WITH rep, min(m.id) AS id
+			SET rep.messageId = id
+			REMOVE rep.messageTime
+			`,
+			map[string]interface{}{
+				"type": ReportMessage,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return added, err
+}
+
+// CreateGroup makes a group with the creator as its admin and the members,
+// and returns its ID
+func (db NeoHandler) CreateGroup(creator, name *string, members []string) (string, error) {
+
+	now := time.Now()
+	id := newULID(now)
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (creator:Person {username: $creator})
+			CREATE (creator)-[:MemberOf {role: $admin, joinedAt: $joined}]->(c:Conversation {id: $id, name: $name, createdAt: $now})
+			WITH c
+			UNWIND $members AS username
+			MATCH (p:Person {username: username})
+			MERGE (p)-[r:MemberOf]->(c)
+			ON CREATE SET r.role = $member, r.joinedAt = $joined
+			RETURN COUNT(p)
+			`,
+			map[string]interface{}{
+				"creator": *creator,
+				"id":      id,
+				"name":    *name,
+				"members": members,
+				"admin":   GroupRoleAdmin,
+				"member":  GroupRoleMember,
+				"now":     now.Unix(),
+				"joined":  now.UnixNano() / int64(time.Millisecond),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count != int64(len(members)) {
+			return nil, fmt.Errorf("group: a member does not exist")
+		}
+
+		return nil, result.Err()
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// GetGroup returns the group with its members
+func (db NeoHandler) GetGroup(id *string) (Group, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (m:Person)-[r:MemberOf]->(c:Conversation {id: $id})
+			RETURN c.name, c.createdAt, m.username, `+fmt.Sprintf(avatarOf, "m")+`, r.role
+			ORDER BY r.joinedAt, m.username
+			`,
+			map[string]interface{}{
+				"id":            *id,
+				"defaultAvatar": db.DefaultAvatarURL,
+				"legacyAvatar":  legacyAvatar,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		group := Group{ID: *id, Members: []GroupMember{}}
+
+		for result.Next() {
+			record := result.Record()
+
+			group.Name, _ = record.Values[0].(string)
+			group.CreatedAt, _ = record.Values[1].(int64)
+
+			member := GroupMember{}
+			member.Username, _ = record.Values[2].(string)
+			member.AvatarURL, _ = record.Values[3].(string)
+			member.Role, _ = record.Values[4].(string)
+
+			group.Members = append(group.Members, member)
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		// groups are removed with their last member
+		if len(group.Members) == 0 {
+			return nil, fmt.Errorf("group not found: %s", *id)
+		}
+
+		return group, nil
+	})
+
+	if err != nil {
+		return Group{}, err
+	}
+
+	return value.(Group), nil
+}
+
+// GetGroups returns the groups the user is a member of without their
+// members, newest first
+func (db NeoHandler) GetGroups(username *string) ([]Group, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (:Person {username: $username})-[:MemberOf]->(c:Conversation)
+			RETURN c.id, c.name, c.createdAt
+			ORDER BY c.createdAt DESC, c.id DESC
+			`,
+			map[string]interface{}{
+				"username": *username,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		groups := []Group{}
+
+		for result.Next() {
+			group := Group{}
+			group.ID, _ = result.Record().Values[0].(string)
+			group.Name, _ = result.Record().Values[1].(string)
+			group.CreatedAt, _ = result.Record().Values[2].(int64)
+
+			groups = append(groups, group)
+		}
+
+		return groups, result.Err()
+	})
+
+	if err != nil {
+		return []Group{}, err
+	}
+
+	return value.([]Group), nil
+}
+
+// SetGroupMember adds the user to the group with the role, or changes their
+// role if they are already a member
+func (db NeoHandler) SetGroupMember(id, username *string, role string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (c:Conversation {id: $id}), (p:Person {username: $username})
+			MERGE (p)-[r:MemberOf]->(c)
+			ON CREATE SET r.joinedAt = $joined
+			SET r.role = $role
+			RETURN COUNT(r)
+			`,
+			map[string]interface{}{
+				"id":       *id,
+				"username": *username,
+				"role":     role,
+				"joined":   time.Now().UnixNano() / int64(time.Millisecond),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		if count, _ := result.Record().Values[0].(int64); count == 0 {
+			return nil, fmt.Errorf("group: %s does not exist", *username)
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// RemoveGroupMember takes the user out of the group. The oldest member
+// becomes admin when the last admin leaves, and the group is deleted with
+// its messages when the last member leaves.
+func (db NeoHandler) RemoveGroupMember(id, username *string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (:Person {username: $username})-[r:MemberOf]->(c:Conversation {id: $id})
+			DELETE r
+			WITH c
+			OPTIONAL MATCH (m:Person)-[left:MemberOf]->(c)
+			WITH c, left, m
+			ORDER BY left.joinedAt, m.username
+			WITH c, collect(left) AS members
+			FOREACH (oldest IN CASE WHEN size(members) > 0 AND none(m IN members WHERE m.role = $admin) THEN [members[0]] ELSE [] END |
+				SET oldest.role = $admin)
+			FOREACH (empty IN CASE WHEN size(members) = 0 THEN [c] ELSE [] END |
+				DETACH DELETE empty)
+			RETURN size(members)
+			`,
+			map[string]interface{}{
+				"id":       *id,
+				"username": *username,
+				"admin":    GroupRoleAdmin,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("group not found: %s is not a member", *username)
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// CreateGroupMessage sends the message to the group and returns its ID
+func (db NeoHandler) CreateGroupMessage(senderUsername, id, message *string) (string, error) {
+
+	now := time.Now()
+	messageID := newULID(now)
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (sender:Person {username: $sender})-[:MemberOf]->(c:Conversation {id: $id})
+			CREATE (sender)-[m:Posted {id: $messageID, message: $message, time: $now}]->(c)
+			RETURN COUNT(m)
+			`,
+			map[string]interface{}{
+				"sender":    *senderUsername,
+				"id":        *id,
+				"messageID": messageID,
+				"message":   *message,
+				"now":       now.Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			return nil, fmt.Errorf("group not found: %s is not a member", *senderUsername)
+		}
+
+		return nil, result.Err()
+	})
+
+	if err != nil {
+		return "", err
+	}
+
+	return messageID, nil
+}
+
+// GetGroupMessages returns up to 10 messages of the group sent after the
+// time, oldest first
+func (db NeoHandler) GetGroupMessages(id *string, timeOfLastMessage *int64) ([]GroupMessage, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+
+		result, err := transaction.Run(
+			`
+			MATCH (sender:Person)-[m:Posted]->(:Conversation {id: $id})
+			WHERE m.time > $time
+			RETURN m.id, sender.username, m.message, m.time
+			ORDER BY m.time, m.id
+			LIMIT 10
+			`,
+			map[string]interface{}{
+				"id":   *id,
+				"time": *timeOfLastMessage,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		messages := []GroupMessage{}
+
+		for result.Next() {
+			message := GroupMessage{}
+			message.ID, _ = result.Record().Values[0].(string)
+			message.Sender, _ = result.Record().Values[1].(string)
+			message.Contents, _ = result.Record().Values[2].(string)
+			message.Time, _ = result.Record().Values[3].(int64)
+
+			messages = append(messages, message)
+		}
+
+		return messages, result.Err()
+	})
+
+	if err != nil {
+		return []GroupMessage{}, err
+	}
 
+	return value.([]GroupMessage), nil
 }
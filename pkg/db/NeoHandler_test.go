@@ -218,6 +218,270 @@ var _ = Describe("NeoDB", func() {
 		Expect(username).To(Equal(""), "Username should be empty")
 	})
 
+	It("Verification: accounts are unverified until the email is confirmed", func() {
+		username := "some-user"
+		email := "some-user@example.com"
+		initialPassword := "some-password"
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+
+		verified, err := smartDB.IsVerified(&username)
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+		Expect(verified).To(BeFalse(), "New accounts should be unverified")
+
+		err = smartDB.VerifyEmail(&email)
+		Expect(err).To(BeNil(), "Should be able to verify the email")
+
+		verified, _ = smartDB.IsVerified(&username)
+		Expect(verified).To(BeTrue(), "The account should be verified")
+
+		unknown := "nobody@example.com"
+		err = smartDB.VerifyEmail(&unknown)
+		Expect(err).NotTo(BeNil(), "There is no account to verify")
+	})
+
+	It("Verification: only old unverified accounts are removed", func() {
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		initialPassword := "some-password"
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+
+		err := smartDB.VerifyEmail(&email)
+		Expect(err).To(BeNil(), "Should be able to verify the email")
+
+		removed, err := smartDB.DeleteUnverified(time.Now().Add(-time.Hour).Unix())
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+		Expect(removed).To(BeZero(), "New accounts should have time to verify")
+
+		removed, err = smartDB.DeleteUnverified(time.Now().Add(time.Minute).Unix())
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+		Expect(removed).To(Equal(int64(1)), "Only the unverified account should be removed")
+
+		_, err = smartDB.GetUsername(&emailTwo)
+		Expect(err).NotTo(BeNil(), "The unverified account should be gone")
+
+		_, err = smartDB.GetUsername(&email)
+		Expect(err).To(BeNil(), "The verified account should be kept")
+	})
+
+	It("Verification: removing an unverified external account removes its identity", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		identity := ExternalIdentity{
+			Provider: "example",
+			Subject:  "some-subject",
+			Email:    "some-user@example.com",
+			Username: "some-user",
+		}
+
+		username, created, err := smartDB.LoginExternal(&identity)
+		Expect(err).To(BeNil())
+		Expect(created).To(BeTrue(), "The first login makes the account")
+
+		verified, _ := smartDB.IsVerified(&username)
+		Expect(verified).To(BeFalse(), "The provider did not verify the email")
+
+		_, created, _ = smartDB.LoginExternal(&identity)
+		Expect(created).To(BeFalse(), "Later logins use the same account")
+
+		removed, err := smartDB.DeleteUnverified(time.Now().Add(time.Minute).Unix())
+		Expect(err).To(BeNil())
+		Expect(removed).To(Equal(int64(1)))
+
+		result, err := session.Run(`MATCH (i:ExternalIdentity) RETURN COUNT(i)`, map[string]interface{}{})
+		Expect(err).To(BeNil())
+		Expect(result.Next()).To(BeTrue())
+		Expect(result.Record().Values[0]).To(Equal(int64(0)), "The identity should not be left behind")
+	})
+
+	It("Account: a changed email only replaces the old one once verified", func() {
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		initialPassword := "some-password"
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+		_ = smartDB.VerifyEmail(&email)
+		_ = smartDB.VerifyEmail(&emailTwo)
+
+		err := smartDB.ChangeEmail(&username, &emailTwo)
+		Expect(err).NotTo(BeNil(), "Another account has that email")
+
+		newEmail := "new@example.com"
+		err = smartDB.ChangeEmail(&username, &newEmail)
+		Expect(err).To(BeNil(), "Should be able to change to a free email")
+
+		usernameThree := "another"
+		err = smartDB.CreateProfile(&usernameThree, &newEmail, &initialPassword)
+		Expect(err).NotTo(BeNil(), "The email is waiting to be verified by another account")
+
+		current, _ := smartDB.GetEmail(&username)
+		Expect(current).To(Equal(email), "The old email is kept until the new one is verified")
+
+		verified, _ := smartDB.IsVerified(&username)
+		Expect(verified).To(BeTrue(), "The account stays verified")
+
+		removed, _ := smartDB.DeleteUnverified(time.Now().Add(time.Minute).Unix())
+		Expect(removed).To(BeZero(), "Changing the email should not get the account removed")
+
+		err = smartDB.VerifyEmail(&newEmail)
+		Expect(err).To(BeNil(), "Should be able to verify the new email")
+
+		current, _ = smartDB.GetEmail(&username)
+		Expect(current).To(Equal(newEmail), "The new email replaces the old one")
+
+		_, err = smartDB.CheckLogin(&newEmail, &initialPassword)
+		Expect(err).To(BeNil(), "Should log in with the new email")
+	})
+
+	It("Account: a changed email is only held until the verification expires", func() {
+		username := "some"
+		email := "some@example.com"
+		initialPassword := "some-password"
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = smartDB.VerifyEmail(&email)
+
+		// someone else's address, they never confirm the change
+		claimed := "owner@example.com"
+		Expect(smartDB.ChangeEmail(&username, &claimed)).To(BeNil())
+
+		_, err := session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+			return transaction.Run(
+				`
+				MATCH (n:Person {username: $username})
+				SET n.pendingEmailAt = $claimedAt
+				`,
+				map[string]interface{}{
+					"username":  username,
+					"claimedAt": time.Now().Add(-PendingEmailTTL - time.Minute).Unix(),
+				})
+		})
+		Expect(err).To(BeNil())
+
+		owner := "owner"
+		err = smartDB.CreateProfile(&owner, &claimed, &initialPassword)
+		Expect(err).To(BeNil(), "The owner can register once the claim is stale")
+
+		Expect(smartDB.VerifyEmail(&claimed)).To(BeNil())
+
+		current, _ := smartDB.GetEmail(&username)
+		Expect(current).To(Equal(email), "The stale claim should not take the email")
+
+		current, _ = smartDB.GetEmail(&owner)
+		Expect(current).To(Equal(claimed))
+
+		Expect(smartDB.ChangeEmail(&username, &claimed)).NotTo(BeNil(), "The email is in use now")
+
+		other := "other@example.com"
+		Expect(smartDB.ChangeEmail(&username, &other)).To(BeNil(), "The stale claim should be gone")
+	})
+
+	It("Account: renames are unique, wait for the cooldown and keep the old username", func() {
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		initialPassword := "some-password"
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+
+		now := time.Now().Unix()
+
+		err := smartDB.ChangeUsername(&username, &usernameTwo, now)
+		Expect(err).NotTo(BeNil(), "Another account has that username")
+
+		newUsername := "renamed"
+		err = smartDB.ChangeUsername(&username, &newUsername, now)
+		Expect(err).To(BeNil(), "Should be able to rename")
+
+		current, err := smartDB.ResolveUsername(&username)
+		Expect(err).To(BeNil(), "The old username should still resolve")
+		Expect(current).To(Equal(newUsername))
+
+		again := "renamed-again"
+		err = smartDB.ChangeUsername(&newUsername, &again, now-1)
+		Expect(err).NotTo(BeNil(), "Renamed too recently")
+
+		err = smartDB.ChangeUsername(&usernameTwo, &username, now)
+		Expect(err).NotTo(BeNil(), "Old usernames stay with their account")
+
+		err = smartDB.ChangeUsername(&newUsername, &username, time.Now().Add(time.Minute).Unix())
+		Expect(err).To(BeNil(), "An account can go back to its old username")
+	})
+
+	It("Account: a new password replaces the old one", func() {
+		username := "some"
+		email := "some@example.com"
+		initialPassword := "some-password"
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+
+		newPassword := "a-new-password"
+		err := smartDB.SetPassword(&email, &newPassword)
+		Expect(err).To(BeNil(), "Should be able to set the password")
+
+		_, err = smartDB.CheckLogin(&email, &initialPassword)
+		Expect(err).NotTo(BeNil(), "The old password should not work")
+
+		_, err = smartDB.CheckLogin(&email, &newPassword)
+		Expect(err).To(BeNil(), "The new password should work")
+	})
+
 	It("Upload Listing: Registered Account", func() {
 		session := driver.NewSession(neo4j.SessionConfig{})
 		smartDB = NeoHandler{
@@ -317,9 +581,16 @@ var _ = Describe("NeoDB", func() {
 
 		message := "The test message"
 
-		err = smartDB.CreateMessage(&username, &usernameTwo, &message)
+		id, err := smartDB.CreateMessage(&username, &usernameTwo, &message, nil)
 
 		Expect(err).To(BeNil(), "Message should be able to be uploaded")
+		Expect(id).To(HaveLen(26), "Message should have a ULID")
+
+		nobody := "nobody"
+		id, err = smartDB.CreateMessage(&username, &nobody, &message, nil)
+
+		Expect(err).NotTo(BeNil(), "There is no one to send the message to")
+		Expect(id).To(BeEmpty(), "No ID for a message that was not stored")
 	})
 
 	It("Messages: can get messages", func() {
@@ -350,14 +621,14 @@ var _ = Describe("NeoDB", func() {
 
 		message := "The test message"
 
-		err = smartDB.CreateMessage(&username, &usernameTwo, &message)
+		_, err = smartDB.CreateMessage(&username, &usernameTwo, &message, nil)
 
 		if err != nil {
 			Panic().NegatedFailureMessage("This should not have happened (check previous tests)")
 		}
 
 		var time int64 = 0
-		messages, err := smartDB.GetMessages(&usernameTwo, &username, &time)
+		messages, err := smartDB.GetMessages(&usernameTwo, &username, &time, nil)
 
 		Expect(err).To(BeNil(), "Message should be able to be uploaded")
 		Expect(len(messages)).To(Equal(1), "Message should get a single message")
@@ -394,7 +665,7 @@ var _ = Describe("NeoDB", func() {
 
 		message := "Message One"
 
-		err = smartDB.CreateMessage(&username, &usernameTwo, &message)
+		_, err = smartDB.CreateMessage(&username, &usernameTwo, &message, nil)
 
 		if err != nil {
 			Panic().NegatedFailureMessage("This should not have happened (check previous tests)")
@@ -404,14 +675,14 @@ var _ = Describe("NeoDB", func() {
 		time.Sleep(time.Second)
 
 		message = "Message Two"
-		err = smartDB.CreateMessage(&username, &usernameTwo, &message)
+		_, err = smartDB.CreateMessage(&username, &usernameTwo, &message, nil)
 
 		if err != nil {
 			Panic().NegatedFailureMessage("This should not have happened (check previous tests)")
 		}
 
 		var timeOfLastMessage int64 = 0
-		messages, err := smartDB.GetMessages(&usernameTwo, &username, &timeOfLastMessage)
+		messages, err := smartDB.GetMessages(&usernameTwo, &username, &timeOfLastMessage, nil)
 
 		Expect(err).To(BeNil(), "Message should be able to be uploaded")
 		Expect(len(messages)).To(Equal(2), "Should have two messages in the chat log")
@@ -420,7 +691,7 @@ var _ = Describe("NeoDB", func() {
 			Panic().NegatedFailureMessage("This should not have happened (check previous tests)")
 		}
 
-		messages, err = smartDB.GetMessages(&usernameTwo, &username, &messages[0].Time)
+		messages, err = smartDB.GetMessages(&usernameTwo, &username, &messages[0].Time, nil)
 
 		Expect(err).To(BeNil(), "Message should be able to be uploaded")
 		Expect(len(messages)).To(Equal(1), "Message should get a single message")
@@ -429,6 +700,249 @@ var _ = Describe("NeoDB", func() {
 
 	})
 
+	It("Messages: senders can edit and delete their messages", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+
+		message := "Teh message"
+		id, err := smartDB.CreateMessage(&username, &usernameTwo, &message, nil)
+
+		if err != nil {
+			Panic().NegatedFailureMessage("This should not have happened (check previous tests)")
+		}
+
+		var after int64 = 0
+
+		edited := "The message"
+		err = smartDB.EditMessage(&usernameTwo, &id, &edited)
+		Expect(err).NotTo(BeNil(), "Only the sender should be able to edit")
+
+		err = smartDB.EditMessage(&username, &id, &edited)
+		Expect(err).To(BeNil(), "Sender should be able to edit")
+
+		messages, _ := smartDB.GetMessages(&usernameTwo, &username, &after, nil)
+		Expect(messages[0].ID).To(Equal(id))
+		Expect(messages[0].Contents).To(Equal("The message"))
+		Expect(messages[0].Edited).NotTo(BeZero(), "Message should be marked as edited")
+
+		err = smartDB.DeleteMessage(&username, &id)
+		Expect(err).To(BeNil(), "Sender should be able to delete")
+
+		messages, _ = smartDB.GetMessages(&usernameTwo, &username, &after, nil)
+		Expect(messages).To(HaveLen(1), "Deleted messages should be kept as a tombstone")
+		Expect(messages[0].Deleted).To(BeTrue())
+		Expect(messages[0].Contents).To(Equal(""), "Deleted messages should have no contents")
+
+		err = smartDB.EditMessage(&username, &id, &edited)
+		Expect(err).NotTo(BeNil(), "Deleted messages should not be edited")
+	})
+
+	It("Messages: messages in the same second have their own IDs", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+
+		first := "First"
+		second := "Second"
+		firstID, _ := smartDB.CreateMessage(&username, &usernameTwo, &first, nil)
+		secondID, _ := smartDB.CreateMessage(&username, &usernameTwo, &second, nil)
+
+		Expect(firstID < secondID).To(BeTrue(), "IDs should sort in the order messages were sent")
+
+		messages, _ := smartDB.GetMessages(&usernameTwo, &username, new(int64), nil)
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].ID).To(Equal(firstID))
+		Expect(messages[1].ID).To(Equal(secondID))
+
+		found, err := smartDB.GetMessage(&secondID)
+		Expect(err).To(BeNil())
+		Expect(found.Sender).To(Equal(username))
+		Expect(found.Receiver).To(Equal(usernameTwo))
+	})
+
+	It("Messages: messages from before IDs are given one", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+
+		_, err := session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+			return transaction.Run(
+				`
+				MATCH (one:Person {username: $usernameOne}), (two:Person {username: $usernameTwo})
+				CREATE (one)-[:Message {message: "Old message", time: 1600000000, timeOfRead: 0}]->(two)
+				`,
+				map[string]interface{}{
+					"usernameOne": username,
+					"usernameTwo": usernameTwo,
+				})
+		})
+		Expect(err).To(BeNil())
+
+		added, err := smartDB.AddMessageIDs()
+		Expect(err).To(BeNil(), "Should be able to add IDs")
+		Expect(added).To(Equal(int64(1)))
+
+		messages, _ := smartDB.GetMessages(&usernameTwo, &username, new(int64), nil)
+		Expect(messages[0].ID).To(HaveLen(26), "Old messages should have a ULID")
+
+		added, _ = smartDB.AddMessageIDs()
+		Expect(added).To(BeZero(), "Messages should only be given an ID once")
+	})
+
+	It("Messages: messages about a listing are kept apart", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+
+		listing := Listing{
+			Title:      "Example Listing",
+			Decription: "This is a description of a listing",
+			Price:      12,
+			Sym:        "ETH",
+		}
+
+		listingID, _ := smartDB.UploadListing(&username, &listing)
+
+		general := "Hello"
+		about := "Is this still for sale?"
+
+		_, _ = smartDB.CreateMessage(&usernameTwo, &username, &general, nil)
+		id, err := smartDB.CreateMessage(&usernameTwo, &username, &about, &listingID)
+		Expect(err).To(BeNil(), "Should be able to send a message about a listing")
+
+		messages, _ := smartDB.GetMessages(&username, &usernameTwo, new(int64), &listingID)
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].Contents).To(Equal(about))
+
+		messages, _ = smartDB.GetMessages(&username, &usernameTwo, new(int64), nil)
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].Contents).To(Equal(general))
+
+		found, _ := smartDB.GetMessage(&id)
+		Expect(found.Listing).To(Equal(&listingID))
+
+		contacts, _ := smartDB.GetContacts(&username)
+		Expect(contacts).To(HaveLen(2), "Each listing should be its own conversation")
+		Expect(contacts[0].Listing).To(BeNil())
+		Expect(contacts[1].Listing).To(Equal(&listingID))
+		Expect(contacts[1].ListingTitle).To(Equal(listing.Title))
+	})
+
+	It("Groups: members can talk and the group outlives its admin", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameTwo := "some-user"
+		emailTwo := "some-user@example.com"
+		usernameThree := "another"
+		emailThree := "another@example.com"
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameTwo, &emailTwo, &initialPassword)
+		_ = registerUser(smartDB, &usernameThree, &emailThree, &initialPassword)
+
+		name := "Bikes"
+
+		_, err := smartDB.CreateGroup(&username, &name, []string{usernameTwo, "nobody"})
+		Expect(err).NotTo(BeNil(), "Should not make a group with unknown members")
+
+		id, err := smartDB.CreateGroup(&username, &name, []string{usernameTwo})
+		Expect(err).To(BeNil(), "Should be able to make a group")
+
+		group, err := smartDB.GetGroup(&id)
+		Expect(err).To(BeNil())
+		Expect(group.Name).To(Equal(name))
+		Expect(group.Members).To(HaveLen(2))
+		Expect(group.Members[0].Username).To(Equal(username))
+		Expect(group.Members[0].Role).To(Equal(GroupRoleAdmin), "Creator should be the admin")
+
+		err = smartDB.SetGroupMember(&id, &usernameThree, GroupRoleMember)
+		Expect(err).To(BeNil(), "Should be able to add a member")
+
+		message := "Hello everyone"
+		_, err = smartDB.CreateGroupMessage(&usernameThree, &id, &message)
+		Expect(err).To(BeNil(), "Members should be able to send messages")
+
+		messages, _ := smartDB.GetGroupMessages(&id, new(int64))
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0].Sender).To(Equal(usernameThree))
+
+		groups, _ := smartDB.GetGroups(&usernameTwo)
+		Expect(groups).To(HaveLen(1))
+
+		err = smartDB.RemoveGroupMember(&id, &username)
+		Expect(err).To(BeNil(), "Admin should be able to leave")
+
+		_, err = smartDB.CreateGroupMessage(&username, &id, &message)
+		Expect(err).NotTo(BeNil(), "Former members should not send messages")
+
+		group, _ = smartDB.GetGroup(&id)
+		Expect(group.Members[0].Username).To(Equal(usernameTwo))
+		Expect(group.Members[0].Role).To(Equal(GroupRoleAdmin), "Oldest member should become admin")
+
+		_ = smartDB.RemoveGroupMember(&id, &usernameTwo)
+		_ = smartDB.RemoveGroupMember(&id, &usernameThree)
+
+		_, err = smartDB.GetGroup(&id)
+		Expect(err).NotTo(BeNil(), "Group should be removed with its last member")
+	})
+
 	It("Brought Item: Item Exists and Owned by someone else ", func() {
 
 		session := driver.NewSession(neo4j.SessionConfig{})
@@ -586,7 +1100,7 @@ var _ = Describe("NeoDB", func() {
 		Expect(err).To(BeNil(), "Should be able to get contacts")
 		Expect(len(contacts)).To(Equal(0), "Should be no contacts")
 
-		err = smartDB.CreateMessage(&username, &usernameAnother, &message)
+		_, err = smartDB.CreateMessage(&username, &usernameAnother, &message, nil)
 		Expect(err).To(BeNil(), "Should send a message")
 
 		contacts, err = smartDB.GetContacts(&username)
@@ -596,6 +1110,328 @@ var _ = Describe("NeoDB", func() {
 
 	})
 
+	It("Blocking: blocked users are listed and hidden from contacts", func() {
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameAnother := "another"
+		emailAnother := "another@example.com"
+
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameAnother, &emailAnother, &initialPassword)
+
+		message := "This is an example"
+		_, _ = smartDB.CreateMessage(&username, &usernameAnother, &message, nil)
+
+		err := smartDB.BlockUser(&usernameAnother, &username)
+		Expect(err).To(BeNil(), "Should be able to block")
+
+		err = smartDB.BlockUser(&usernameAnother, &username)
+		Expect(err).To(BeNil(), "Blocking twice should not be an error")
+
+		blocked, err := smartDB.GetBlocked(&usernameAnother)
+		Expect(err).To(BeNil())
+		Expect(blocked).To(HaveLen(1))
+		Expect(blocked[0].Username).To(Equal(username))
+
+		isBlocked, _ := smartDB.IsBlocked(&username, &usernameAnother)
+		Expect(isBlocked).To(BeTrue(), "Blocks should count both ways")
+
+		contacts, _ := smartDB.GetContacts(&username)
+		Expect(contacts).To(BeEmpty(), "Blocked users should not be contacts")
+
+		err = smartDB.UnblockUser(&usernameAnother, &username)
+		Expect(err).To(BeNil(), "Should be able to unblock")
+
+		isBlocked, _ = smartDB.IsBlocked(&username, &usernameAnother)
+		Expect(isBlocked).To(BeFalse())
+
+		contacts, _ = smartDB.GetContacts(&username)
+		Expect(contacts).To(HaveLen(1), "Unblocked users should be contacts again")
+
+		nobody := "nobody"
+		err = smartDB.BlockUser(&username, &nobody)
+		Expect(err).NotTo(BeNil(), "Should not block unknown users")
+	})
+
+	It("Reports: can be filed, listed and acted on", func() {
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameAnother := "another"
+		emailAnother := "another@example.com"
+		moderator := "moderator"
+		emailModerator := "moderator@example.com"
+
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameAnother, &emailAnother, &initialPassword)
+		_ = registerUser(smartDB, &moderator, &emailModerator, &initialPassword)
+
+		Expect(smartDB.SetModerators([]string{moderator})).To(BeNil())
+
+		isModerator, _ := smartDB.IsModerator(&moderator)
+		Expect(isModerator).To(BeTrue())
+
+		listing := Listing{
+			Title:      "Too good to be true",
+			Decription: "Send the money first",
+			Images:     []string{},
+			Price:      12,
+			Sym:        "ETH",
+		}
+
+		id, _ := smartDB.UploadListing(&usernameAnother, &listing)
+
+		report := Report{Reporter: username, Type: ReportListing, Listing: id, Reason: "scam"}
+		err := smartDB.CreateReport(&report)
+		Expect(err).To(BeNil(), "Should be able to report a listing")
+		Expect(report.ID).NotTo(BeEmpty())
+		Expect(report.Username).To(Equal(usernameAnother), "Should be about the seller")
+		Expect(report.Content).To(Equal(listing.Title), "Should keep a copy of the title")
+
+		message := "Pay me outside the site"
+		messageID, _ := smartDB.CreateMessage(&usernameAnother, &username, &message, nil)
+
+		messageReport := Report{Reporter: username, Type: ReportMessage, MessageID: messageID, Reason: "scam"}
+		Expect(smartDB.CreateReport(&messageReport)).To(BeNil(), "Should be able to report a message")
+		Expect(messageReport.Content).To(Equal(message))
+		Expect(messageReport.Username).To(Equal(usernameAnother), "Should be about the sender")
+
+		wrong := Report{Reporter: username, Type: ReportMessage, MessageID: "01ARYZ6S410000000000000000", Reason: "scam"}
+		Expect(smartDB.CreateReport(&wrong)).NotTo(BeNil(), "Should not report a message that was not sent")
+
+		question := "Is this still for sale?"
+		_, err = smartDB.CreateMessage(&username, &usernameAnother, &question, &id)
+		Expect(err).To(BeNil(), "Should be able to ask about the listing")
+
+		reports, err := smartDB.GetReports(ReportOpen, 10)
+		Expect(err).To(BeNil())
+		Expect(reports).To(HaveLen(2))
+
+		err = smartDB.ModerateReport(&moderator, &report.ID, &ModerationAction{Action: ActionHideListing, Note: "Scam"})
+		Expect(err).To(BeNil(), "Should be able to hide the listing")
+
+		found, _ := smartDB.GetListing(&id)
+		Expect(found.Hidden).To(BeTrue())
+
+		contacts, _ := smartDB.GetContacts(&username)
+		Expect(contacts).To(HaveLen(2))
+
+		for _, contact := range contacts {
+			if contact.Listing != nil {
+				Expect(contact.ListingTitle).To(BeEmpty(), "Should not show the title of a hidden listing")
+			}
+		}
+
+		err = smartDB.ModerateReport(&moderator, &messageReport.ID, &ModerationAction{Action: ActionDeleteMessage})
+		Expect(err).To(BeNil(), "Should be able to delete the message")
+
+		err = smartDB.ModerateReport(&moderator, &messageReport.ID, &ModerationAction{Action: ActionSuspendUser})
+		Expect(err).To(BeNil(), "Should be able to suspend the sender")
+
+		messages, _ := smartDB.GetMessages(&username, &usernameAnother, new(int64), nil)
+		Expect(messages).To(BeEmpty())
+
+		suspended, _ := smartDB.IsSuspended(&usernameAnother)
+		Expect(suspended).To(BeTrue())
+
+		details, err := smartDB.GetReport(&messageReport.ID)
+		Expect(err).To(BeNil())
+		Expect(details.Status).To(Equal(ReportActioned))
+		Expect(details.Content).To(Equal(message), "The copy should outlive the message")
+		Expect(details.Actions).To(HaveLen(2))
+		Expect(details.Actions[0].Moderator).To(Equal(moderator))
+
+		reports, _ = smartDB.GetReports(ReportOpen, 10)
+		Expect(reports).To(BeEmpty())
+
+		Expect(smartDB.SetModerators([]string{})).To(BeNil())
+
+		isModerator, _ = smartDB.IsModerator(&moderator)
+		Expect(isModerator).To(BeFalse(), "Should stop being a moderator")
+	})
+
+	It("Reports: group messages can be reported and deleted", func() {
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		usernameAnother := "another"
+		emailAnother := "another@example.com"
+		outsider := "outsider"
+		emailOutsider := "outsider@example.com"
+		moderator := "moderator"
+		emailModerator := "moderator@example.com"
+
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+		_ = registerUser(smartDB, &usernameAnother, &emailAnother, &initialPassword)
+		_ = registerUser(smartDB, &outsider, &emailOutsider, &initialPassword)
+		_ = registerUser(smartDB, &moderator, &emailModerator, &initialPassword)
+
+		Expect(smartDB.SetModerators([]string{moderator})).To(BeNil())
+
+		name := "Some group"
+		groupID, err := smartDB.CreateGroup(&username, &name, []string{usernameAnother})
+		Expect(err).To(BeNil())
+
+		message := "Pay me outside the site"
+		messageID, err := smartDB.CreateGroupMessage(&usernameAnother, &groupID, &message)
+		Expect(err).To(BeNil())
+
+		own := Report{Reporter: usernameAnother, Type: ReportMessage, MessageID: messageID, Reason: "scam"}
+		Expect(smartDB.CreateReport(&own)).NotTo(BeNil(), "Should not report their own message")
+
+		notMember := Report{Reporter: outsider, Type: ReportMessage, MessageID: messageID, Reason: "scam"}
+		Expect(smartDB.CreateReport(&notMember)).NotTo(BeNil(), "Should only report messages in their groups")
+
+		report := Report{Reporter: username, Type: ReportMessage, MessageID: messageID, Reason: "scam"}
+		Expect(smartDB.CreateReport(&report)).To(BeNil(), "Should be able to report a group message")
+		Expect(report.Content).To(Equal(message))
+		Expect(report.Username).To(Equal(usernameAnother), "Should be about the sender")
+
+		err = smartDB.ModerateReport(&moderator, &report.ID, &ModerationAction{Action: ActionDeleteMessage})
+		Expect(err).To(BeNil(), "Should be able to delete the message")
+
+		messages, _ := smartDB.GetGroupMessages(&groupID, new(int64))
+		Expect(messages).To(BeEmpty())
+	})
+
+	It("Profile: defaults and updates", func() {
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session:          session,
+			DefaultAvatarURL: "https://img.example.com/default.png",
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+
+		profile, err := smartDB.GetProfile(&username)
+		Expect(err).To(BeNil(), "Should be able to get the profile")
+		Expect(profile.AvatarURL).To(Equal("https://img.example.com/default.png"), "Should use the default avatar")
+		Expect(profile.JoinedAt).NotTo(BeZero(), "Should know when the account was made")
+
+		bio := "Selling things"
+		avatar := "https://img.example.com/some.png"
+		private := []string{ProfileLocation}
+
+		err = smartDB.UpdateProfile(&username, &ProfileUpdate{Bio: &bio, AvatarURL: &avatar, Private: &private})
+		Expect(err).To(BeNil(), "Should be able to update the profile")
+
+		profile, _ = smartDB.GetProfile(&username)
+		Expect(profile.Bio).To(Equal(bio))
+		Expect(profile.AvatarURL).To(Equal(avatar))
+		Expect(profile.Private).To(Equal(private))
+
+		empty := ""
+		err = smartDB.UpdateProfile(&username, &ProfileUpdate{AvatarURL: &empty})
+		Expect(err).To(BeNil(), "Should be able to reset the avatar")
+
+		profile, _ = smartDB.GetProfile(&username)
+		Expect(profile.Bio).To(Equal(bio), "Fields left out should not change")
+		Expect(profile.AvatarURL).To(Equal("https://img.example.com/default.png"), "Should go back to the default avatar")
+	})
+
+	It("Media: variants come with the listing and count towards usage", func() {
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "some"
+		email := "some@example.com"
+		initialPassword := "some-password"
+
+		_ = registerUser(smartDB, &username, &email, &initialPassword)
+
+		err := smartDB.AddMedia(&username, &Media{
+			Key:         "listing/abc.jpg",
+			ContentType: "image/jpeg",
+			Size:        100,
+			Purpose:     "listing",
+			Variants: []MediaVariant{
+				{Name: "thumb", Key: "listing/abc-thumb.jpg", ContentType: "image/jpeg", Size: 10},
+			},
+		})
+		Expect(err).To(BeNil(), "Should be able to add media")
+
+		owns, _ := smartDB.OwnsMedia(&username, []string{"listing/abc.jpg"})
+		Expect(owns).To(BeTrue())
+
+		usage, _ := smartDB.MediaUsage(&username)
+		Expect(usage).To(Equal(int64(110)), "Variants should count towards usage")
+
+		listing := Listing{
+			Title:      "Example Listing",
+			Decription: "This is a description of a listing",
+			Images:     []string{"listing/abc.jpg"},
+			Price:      12,
+			Sym:        "ETH",
+		}
+
+		id, _ := smartDB.UploadListing(&username, &listing)
+
+		listingFound, err := smartDB.GetListing(&id)
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+		Expect(listingFound.ImageVariants).To(Equal([]map[string]string{{"thumb": "listing/abc-thumb.jpg"}}))
+
+		key := "listing/abc.jpg"
+		Expect(smartDB.RemoveMedia(&key)).To(BeNil())
+
+		usage, _ = smartDB.MediaUsage(&username)
+		Expect(usage).To(BeZero(), "Variants should be removed with the image")
+	})
+
+	It("Profile: unknown username", func() {
+
+		session := driver.NewSession(neo4j.SessionConfig{})
+		smartDB = NeoHandler{
+			Session: session,
+		}
+
+		defer mocks.Close(session, "Session")
+
+		username := "nobody"
+
+		_, err := smartDB.GetProfile(&username)
+		Expect(err).NotTo(BeNil(), "Should not find a profile")
+	})
+
 })
 
 func registerUser(db ISmartDBWriter, username, email, intialPassword *string) error {
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"go-websocket/pkg/auth"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// NeoKeyStore stores generated signing keys as SigningKey nodes so that every
+// node signs and verifies with the same keys.
+type NeoKeyStore struct {
+	Session neo4j.Session
+}
+
+func (db NeoKeyStore) Save(key auth.StoredKey) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MERGE (k:SigningKey {id: $id})
+			SET k.material = $material, k.createdAt = $createdAt
+			`,
+			map[string]interface{}{
+				"id":        key.ID,
+				"material":  key.Material,
+				"createdAt": key.CreatedAt.UnixNano(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+func (db NeoKeyStore) Load() ([]auth.StoredKey, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (k:SigningKey)
+			RETURN k.id, k.material, k.createdAt
+			`,
+			map[string]interface{}{})
+
+		// Check that transaction worked
+		if err != nil {
+			return nil, err
+		}
+
+		keys := []auth.StoredKey{}
+
+		for result.Next() {
+			values := result.Record().Values
+
+			id, _ := values[0].(string)
+			material, _ := values[1].([]byte)
+			createdAt, _ := values[2].(int64)
+
+			keys = append(keys, auth.StoredKey{
+				ID:        id,
+				Material:  material,
+				CreatedAt: time.Unix(0, createdAt),
+			})
+		}
+
+		return keys, result.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	keys, _ := value.([]auth.StoredKey)
+
+	return keys, nil
+}
+
+func (db NeoKeyStore) Delete(id string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (k:SigningKey {id: $id})
+			DELETE k
+			`,
+			map[string]interface{}{
+				"id": id,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
@@ -0,0 +1,162 @@
+package db
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// NeoOneTimeStore stores tokens sent by email as OneTimeToken nodes.
+type NeoOneTimeStore struct {
+	Session neo4j.Session
+}
+
+func (db NeoOneTimeStore) Create(token auth.OneTimeToken) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		// Only the latest token sent for a purpose works, expired ones are
+		// cleared out at the same time
+		result, err := transaction.Run(
+			`
+			MATCH (t:OneTimeToken)
+			WHERE (t.purpose = $purpose AND t.subject = $subject) OR t.expiresAt <= $now
+			DELETE t
+			`,
+			map[string]interface{}{
+				"purpose": token.Purpose,
+				"subject": token.Subject,
+				"now":     time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err = transaction.Run(
+			`
+			CREATE (t:OneTimeToken
+				{
+					hash: $hash,
+					purpose: $purpose,
+					subject: $subject,
+					expiresAt: $expiresAt
+				})
+			`,
+			map[string]interface{}{
+				"hash":      token.Hash,
+				"purpose":   token.Purpose,
+				"subject":   token.Subject,
+				"expiresAt": token.ExpiresAt.Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+func (db NeoOneTimeStore) Get(hash, purpose string, now time.Time) (auth.OneTimeToken, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		return getOneTimeToken(transaction, hash, purpose, now)
+	})
+
+	return oneTimeTokenFrom(value, err)
+}
+
+func (db NeoOneTimeStore) Consume(hash, purpose string, now time.Time) (auth.OneTimeToken, error) {
+
+	value, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		// Take the write lock first so a concurrent consume waits and then
+		// finds the token gone
+		result, err := transaction.Run(
+			`
+			MATCH (t:OneTimeToken {hash: $hash})
+			SET t.locked = true
+			`,
+			map[string]interface{}{
+				"hash": hash,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		token, err := getOneTimeToken(transaction, hash, purpose, now)
+
+		if err != nil {
+			return nil, err
+		}
+
+		result, err = transaction.Run(
+			`
+			MATCH (t:OneTimeToken {hash: $hash})
+			DELETE t
+			`,
+			map[string]interface{}{
+				"hash": hash,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return token, result.Err()
+	})
+
+	return oneTimeTokenFrom(value, err)
+}
+
+func getOneTimeToken(transaction neo4j.Transaction, hash, purpose string, now time.Time) (auth.OneTimeToken, error) {
+	result, err := transaction.Run(
+		`
+		MATCH (t:OneTimeToken {hash: $hash, purpose: $purpose})
+		WHERE t.expiresAt > $now
+		RETURN t.subject, t.expiresAt
+		`,
+		map[string]interface{}{
+			"hash":    hash,
+			"purpose": purpose,
+			"now":     now.Unix(),
+		})
+
+	if err != nil {
+		return auth.OneTimeToken{}, err
+	}
+
+	if !result.Next() {
+		return auth.OneTimeToken{}, auth.ErrOneTimeInvalid
+	}
+
+	token := auth.OneTimeToken{Hash: hash, Purpose: purpose}
+	token.Subject, _ = result.Record().Values[0].(string)
+	token.ExpiresAt = unixToTime(result.Record().Values[1])
+
+	return token, nil
+}
+
+func oneTimeTokenFrom(value interface{}, err error) (auth.OneTimeToken, error) {
+	if err != nil {
+		return auth.OneTimeToken{}, err
+	}
+
+	if token, ok := value.(auth.OneTimeToken); ok {
+		return token, nil
+	}
+
+	return auth.OneTimeToken{}, fmt.Errorf("cannot cast to OneTimeToken")
+}
@@ -0,0 +1,251 @@
+package db
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// NeoRefreshStore stores refresh tokens as RefreshToken nodes.
+type NeoRefreshStore struct {
+	Session neo4j.Session
+}
+
+func (db NeoRefreshStore) Create(record auth.RefreshRecord) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			CREATE (t:RefreshToken
+				{
+					hash: $hash,
+					family: $family,
+					username: $username,
+					issuedAt: $issuedAt,
+					expiresAt: $expiresAt,
+					used: false,
+					revoked: false,
+					userAgent: $userAgent,
+					ip: $ip
+				})
+			`,
+			map[string]interface{}{
+				"hash":      record.Hash,
+				"family":    record.Family,
+				"username":  record.Username,
+				"issuedAt":  record.IssuedAt.Unix(),
+				"expiresAt": record.ExpiresAt.Unix(),
+				"userAgent": record.UserAgent,
+				"ip":        record.IP,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+func (db NeoRefreshStore) Rotate(oldHash string, next auth.RefreshRecord, now time.Time) (auth.RefreshRecord, error) {
+
+	value, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		// Take the write lock first so a concurrent rotation of the same
+		// token waits and then sees it as used
+		result, err := transaction.Run(
+			`
+			MATCH (t:RefreshToken {hash: $hash})
+			SET t.locked = true
+			`,
+			map[string]interface{}{
+				"hash": oldHash,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err = transaction.Run(
+			`
+			MATCH (t:RefreshToken {hash: $hash})
+			RETURN t.family, t.username, t.issuedAt, t.expiresAt, t.used, t.revoked
+			`,
+			map[string]interface{}{
+				"hash": oldHash,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, auth.ErrRefreshInvalid
+		}
+
+		values := result.Record().Values
+
+		old := auth.RefreshRecord{Hash: oldHash}
+		old.Family, _ = values[0].(string)
+		old.Username, _ = values[1].(string)
+		old.IssuedAt = unixToTime(values[2])
+		old.ExpiresAt = unixToTime(values[3])
+		old.Used, _ = values[4].(bool)
+		old.Revoked, _ = values[5].(bool)
+
+		if old.Revoked || !now.Before(old.ExpiresAt) {
+			return nil, auth.ErrRefreshInvalid
+		}
+
+		if old.Used {
+			// Someone holds a copy of the token, sign the whole login out
+			result, err = transaction.Run(
+				`
+				MATCH (t:RefreshToken {family: $family})
+				SET t.revoked = true
+				`,
+				map[string]interface{}{
+					"family": old.Family,
+				})
+
+			if err != nil {
+				return nil, err
+			}
+
+			if err = result.Err(); err != nil {
+				return nil, err
+			}
+
+			// returning an error would roll the revocation back
+			return auth.ErrRefreshReused, nil
+		}
+
+		result, err = transaction.Run(
+			`
+			MATCH (old:RefreshToken {hash: $oldHash})
+			SET old.used = true
+			CREATE (t:RefreshToken
+				{
+					hash: $hash,
+					family: old.family,
+					username: old.username,
+					issuedAt: $issuedAt,
+					expiresAt: $expiresAt,
+					used: false,
+					revoked: false,
+					userAgent: $userAgent,
+					ip: $ip
+				})
+			`,
+			map[string]interface{}{
+				"oldHash":   oldHash,
+				"hash":      next.Hash,
+				"issuedAt":  next.IssuedAt.Unix(),
+				"expiresAt": next.ExpiresAt.Unix(),
+				"userAgent": next.UserAgent,
+				"ip":        next.IP,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return old, result.Err()
+	})
+
+	if err != nil {
+		return auth.RefreshRecord{}, err
+	}
+
+	if reuseErr, ok := value.(error); ok {
+		return auth.RefreshRecord{}, reuseErr
+	}
+
+	if record, ok := value.(auth.RefreshRecord); ok {
+		return record, nil
+	}
+
+	return auth.RefreshRecord{}, fmt.Errorf("cannot cast to RefreshRecord")
+}
+
+func (db NeoRefreshStore) RevokeFamily(family string) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (t:RefreshToken {family: $family})
+			SET t.revoked = true
+			`,
+			map[string]interface{}{
+				"family": family,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+func (db NeoRefreshStore) ListSessions(username string, now time.Time) ([]auth.Session, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		// The unused token of a family is the latest one
+		result, err := transaction.Run(
+			`
+			MATCH (t:RefreshToken {username: $username, used: false, revoked: false})
+			WHERE t.expiresAt > $now
+			MATCH (f:RefreshToken {family: t.family})
+			RETURN t.family, t.userAgent, t.ip, min(f.issuedAt), t.issuedAt
+			ORDER BY t.issuedAt DESC
+			`,
+			map[string]interface{}{
+				"username": username,
+				"now":      now.Unix(),
+			})
+
+		// Check that transaction worked
+		if err != nil {
+			return nil, err
+		}
+
+		sessions := []auth.Session{}
+
+		for result.Next() {
+			values := result.Record().Values
+
+			session := auth.Session{
+				Username:  username,
+				CreatedAt: unixToTime(values[3]),
+				LastUsed:  unixToTime(values[4]),
+			}
+			session.ID, _ = values[0].(string)
+			session.UserAgent, _ = values[1].(string)
+			session.IP, _ = values[2].(string)
+
+			sessions = append(sessions, session)
+		}
+
+		return sessions, result.Err()
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if sessions, ok := value.([]auth.Session); ok {
+		return sessions, nil
+	}
+
+	return nil, fmt.Errorf("cannot cast to []Session")
+}
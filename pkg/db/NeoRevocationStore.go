@@ -0,0 +1,92 @@
+package db
+
+import (
+	"time"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// NeoRevocationStore stores revoked sessions as RevokedSession nodes so that
+// every node refuses their access tokens.
+type NeoRevocationStore struct {
+	Session neo4j.Session
+}
+
+func (db NeoRevocationStore) Revoke(sessionID string, until time.Time) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		// Clear out revocations that have outlived their tokens
+		result, err := transaction.Run(
+			`
+			MATCH (r:RevokedSession)
+			WHERE r.until < $now
+			DELETE r
+			`,
+			map[string]interface{}{
+				"now": time.Now().Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err = transaction.Run(
+			`
+			MERGE (r:RevokedSession {id: $id})
+			SET r.until = $until
+			`,
+			map[string]interface{}{
+				"id":    sessionID,
+				"until": until.Unix(),
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+func (db NeoRevocationStore) IsRevoked(sessionID string) (bool, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (r:RevokedSession {id: $id})
+			WHERE r.until >= $now
+			RETURN COUNT(r)
+			`,
+			map[string]interface{}{
+				"id":  sessionID,
+				"now": time.Now().Unix(),
+			})
+
+		// Check that transaction worked
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, result.Err()
+		}
+
+		count, _ := result.Record().Values[0].(int64)
+
+		return count > 0, nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	revoked, _ := value.(bool)
+
+	return revoked, nil
+}
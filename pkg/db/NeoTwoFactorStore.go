@@ -0,0 +1,194 @@
+package db
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+
+	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
+)
+
+// NeoTwoFactorStore keeps 2FA on the Person node, so it follows the account
+// through username changes.
+type NeoTwoFactorStore struct {
+	Session neo4j.Session
+}
+
+func (db NeoTwoFactorStore) Get(username string) (auth.TwoFactorRecord, error) {
+
+	value, err := db.Session.ReadTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			RETURN coalesce(n.twoFactorEnabled, false), n.twoFactorSecret, n.twoFactorPending,
+				coalesce(n.twoFactorCounter, 0), coalesce(n.recoveryCodes, [])
+			`,
+			map[string]interface{}{
+				"username": username,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return nil, fmt.Errorf("username: no account with that username")
+		}
+
+		values := result.Record().Values
+
+		record := auth.TwoFactorRecord{}
+		record.Enabled, _ = values[0].(bool)
+		record.Secret, _ = values[1].(string)
+		record.PendingSecret, _ = values[2].(string)
+		record.LastCounter, _ = values[3].(int64)
+
+		codes, _ := values[4].([]interface{})
+
+		for _, code := range codes {
+			if hash, ok := code.(string); ok {
+				record.RecoveryCodes = append(record.RecoveryCodes, hash)
+			}
+		}
+
+		return record, nil
+	})
+
+	if err != nil {
+		return auth.TwoFactorRecord{}, err
+	}
+
+	if record, ok := value.(auth.TwoFactorRecord); ok {
+		return record, nil
+	}
+
+	return auth.TwoFactorRecord{}, fmt.Errorf("cannot cast to TwoFactorRecord")
+}
+
+func (db NeoTwoFactorStore) SetPending(username, secret string) error {
+	return db.write(
+		`
+		MATCH (n:Person {username: $username})
+		SET n.twoFactorPending = $secret
+		`,
+		map[string]interface{}{
+			"username": username,
+			"secret":   secret,
+		})
+}
+
+func (db NeoTwoFactorStore) Enable(username string, recoveryHashes []string) error {
+	return db.write(
+		`
+		MATCH (n:Person {username: $username})
+		SET n.twoFactorEnabled = true,
+			n.twoFactorSecret = n.twoFactorPending,
+			n.recoveryCodes = $recoveryCodes
+		REMOVE n.twoFactorPending
+		`,
+		map[string]interface{}{
+			"username":      username,
+			"recoveryCodes": recoveryHashes,
+		})
+}
+
+func (db NeoTwoFactorStore) Disable(username string) error {
+	return db.write(
+		`
+		MATCH (n:Person {username: $username})
+		REMOVE n.twoFactorEnabled, n.twoFactorSecret, n.twoFactorPending, n.twoFactorCounter, n.recoveryCodes
+		`,
+		map[string]interface{}{
+			"username": username,
+		})
+}
+
+func (db NeoTwoFactorStore) UseCounter(username string, counter int64) (bool, error) {
+	return db.use(username,
+		`
+		MATCH (n:Person {username: $username})
+		WHERE coalesce(n.twoFactorCounter, 0) < $counter
+		SET n.twoFactorCounter = $counter
+		RETURN COUNT(n)
+		`,
+		map[string]interface{}{
+			"username": username,
+			"counter":  counter,
+		})
+}
+
+func (db NeoTwoFactorStore) UseRecoveryCode(username, hash string) (bool, error) {
+	return db.use(username,
+		`
+		MATCH (n:Person {username: $username})
+		WHERE $hash IN coalesce(n.recoveryCodes, [])
+		SET n.recoveryCodes = [code IN n.recoveryCodes WHERE code <> $hash]
+		RETURN COUNT(n)
+		`,
+		map[string]interface{}{
+			"username": username,
+			"hash":     hash,
+		})
+}
+
+func (db NeoTwoFactorStore) write(query string, params map[string]interface{}) error {
+
+	_, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		result, err := transaction.Run(query, params)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return nil, result.Err()
+	})
+
+	return err
+}
+
+// use runs a conditional update, true if it changed the account
+func (db NeoTwoFactorStore) use(username string, query string, params map[string]interface{}) (bool, error) {
+
+	value, err := db.Session.WriteTransaction(func(transaction neo4j.Transaction) (interface{}, error) {
+		// Take the write lock first so two uses of the same code cannot
+		// both see it as unused
+		result, err := transaction.Run(
+			`
+			MATCH (n:Person {username: $username})
+			SET n.locked = true
+			REMOVE n.locked
+			`,
+			map[string]interface{}{
+				"username": username,
+			})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = result.Err(); err != nil {
+			return nil, err
+		}
+
+		result, err = transaction.Run(query, params)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !result.Next() {
+			return false, result.Err()
+		}
+
+		count, _ := result.Record().Values[0].(int64)
+
+		return count > 0, nil
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	used, _ := value.(bool)
+
+	return used, nil
+}
@@ -0,0 +1,43 @@
+package db
+
+// Profile fields that can be hidden from everyone but the owner
+const (
+	ProfileBio          = "Bio"
+	ProfileLocation     = "Location"
+	ProfileListingCount = "ListingCount"
+	ProfileJoinedAt     = "JoinedAt"
+	ProfileRating       = "Rating"
+)
+
+type Profile struct {
+	Username    string
+	DisplayName string
+	Bio         string
+	Location    string
+	AvatarURL   string
+
+	// Listings still for sale
+	ListingCount int64
+
+	// Unix time the account was made
+	JoinedAt int64
+
+	// Average score buyers gave the user as a seller, 0 without any
+	Rating      float64
+	RatingCount int64
+
+	// Fields only shown to the owner
+	Private []string
+}
+
+// ProfileUpdate changes the fields that are not nil
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	Location    *string
+
+	// "" goes back to the default avatar
+	AvatarURL *string
+
+	Private *[]string
+}
@@ -0,0 +1,61 @@
+package db
+
+// What can be reported
+const (
+	ReportListing = "listing"
+	ReportMessage = "message"
+	ReportUser    = "user"
+)
+
+// Where a report is up to, reports start open
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+// What moderators can do about a report
+const (
+	ActionHideListing   = "hideListing"
+	ActionSuspendUser   = "suspendUser"
+	ActionDeleteMessage = "deleteMessage"
+	ActionDismiss       = "dismiss"
+)
+
+// Report is a user flagging a listing, message or user to the moderators
+type Report struct {
+	ID       string
+	Reporter string
+	Type     string
+
+	// Listing reported
+	Listing int64
+
+	// User reported, the sender of a reported message or the seller of a
+	// reported listing
+	Username string
+
+	// ID of the reported message, sent by Username to the reporter or to a
+	// group the reporter is in
+	MessageID string
+
+	// Copy of the message or listing title when it was reported, kept after
+	// it is deleted
+	Content string
+
+	Reason    string
+	Details   string
+	Status    string
+	CreatedAt int64
+
+	// Audit trail of what moderators did, oldest first
+	Actions []ModerationAction
+}
+
+// ModerationAction is something a moderator did about a report
+type ModerationAction struct {
+	Moderator string
+	Action    string
+	Note      string
+	CreatedAt int64
+}
@@ -0,0 +1,77 @@
+package db
+
+import (
+	"bytes"
+	"crypto/rand"
+	"sync"
+	"time"
+)
+
+// Crockford's base32, leaving out I, L, O and U
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+var (
+	ulidMu   sync.Mutex
+	ulidLast [16]byte
+)
+
+// newULID returns a 26 character ULID for the time. IDs made in the same
+// millisecond increase, so they sort in the order they were made.
+func newULID(at time.Time) string {
+	var id [16]byte
+
+	ms := uint64(at.UnixNano() / int64(time.Millisecond))
+	for i := 5; i >= 0; i-- {
+		id[i] = byte(ms)
+		ms >>= 8
+	}
+
+	ulidMu.Lock()
+	defer ulidMu.Unlock()
+
+	if bytes.Equal(id[:6], ulidLast[:6]) {
+		// same millisecond, add one to the random part of the last id
+		copy(id[6:], ulidLast[6:])
+		for i := 15; i >= 6; i-- {
+			id[i]++
+			if id[i] != 0 {
+				break
+			}
+		}
+	} else if _, err := rand.Read(id[6:]); err != nil {
+		panic(err)
+	}
+
+	ulidLast = id
+
+	return encodeULID(id)
+}
+
+// encodeULID writes the 128 bits as 26 base32 characters, the first holding
+// only 3 bits
+func encodeULID(id [16]byte) string {
+	out := make([]byte, 26)
+
+	// read 5 bits at a time from the end
+	var buffer uint32
+	bits := 0
+	position := 25
+
+	for i := 15; i >= 0; i-- {
+		buffer |= uint32(id[i]) << bits
+		bits += 8
+
+		for bits >= 5 && position >= 0 {
+			out[position] = ulidAlphabet[buffer&31]
+			buffer >>= 5
+			bits -= 5
+			position--
+		}
+	}
+
+	if position >= 0 {
+		out[position] = ulidAlphabet[buffer&31]
+	}
+
+	return string(out)
+}
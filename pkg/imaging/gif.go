@@ -0,0 +1,81 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// gifFrames walks the blocks of a GIF without decoding it, returning how many
+// frames it has and how many pixels they add up to. gif.DecodeAll keeps every
+// frame in memory, so both are checked before it is called.
+func gifFrames(data []byte) (int, int, error) {
+	invalid := fmt.Errorf("media type: could not read the image")
+
+	// header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, 0, invalid
+	}
+
+	offset := 13
+
+	if data[10]&0x80 != 0 {
+		offset += 3 << (data[10]&0x07 + 1)
+	}
+
+	frames, pixels := 0, 0
+
+	for offset < len(data) {
+		switch data[offset] {
+
+		// trailer
+		case 0x3b:
+			return frames, pixels, nil
+
+		// extension, its label then data sub-blocks
+		case 0x21:
+			offset += 2
+
+		// image descriptor, then the minimum code size and data sub-blocks
+		case 0x2c:
+			if offset+10 > len(data) {
+				return 0, 0, invalid
+			}
+
+			width := int(binary.LittleEndian.Uint16(data[offset+5:]))
+			height := int(binary.LittleEndian.Uint16(data[offset+7:]))
+			flags := data[offset+9]
+
+			frames++
+			pixels += width * height
+
+			offset += 10
+
+			if flags&0x80 != 0 {
+				offset += 3 << (flags&0x07 + 1)
+			}
+
+			offset++
+
+		default:
+			return 0, 0, invalid
+
+		}
+
+		// data sub-blocks, each starting with its length, end with a 0
+		for {
+			if offset >= len(data) {
+				return 0, 0, invalid
+			}
+
+			size := int(data[offset])
+			offset += size + 1
+
+			if size == 0 {
+				break
+			}
+		}
+	}
+
+	// no trailer, the frames so far are still checked
+	return frames, pixels, nil
+}
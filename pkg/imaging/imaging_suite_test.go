@@ -0,0 +1,13 @@
+package imaging
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestImaging(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Imaging Suite")
+}
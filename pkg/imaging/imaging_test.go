@@ -0,0 +1,247 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// withOrientation puts an EXIF segment with the orientation and a GPS
+// position into a JPEG, right after its start marker
+func withOrientation(data []byte, orientation uint16) []byte {
+	var tiff bytes.Buffer
+	tiff.WriteString("II*\x00")
+	binary.Write(&tiff, binary.LittleEndian, uint32(8))
+	binary.Write(&tiff, binary.LittleEndian, uint16(2))
+
+	// orientation, SHORT, 1 value
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x0112, 3})
+	binary.Write(&tiff, binary.LittleEndian, uint32(1))
+	binary.Write(&tiff, binary.LittleEndian, []uint16{orientation, 0})
+
+	// GPS IFD pointer, LONG, 1 value
+	binary.Write(&tiff, binary.LittleEndian, []uint16{0x8825, 4})
+	binary.Write(&tiff, binary.LittleEndian, []uint32{1, 0})
+	binary.Write(&tiff, binary.LittleEndian, uint32(0))
+
+	segment := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+
+	var out bytes.Buffer
+	out.Write(data[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(segment)+2))
+	out.Write(segment)
+	out.Write(data[2:])
+
+	return out.Bytes()
+}
+
+// testImage is red on the left half and blue on the right
+func testImage(width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if x < width/2 {
+				img.Set(x, y, color.RGBA{255, 0, 0, 255})
+			} else {
+				img.Set(x, y, color.RGBA{0, 0, 255, 255})
+			}
+		}
+	}
+
+	return img
+}
+
+func encodeJPEG(img image.Image) []byte {
+	var buffer bytes.Buffer
+	jpeg.Encode(&buffer, img, &jpeg.Options{Quality: 95})
+
+	return buffer.Bytes()
+}
+
+func encodePNG(img image.Image) []byte {
+	var buffer bytes.Buffer
+	png.Encode(&buffer, img)
+
+	return buffer.Bytes()
+}
+
+var _ = Describe("Imaging", func() {
+
+	It("Orientation: reads the EXIF orientation of a JPEG", func() {
+		data := encodeJPEG(testImage(8, 4))
+
+		Expect(Orientation(data)).To(Equal(1), "No EXIF is upright")
+		Expect(Orientation(withOrientation(data, 6))).To(Equal(6))
+		Expect(Orientation(withOrientation(data, 42))).To(Equal(1), "Unknown orientations are ignored")
+		Expect(Orientation([]byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF})).To(Equal(1), "Truncated segments are ignored")
+	})
+
+	It("Orient: rotates and mirrors the image upright", func() {
+		img := testImage(8, 4)
+
+		rotated := Orient(img, 6)
+		Expect(rotated.Bounds().Dx()).To(Equal(4))
+		Expect(rotated.Bounds().Dy()).To(Equal(8))
+
+		// turned clockwise, the red left half ends up on top
+		r, _, b, _ := rotated.At(0, 0).RGBA()
+		Expect(r).To(BeNumerically(">", b))
+
+		mirrored := Orient(img, 2)
+		r, _, b, _ = mirrored.At(0, 0).RGBA()
+		Expect(b).To(BeNumerically(">", r))
+
+		Expect(Orient(img, 1)).To(Equal(image.Image(img)))
+	})
+
+	It("Fit: keeps the aspect ratio and never makes images larger", func() {
+		width, height := Fit(4000, 3000, 1000)
+		Expect(width).To(Equal(1000))
+		Expect(height).To(Equal(750))
+
+		width, height = Fit(300, 3000, 1000)
+		Expect(width).To(Equal(100))
+		Expect(height).To(Equal(1000))
+
+		width, height = Fit(200, 100, 1000)
+		Expect(width).To(Equal(200))
+		Expect(height).To(Equal(100))
+	})
+
+	It("Resize: averages the pixels it shrinks", func() {
+		resized := Resize(testImage(100, 50), 10, 5)
+		Expect(resized.Bounds().Dx()).To(Equal(10))
+
+		r, _, b, _ := resized.At(0, 0).RGBA()
+		Expect(r).To(BeNumerically(">", b))
+
+		r, _, b, _ = resized.At(9, 4).RGBA()
+		Expect(b).To(BeNumerically(">", r))
+	})
+
+	It("Process: strips EXIF and turns JPEGs upright", func() {
+		data := withOrientation(encodeJPEG(testImage(80, 40)), 6)
+		Expect(bytes.Contains(data, []byte("Exif"))).To(BeTrue())
+
+		result, err := NewProcessor().Process(data, false)
+		Expect(err).To(BeNil())
+		Expect(result.ContentType).To(Equal("image/jpeg"))
+		Expect(result.Extension).To(Equal(".jpg"))
+		Expect(bytes.Contains(result.Data, []byte("Exif"))).To(BeFalse(), "Metadata should be gone")
+		Expect(result.Variants).To(BeEmpty())
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(result.Data))
+		Expect(err).To(BeNil())
+		Expect(config.Width).To(Equal(40))
+		Expect(config.Height).To(Equal(80))
+	})
+
+	It("Process: makes variants of each size", func() {
+		processor := NewProcessor()
+		processor.MaxDimension = 600
+
+		result, err := processor.Process(encodePNG(testImage(1200, 600)), true)
+		Expect(err).To(BeNil())
+		Expect(result.ContentType).To(Equal("image/png"))
+
+		config, _ := png.DecodeConfig(bytes.NewReader(result.Data))
+		Expect(config.Width).To(Equal(600), "Image should be capped")
+
+		Expect(result.Variants).To(HaveLen(3))
+
+		config, _ = png.DecodeConfig(bytes.NewReader(result.Variants["thumb"].Data))
+		Expect(config.Width).To(Equal(160))
+		Expect(config.Height).To(Equal(80))
+
+		config, _ = png.DecodeConfig(bytes.NewReader(result.Variants["medium"].Data))
+		Expect(config.Width).To(Equal(600), "Variants are never larger than the image")
+	})
+
+	It("Process: keeps GIF animations", func() {
+		palette := color.Palette{color.Black, color.White}
+		animation := &gif.GIF{
+			Image: []*image.Paletted{image.NewPaletted(image.Rect(0, 0, 4, 4), palette), image.NewPaletted(image.Rect(0, 0, 4, 4), palette)},
+			Delay: []int{10, 10},
+		}
+
+		var buffer bytes.Buffer
+		gif.EncodeAll(&buffer, animation)
+
+		result, err := NewProcessor().Process(buffer.Bytes(), true)
+		Expect(err).To(BeNil())
+		Expect(result.ContentType).To(Equal("image/gif"))
+		Expect(result.Variants["thumb"].ContentType).To(Equal("image/png"))
+
+		decoded, err := gif.DecodeAll(bytes.NewReader(result.Data))
+		Expect(err).To(BeNil())
+		Expect(decoded.Image).To(HaveLen(2))
+	})
+
+	It("Process: refuses images with too many pixels before decoding them", func() {
+		// a header claiming 60000x60000 pixels with no image data behind it
+		var header bytes.Buffer
+		png.Encode(&header, image.NewGray(image.Rect(0, 0, 1, 1)))
+
+		data := header.Bytes()
+		binary.BigEndian.PutUint32(data[16:], 60000)
+		binary.BigEndian.PutUint32(data[20:], 60000)
+		binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+
+		_, err := NewProcessor().Process(data, true)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("media size:"))
+	})
+
+	It("Process: refuses GIFs with too many frames or pixels before decoding them", func() {
+		palette := color.Palette{color.Black, color.White}
+		animation := &gif.GIF{}
+
+		for i := 0; i < 20; i++ {
+			animation.Image = append(animation.Image, image.NewPaletted(image.Rect(0, 0, 100, 100), palette))
+			animation.Delay = append(animation.Delay, 10)
+		}
+
+		var buffer bytes.Buffer
+		gif.EncodeAll(&buffer, animation)
+
+		frames, pixels, err := gifFrames(buffer.Bytes())
+		Expect(err).To(BeNil())
+		Expect(frames).To(Equal(20))
+		Expect(pixels).To(Equal(20 * 100 * 100))
+
+		processor := NewProcessor()
+		processor.MaxFrames = 10
+
+		_, err = processor.Process(buffer.Bytes(), false)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("media size:"))
+
+		// each frame is small enough, all of them together are not
+		processor = NewProcessor()
+		processor.MaxPixels = 100000
+
+		_, err = processor.Process(buffer.Bytes(), false)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("media size:"))
+
+		_, err = NewProcessor().Process(buffer.Bytes(), false)
+		Expect(err).To(BeNil())
+	})
+
+	It("Process: refuses what it cannot decode", func() {
+		_, err := NewProcessor().Process([]byte("RIFF\x00\x00\x00\x00WEBPVP8 "), false)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Error()).To(HavePrefix("media type:"))
+	})
+
+})
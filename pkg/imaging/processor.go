@@ -0,0 +1,196 @@
+package imaging
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+)
+
+// Variant is a smaller copy made of each listing image
+type Variant struct {
+	Name string
+
+	// Longest side in pixels
+	Size int
+}
+
+// Output is an encoded image
+type Output struct {
+	Data        []byte
+	ContentType string
+	Extension   string
+}
+
+// Result is a processed upload and its variants by name
+type Result struct {
+	Output
+	Variants map[string]Output
+}
+
+// Processor re-encodes uploads so nothing but the pixels survives, dropping
+// EXIF data such as where a photo was taken, and makes the variants
+type Processor struct {
+	// Longest side the image itself is kept at
+	MaxDimension int
+
+	// Images with more pixels are refused before decoding them, for a GIF
+	// this is every frame added up
+	MaxPixels int
+
+	// Longest GIF animation accepted
+	MaxFrames int
+
+	JPEGQuality int
+	Variants    []Variant
+}
+
+func NewProcessor() *Processor {
+	return &Processor{
+		MaxDimension: 2048,
+		MaxPixels:    40_000_000,
+		MaxFrames:    500,
+		JPEGQuality:  85,
+		Variants: []Variant{
+			{Name: "thumb", Size: 160},
+			{Name: "small", Size: 480},
+			{Name: "medium", Size: 1024},
+		},
+	}
+}
+
+// Process decodes the image, turns it upright and encodes it again, with
+// variants when asked for. JPEGs stay JPEGs, PNGs stay PNGs and GIFs keep
+// their animation, but the variants of a GIF are PNGs of its first frame.
+func (p *Processor) Process(data []byte, variants bool) (Result, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+
+	if err != nil {
+		return Result{}, fmt.Errorf("media type: could not read the image")
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > p.MaxPixels {
+		return Result{}, fmt.Errorf("media size: images are limited to %d pixels", p.MaxPixels)
+	}
+
+	var img image.Image
+	var result Result
+
+	switch format {
+
+	case "jpeg":
+		img, err = jpeg.Decode(bytes.NewReader(data))
+
+		if err != nil {
+			return Result{}, fmt.Errorf("media type: could not decode the image")
+		}
+
+		img = Orient(img, Orientation(data))
+		img = p.shrink(img, p.MaxDimension)
+
+		result.Output, err = p.encode(img, "jpeg")
+
+	case "png":
+		img, err = png.Decode(bytes.NewReader(data))
+
+		if err != nil {
+			return Result{}, fmt.Errorf("media type: could not decode the image")
+		}
+
+		img = p.shrink(img, p.MaxDimension)
+
+		result.Output, err = p.encode(img, "png")
+
+	case "gif":
+		var frames, pixels int
+		frames, pixels, err = gifFrames(data)
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		if frames > p.MaxFrames {
+			return Result{}, fmt.Errorf("media size: animations are limited to %d frames", p.MaxFrames)
+		}
+
+		if pixels > p.MaxPixels {
+			return Result{}, fmt.Errorf("media size: images are limited to %d pixels", p.MaxPixels)
+		}
+
+		var animation *gif.GIF
+		animation, err = gif.DecodeAll(bytes.NewReader(data))
+
+		if err != nil || len(animation.Image) == 0 {
+			return Result{}, fmt.Errorf("media type: could not decode the image")
+		}
+
+		// only frames and timing are written back, comments and
+		// application data are left behind
+		var buffer bytes.Buffer
+
+		if err = gif.EncodeAll(&buffer, animation); err != nil {
+			return Result{}, err
+		}
+
+		img = animation.Image[0]
+		result.Output = Output{Data: buffer.Bytes(), ContentType: "image/gif", Extension: ".gif"}
+		format = "png"
+
+	default:
+		return Result{}, fmt.Errorf("media type: %s images are not allowed", format)
+
+	}
+
+	if err != nil {
+		return Result{}, err
+	}
+
+	if !variants {
+		return result, nil
+	}
+
+	result.Variants = make(map[string]Output)
+
+	for _, variant := range p.Variants {
+		output, err := p.encode(p.shrink(img, variant.Size), format)
+
+		if err != nil {
+			return Result{}, err
+		}
+
+		result.Variants[variant.Name] = output
+	}
+
+	return result, nil
+}
+
+// shrink fits the image in a square of the size, leaving smaller images alone
+func (p *Processor) shrink(img image.Image, size int) image.Image {
+	width, height := Fit(img.Bounds().Dx(), img.Bounds().Dy(), size)
+
+	if width == img.Bounds().Dx() && height == img.Bounds().Dy() {
+		return img
+	}
+
+	return Resize(img, width, height)
+}
+
+func (p *Processor) encode(img image.Image, format string) (Output, error) {
+	var buffer bytes.Buffer
+
+	if format == "jpeg" {
+		if err := jpeg.Encode(&buffer, img, &jpeg.Options{Quality: p.JPEGQuality}); err != nil {
+			return Output{}, err
+		}
+
+		return Output{Data: buffer.Bytes(), ContentType: "image/jpeg", Extension: ".jpg"}, nil
+	}
+
+	if err := png.Encode(&buffer, img); err != nil {
+		return Output{}, err
+	}
+
+	return Output{Data: buffer.Bytes(), ContentType: "image/png", Extension: ".png"}, nil
+}
@@ -0,0 +1,48 @@
+package mail
+
+import (
+	"fmt"
+	"log"
+	"os"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+type Mailer interface {
+	Send(message Message) error
+}
+
+// NewMailerFromEnv sends through SMTP_HOST when it is set, otherwise messages
+// are kept in an outbox written to MAIL_OUTBOX_DIR for development
+func NewMailerFromEnv() (Mailer, error) {
+	from := os.Getenv("MAIL_FROM")
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		if from == "" {
+			return nil, fmt.Errorf("MAIL_FROM: must be set to send through SMTP")
+		}
+
+		port := os.Getenv("SMTP_PORT")
+
+		if port == "" {
+			port = "587"
+		}
+
+		return &SMTPMailer{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	}
+
+	log.Println("SMTP_HOST is not set, emails are only written to the outbox")
+
+	return NewOutbox(os.Getenv("MAIL_OUTBOX_DIR")), nil
+}
@@ -0,0 +1,13 @@
+package mail
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestMail(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Mail Suite")
+}
@@ -0,0 +1,75 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Mail", func() {
+
+	message := Message{
+		To:      "someone@example.com",
+		Subject: "Reset your password",
+		Body:    "first line\nsecond line",
+	}
+
+	It("Format: writes headers and a CRLF body", func() {
+		data, err := format("noreply@example.com", message, time.Unix(0, 0).UTC())
+		Expect(err).To(BeNil())
+
+		text := string(data)
+		Expect(text).To(HavePrefix("From: noreply@example.com\r\nTo: someone@example.com\r\nSubject: Reset your password\r\n"))
+		Expect(text).To(ContainSubstring("Content-Type: text/plain; charset=utf-8\r\n\r\n"))
+		Expect(text).To(HaveSuffix("first line\r\nsecond line"))
+	})
+
+	It("Format: refuses new lines in headers", func() {
+		injected := message
+		injected.Subject = "hello\r\nBcc: victim@example.com"
+
+		_, err := format("noreply@example.com", injected, time.Now())
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Outbox: keeps messages in order", func() {
+		outbox := NewOutbox("")
+
+		Expect(outbox.Send(message)).To(BeNil())
+
+		second := message
+		second.Subject = "Second"
+		Expect(outbox.Send(second)).To(BeNil())
+
+		Expect(outbox.Messages()).To(HaveLen(2))
+
+		last, ok := outbox.Last("someone@example.com")
+		Expect(ok).To(BeTrue())
+		Expect(last.Subject).To(Equal("Second"))
+
+		_, ok = outbox.Last("nobody@example.com")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("Outbox: writes messages to the directory", func() {
+		dir, err := os.MkdirTemp("", "outbox")
+		Expect(err).To(BeNil())
+		defer os.RemoveAll(dir)
+
+		outbox := NewOutbox(filepath.Join(dir, "mail"))
+		Expect(outbox.Send(message)).To(BeNil())
+
+		files, err := os.ReadDir(filepath.Join(dir, "mail"))
+		Expect(err).To(BeNil())
+		Expect(files).To(HaveLen(1))
+
+		data, err := os.ReadFile(filepath.Join(dir, "mail", files[0].Name()))
+		Expect(err).To(BeNil())
+		Expect(strings.Contains(string(data), "To: someone@example.com")).To(BeTrue())
+	})
+
+})
@@ -0,0 +1,69 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Outbox keeps every message instead of sending it, for development and
+// tests. When Dir is set each message is also written there as a file.
+type Outbox struct {
+	Dir string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{Dir: dir}
+}
+
+func (o *Outbox) Send(message Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, message)
+
+	if o.Dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(o.Dir, 0700); err != nil {
+		return err
+	}
+
+	data, err := format("outbox", message, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%d.eml", time.Now().UnixNano(), len(o.messages))
+
+	return os.WriteFile(filepath.Join(o.Dir, name), data, 0600)
+}
+
+// Messages returns everything sent so far
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
+
+// Last returns the latest message sent to the address
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To == to {
+			return o.messages[i], true
+		}
+	}
+
+	return Message{}, false
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// SMTPMailer sends through a relay, authenticating with PLAIN when a
+// username is set. The standard library only allows PLAIN over TLS or to
+// localhost.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (s *SMTPMailer) Send(message Message) error {
+	var auth smtp.Auth
+
+	if s.Username != "" {
+		auth = smtp.PlainAuth("", s.Username, s.Password, s.Host)
+	}
+
+	data, err := format(s.From, message, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(net.JoinHostPort(s.Host, s.Port), auth, s.From, []string{message.To}, data)
+}
+
+// format builds the RFC 5322 message sent over SMTP
+func format(from string, message Message, date time.Time) ([]byte, error) {
+	// a new line in a header would let the sender add their own headers
+	for _, header := range []string{from, message.To, message.Subject} {
+		if strings.ContainsAny(header, "\r\n") {
+			return nil, fmt.Errorf("mail: headers cannot contain new lines")
+		}
+	}
+
+	var data bytes.Buffer
+
+	fmt.Fprintf(&data, "From: %s\r\n", from)
+	fmt.Fprintf(&data, "To: %s\r\n", message.To)
+	fmt.Fprintf(&data, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", message.Subject))
+	fmt.Fprintf(&data, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	data.WriteString("MIME-Version: 1.0\r\n")
+	data.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	data.WriteString("\r\n")
+
+	// SMTP requires CRLF line endings
+	body := strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n")
+	data.WriteString(body)
+
+	return data.Bytes(), nil
+}
@@ -0,0 +1,46 @@
+package oidc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NewProvidersFromEnv discovers each provider named in OIDC_PROVIDERS, read
+// from OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID and OIDC_<NAME>_CLIENT_SECRET.
+// Callbacks are at PUBLIC_URL/auth/<name>/callback.
+func NewProvidersFromEnv(ctx context.Context) ([]Provider, error) {
+	providers := []Provider{}
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		if publicURL == "" {
+			return nil, fmt.Errorf("PUBLIC_URL: must be set for OIDC_PROVIDERS")
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		issuer := os.Getenv(prefix + "ISSUER")
+		clientID := os.Getenv(prefix + "CLIENT_ID")
+
+		if issuer == "" || clientID == "" {
+			return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID: must be set", prefix, prefix)
+		}
+
+		provider, err := Discover(ctx, name, issuer, clientID, os.Getenv(prefix+"CLIENT_SECRET"), publicURL+"/auth/"+name+"/callback")
+
+		if err != nil {
+			return nil, err
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
@@ -0,0 +1,176 @@
+package oidc
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long the browser has to come back from the provider
+const stateTTL = 10 * time.Minute
+
+// Cookie tying the callback to the browser that started the login, so nobody
+// can be logged in to someone else's account with a stolen callback link
+const stateCookie = "oidc_state"
+
+type pendingState struct {
+	Provider  string
+	Verifier  string
+	Nonce     string
+	ExpiresAt time.Time
+}
+
+// LoginFunc finishes a login once the provider has confirmed the identity
+type LoginFunc func(w http.ResponseWriter, r *http.Request, identity Identity)
+
+// ErrorFunc tells the browser the login failed
+type ErrorFunc func(w http.ResponseWriter, r *http.Request, err error)
+
+// Handler serves /auth/<provider>/login, which sends the browser to the
+// provider, and /auth/<provider>/callback, where it comes back. States only
+// live in memory, so the callback has to reach the node that sent it.
+type Handler struct {
+	Providers map[string]Provider
+	Login     LoginFunc
+
+	// Optional, a plain 400 response when nil
+	Error ErrorFunc
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+
+	mu     sync.Mutex
+	states map[string]pendingState
+}
+
+func NewHandler(login LoginFunc, providers ...Provider) *Handler {
+	handler := &Handler{
+		Providers: make(map[string]Provider),
+		Login:     login,
+		states:    make(map[string]pendingState),
+	}
+
+	for _, provider := range providers {
+		handler.Providers[provider.Name()] = provider
+	}
+
+	return handler
+}
+
+func (h *Handler) now() time.Time {
+	if h.Now != nil {
+		return h.Now()
+	}
+
+	return time.Now()
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	if len(parts) != 3 || parts[0] != "auth" {
+		http.NotFound(w, r)
+		return
+	}
+
+	provider, ok := h.Providers[parts[1]]
+
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch parts[2] {
+
+	case "login":
+		h.login(w, r, provider)
+
+	case "callback":
+		h.callback(w, r, provider)
+
+	default:
+		http.NotFound(w, r)
+
+	}
+}
+
+func (h *Handler) login(w http.ResponseWriter, r *http.Request, provider Provider) {
+	state := randomString()
+	pending := pendingState{
+		Provider:  provider.Name(),
+		Verifier:  NewCodeVerifier(),
+		Nonce:     randomString(),
+		ExpiresAt: h.now().Add(stateTTL),
+	}
+
+	h.mu.Lock()
+
+	// drop logins that were never finished
+	for key, existing := range h.states {
+		if h.now().After(existing.ExpiresAt) {
+			delete(h.states, key)
+		}
+	}
+
+	h.states[state] = pending
+	h.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     stateCookie,
+		Value:    state,
+		Path:     "/auth/",
+		MaxAge:   int(stateTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, CodeChallenge(pending.Verifier), pending.Nonce), http.StatusFound)
+}
+
+func (h *Handler) callback(w http.ResponseWriter, r *http.Request, provider Provider) {
+	query := r.URL.Query()
+	state := query.Get("state")
+
+	// a state can only be used once
+	h.mu.Lock()
+	pending, ok := h.states[state]
+	delete(h.states, state)
+	h.mu.Unlock()
+
+	cookie, err := r.Cookie(stateCookie)
+
+	if !ok || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 ||
+		pending.Provider != provider.Name() || h.now().After(pending.ExpiresAt) {
+		h.fail(w, r, ErrInvalidState)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{Name: stateCookie, Path: "/auth/", MaxAge: -1})
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.fail(w, r, fmt.Errorf("provider: %s", providerErr))
+		return
+	}
+
+	identity, err := provider.Exchange(r.Context(), query.Get("code"), pending.Verifier, pending.Nonce)
+
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	h.Login(w, r, identity)
+}
+
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if h.Error != nil {
+		h.Error(w, r, err)
+		return
+	}
+
+	http.Error(w, "login failed", http.StatusBadRequest)
+}
@@ -0,0 +1,167 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long fetched keys are used before they are fetched again
+const jwksCacheTTL = time.Hour
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet caches the signing keys of a provider, fetching them again when a
+// token uses a key it has not seen so providers can rotate keys
+type keySet struct {
+	URL    string
+	Client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func (k *keySet) key(ctx context.Context, kid string) (interface{}, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	age := time.Since(k.fetchedAt)
+
+	if ok && age < jwksCacheTTL {
+		return key, nil
+	}
+
+	// don't let unknown kids make us fetch on every request
+	if !ok && k.keys != nil && age < time.Minute {
+		return nil, fmt.Errorf("jwks: unknown key %q", kid)
+	}
+
+	keys, err := k.fetch(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	k.keys = keys
+	k.fetchedAt = time.Now()
+
+	if key, ok = keys[kid]; ok {
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("jwks: unknown key %q", kid)
+}
+
+func (k *keySet) fetch(ctx context.Context) (map[string]interface{}, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, k.URL, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := k.Client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("jwks: fetching keys returned %s", response.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+
+	if err = json.NewDecoder(response.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{})
+
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		// keys of types we cannot use are skipped
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+
+	case "RSA":
+		n, err := decodeInt(jwk.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := decodeInt(jwk.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if jwk.Crv != "P-256" {
+			return nil, fmt.Errorf("jwks: unsupported curve %q", jwk.Crv)
+		}
+
+		x, err := decodeInt(jwk.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		y, err := decodeInt(jwk.Y)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+
+	}
+
+	return nil, fmt.Errorf("jwks: unsupported key type %q", jwk.Kty)
+}
+
+func decodeInt(value string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(bytes), nil
+}
@@ -0,0 +1,58 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+)
+
+var ErrInvalidState = errors.New("state: login state is invalid or expired")
+
+// Identity is who the provider says logged in. Subject is only unique within
+// the provider.
+type Identity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+
+	// Username the user would like, may be empty or taken
+	PreferredUsername string
+}
+
+// Provider is an identity provider logged in to with the authorization code
+// flow and PKCE.
+type Provider interface {
+	Name() string
+
+	// AuthCodeURL is where the browser is sent to log in
+	AuthCodeURL(state, codeChallenge, nonce string) string
+
+	// Exchange swaps the code from the callback for the identity, checking
+	// it was issued for the nonce
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error)
+}
+
+// randomString returns a url safe random string
+func randomString() string {
+	random := make([]byte, 32)
+
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(random)
+}
+
+// NewCodeVerifier returns a PKCE code verifier (RFC 7636)
+func NewCodeVerifier() string {
+	return randomString()
+}
+
+// CodeChallenge returns the S256 challenge of the verifier
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,186 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OIDC", func() {
+
+	var stub *stubProvider
+	var conduit *httptest.Server
+	var handler *Handler
+	var browser *http.Client
+
+	// identity given to Login, or the error given to Error
+	var loggedIn *Identity
+	var loginErr error
+
+	BeforeEach(func() {
+		stub = newStubProvider()
+		loggedIn, loginErr = nil, nil
+
+		handler = NewHandler(func(w http.ResponseWriter, r *http.Request, identity Identity) {
+			loggedIn = &identity
+			w.WriteHeader(http.StatusOK)
+		})
+
+		handler.Error = func(w http.ResponseWriter, r *http.Request, err error) {
+			loginErr = err
+			w.WriteHeader(http.StatusBadRequest)
+		}
+
+		conduit = httptest.NewServer(handler)
+
+		provider, err := Discover(context.Background(), "stub", stub.Server.URL, stub.ClientID, stub.ClientSecret, conduit.URL+"/auth/stub/callback")
+		Expect(err).To(BeNil())
+
+		handler.Providers["stub"] = provider
+
+		jar, _ := cookiejar.New(nil)
+		browser = &http.Client{Jar: jar}
+	})
+
+	AfterEach(func() {
+		conduit.Close()
+		stub.Close()
+	})
+
+	It("Discover: refuses a document for another issuer", func() {
+		_, err := Discover(context.Background(), "stub", stub.Server.URL+"/other", stub.ClientID, "", "")
+		Expect(err).NotTo(BeNil())
+	})
+
+	It("Login: round trip through the provider returns the identity", func() {
+		response, err := browser.Get(conduit.URL + "/auth/stub/login")
+		Expect(err).To(BeNil())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+
+		Expect(loginErr).To(BeNil())
+		Expect(loggedIn).NotTo(BeNil())
+		Expect(*loggedIn).To(Equal(Identity{
+			Provider:          "stub",
+			Subject:           "stub-subject",
+			Email:             "someone@example.com",
+			EmailVerified:     true,
+			PreferredUsername: "someone",
+		}))
+	})
+
+	It("Login: sends PKCE and a nonce to the provider", func() {
+		response, err := (&http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}).Get(conduit.URL + "/auth/stub/login")
+		Expect(err).To(BeNil())
+
+		location := response.Header.Get("Location")
+		Expect(strings.HasPrefix(location, stub.Server.URL+"/authorize?")).To(BeTrue())
+		Expect(location).To(ContainSubstring("code_challenge_method=S256"))
+		Expect(location).To(ContainSubstring("nonce="))
+		Expect(location).To(ContainSubstring("scope=openid+email+profile"))
+	})
+
+	It("Callback: refuses an unknown state", func() {
+		browser.Get(conduit.URL + "/auth/stub/callback?state=unknown&code=code")
+
+		Expect(loggedIn).To(BeNil())
+		Expect(loginErr).To(Equal(ErrInvalidState))
+	})
+
+	It("Callback: refuses a callback from another browser", func() {
+		noRedirect := &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+
+		// the attacker starts a login and gets the callback link
+		response, err := noRedirect.Get(conduit.URL + "/auth/stub/login")
+		Expect(err).To(BeNil())
+
+		response, err = noRedirect.Get(response.Header.Get("Location"))
+		Expect(err).To(BeNil())
+
+		// the victim opens it without the state cookie
+		browser.Get(response.Header.Get("Location"))
+
+		Expect(loggedIn).To(BeNil())
+		Expect(loginErr).To(Equal(ErrInvalidState))
+	})
+
+	It("Exchange: refuses an id token for another client", func() {
+		stub.Claims["aud"] = "someone-else"
+
+		browser.Get(conduit.URL + "/auth/stub/login")
+
+		Expect(loggedIn).To(BeNil())
+		Expect(loginErr).NotTo(BeNil())
+	})
+
+	It("Exchange: accepts an audience list containing the client", func() {
+		stub.Claims["aud"] = []string{"someone-else", stub.ClientID}
+
+		browser.Get(conduit.URL + "/auth/stub/login")
+
+		Expect(loginErr).To(BeNil())
+		Expect(loggedIn).NotTo(BeNil())
+	})
+
+	It("Exchange: refuses an id token from another issuer", func() {
+		stub.Claims["iss"] = "https://evil.example.com"
+
+		browser.Get(conduit.URL + "/auth/stub/login")
+
+		Expect(loggedIn).To(BeNil())
+		Expect(loginErr).NotTo(BeNil())
+	})
+
+	It("Exchange: refuses an expired id token", func() {
+		stub.Claims["exp"] = 1
+
+		browser.Get(conduit.URL + "/auth/stub/login")
+
+		Expect(loggedIn).To(BeNil())
+		Expect(loginErr).NotTo(BeNil())
+	})
+
+	It("Exchange: refuses an id token for another nonce", func() {
+		stub.Claims["nonce"] = "replayed"
+
+		browser.Get(conduit.URL + "/auth/stub/login")
+
+		Expect(loggedIn).To(BeNil())
+		Expect(loginErr).NotTo(BeNil())
+	})
+
+	It("Callback: passes on errors from the provider", func() {
+		noRedirect := &http.Client{
+			Jar:           browser.Jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		}
+
+		response, err := noRedirect.Get(conduit.URL + "/auth/stub/login")
+		Expect(err).To(BeNil())
+
+		state := response.Header.Get("Location")
+		state = state[strings.Index(state, "state=")+len("state="):]
+		state = strings.Split(state, "&")[0]
+
+		browser.Get(conduit.URL + "/auth/stub/callback?error=access_denied&state=" + state)
+
+		Expect(loggedIn).To(BeNil())
+		Expect(loginErr).NotTo(BeNil())
+		Expect(loginErr.Error()).To(ContainSubstring("access_denied"))
+	})
+
+	It("Handler: unknown providers are not found", func() {
+		response, err := browser.Get(conduit.URL + "/auth/other/login")
+		Expect(err).To(BeNil())
+		Expect(response.StatusCode).To(Equal(http.StatusNotFound))
+	})
+
+})
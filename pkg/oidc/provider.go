@@ -0,0 +1,260 @@
+package oidc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// OIDCProvider is any OpenID Connect provider, configured from its discovery
+// document.
+type OIDCProvider struct {
+	ProviderName string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	Issuer                string
+	AuthorizationEndpoint string
+	TokenEndpoint         string
+
+	Client *http.Client
+	keys   *keySet
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Discover fetches the discovery document of the issuer
+func Discover(ctx context.Context, name, issuer, clientID, clientSecret, redirectURL string) (*OIDCProvider, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	wellKnown := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, wellKnown, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("oidc: discovery of %s returned %s", issuer, response.Status)
+	}
+
+	var document discoveryDocument
+
+	if err = json.NewDecoder(response.Body).Decode(&document); err != nil {
+		return nil, err
+	}
+
+	// the document must be for the issuer that was asked for
+	if document.Issuer != issuer {
+		return nil, fmt.Errorf("oidc: discovery issuer %q does not match %q", document.Issuer, issuer)
+	}
+
+	return &OIDCProvider{
+		ProviderName:          name,
+		ClientID:              clientID,
+		ClientSecret:          clientSecret,
+		RedirectURL:           redirectURL,
+		Scopes:                []string{"openid", "email", "profile"},
+		Issuer:                document.Issuer,
+		AuthorizationEndpoint: document.AuthorizationEndpoint,
+		TokenEndpoint:         document.TokenEndpoint,
+		Client:                client,
+		keys:                  &keySet{URL: document.JWKSURI, Client: client},
+	}, nil
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.ProviderName
+}
+
+func (p *OIDCProvider) now() time.Time {
+	if p.Now != nil {
+		return p.Now()
+	}
+
+	return time.Now()
+}
+
+func (p *OIDCProvider) AuthCodeURL(state, codeChallenge, nonce string) string {
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientID)
+	query.Set("redirect_uri", p.RedirectURL)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", codeChallenge)
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(p.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return p.AuthorizationEndpoint + separator + query.Encode()
+}
+
+type tokenResponse struct {
+	IDToken string `json:"id_token"`
+	Error   string `json:"error"`
+}
+
+type idTokenClaims struct {
+	Issuer            string   `json:"iss"`
+	Subject           string   `json:"sub"`
+	Audience          audience `json:"aud"`
+	ExpiresAt         int64    `json:"exp"`
+	Nonce             string   `json:"nonce"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+}
+
+// Valid is left to verifyIDToken, which has the expected values
+func (c *idTokenClaims) Valid() error {
+	return nil
+}
+
+// audience is either a single client id or a list of them
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+
+	var list []string
+
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	*a = list
+
+	return nil
+}
+
+func (a audience) contains(clientID string) bool {
+	for _, id := range a {
+		if id == clientID {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (Identity, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("code_verifier", codeVerifier)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.TokenEndpoint, strings.NewReader(form.Encode()))
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	request.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+
+	response, err := p.Client.Do(request)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	defer response.Body.Close()
+
+	var tokens tokenResponse
+
+	if err = json.NewDecoder(response.Body).Decode(&tokens); err != nil {
+		return Identity{}, err
+	}
+
+	if response.StatusCode != http.StatusOK || tokens.IDToken == "" {
+		return Identity{}, fmt.Errorf("oidc: token exchange failed: %s %s", response.Status, tokens.Error)
+	}
+
+	return p.verifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// verifyIDToken checks the signature, issuer, audience, expiry and nonce
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, idToken, nonce string) (Identity, error) {
+	var claims idTokenClaims
+
+	_, err := jwt.ParseWithClaims(idToken, &claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+		default:
+			return nil, fmt.Errorf("oidc: unexpected signing method %v", token.Header["alg"])
+		}
+
+		kid, _ := token.Header["kid"].(string)
+
+		return p.keys.key(ctx, kid)
+	})
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	now := p.now().Unix()
+
+	switch {
+
+	case claims.Issuer != p.Issuer:
+		return Identity{}, fmt.Errorf("oidc: id token issuer %q is not %q", claims.Issuer, p.Issuer)
+
+	case !claims.Audience.contains(p.ClientID):
+		return Identity{}, fmt.Errorf("oidc: id token was issued to another client")
+
+	case claims.ExpiresAt <= now:
+		return Identity{}, fmt.Errorf("oidc: id token has expired")
+
+	case subtle.ConstantTimeCompare([]byte(claims.Nonce), []byte(nonce)) != 1:
+		return Identity{}, fmt.Errorf("oidc: id token nonce does not match")
+
+	case claims.Subject == "":
+		return Identity{}, fmt.Errorf("oidc: id token has no subject")
+
+	}
+
+	return Identity{
+		Provider:          p.ProviderName,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     claims.EmailVerified,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
@@ -0,0 +1,148 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// stubProvider is a minimal OpenID Connect provider that logs in whoever
+// asks, checking PKCE and the client like a real one would
+type stubProvider struct {
+	Server *httptest.Server
+	Key    *rsa.PrivateKey
+
+	ClientID     string
+	ClientSecret string
+
+	// Claims added to or replacing the defaults of the next id token
+	Claims jwt.MapClaims
+
+	// code -> authorize request
+	codes map[string]url.Values
+}
+
+func newStubProvider() *stubProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		panic(err)
+	}
+
+	stub := &stubProvider{
+		Key:          key,
+		ClientID:     "conduit",
+		ClientSecret: "client-secret",
+		Claims:       jwt.MapClaims{},
+		codes:        make(map[string]url.Values),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", stub.discovery)
+	mux.HandleFunc("/jwks", stub.jwks)
+	mux.HandleFunc("/authorize", stub.authorize)
+	mux.HandleFunc("/token", stub.token)
+
+	stub.Server = httptest.NewServer(mux)
+
+	return stub
+}
+
+func (s *stubProvider) Close() {
+	s.Server.Close()
+}
+
+func (s *stubProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{
+		"issuer":                 s.Server.URL,
+		"authorization_endpoint": s.Server.URL + "/authorize",
+		"token_endpoint":         s.Server.URL + "/token",
+		"jwks_uri":               s.Server.URL + "/jwks",
+	})
+}
+
+func (s *stubProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "stub-key",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(s.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.Key.E)).Bytes()),
+		}},
+	})
+}
+
+// authorize logs the user straight in and sends them back with a code
+func (s *stubProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	if query.Get("client_id") != s.ClientID || query.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	s.codes[code] = query
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (s *stubProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	clientID, clientSecret, _ := r.BasicAuth()
+	authorize, ok := s.codes[r.Form.Get("code")]
+	delete(s.codes, r.Form.Get("code"))
+
+	if clientID != s.ClientID || clientSecret != s.ClientSecret || !ok ||
+		CodeChallenge(r.Form.Get("code_verifier")) != authorize.Get("code_challenge") ||
+		r.Form.Get("redirect_uri") != authorize.Get("redirect_uri") {
+
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":                s.Server.URL,
+		"sub":                "stub-subject",
+		"aud":                s.ClientID,
+		"exp":                time.Now().Add(time.Hour).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              authorize.Get("nonce"),
+		"email":              "someone@example.com",
+		"email_verified":     true,
+		"preferred_username": "someone",
+	}
+
+	for key, value := range s.Claims {
+		claims[key] = value
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "stub-key"
+
+	signed, err := token.SignedString(s.Key)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// NewStorageFromEnv reads STORAGE_BACKEND, "local" (default) or "s3", and
+// the settings of that backend
+func NewStorageFromEnv() (Storage, error) {
+	publicURL := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/")
+
+	switch os.Getenv("STORAGE_BACKEND") {
+
+	case "", "local":
+		dir := os.Getenv("MEDIA_DIR")
+
+		if dir == "" {
+			dir = "media"
+		}
+
+		baseURL := os.Getenv("MEDIA_BASE_URL")
+
+		if baseURL == "" {
+			baseURL = publicURL + "/media"
+		}
+
+		return LocalStorage{Dir: dir, BaseURL: baseURL}, nil
+
+	case "s3":
+		s3 := S3Storage{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+			PublicURL: os.Getenv("S3_PUBLIC_URL"),
+		}
+
+		if s3.Endpoint == "" || s3.Bucket == "" || s3.AccessKey == "" || s3.SecretKey == "" {
+			return nil, fmt.Errorf("S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY and S3_SECRET_KEY: must be set")
+		}
+
+		if s3.Region == "" {
+			s3.Region = "us-east-1"
+		}
+
+		return s3, nil
+
+	}
+
+	return nil, fmt.Errorf("STORAGE_BACKEND: %q is not local or s3", os.Getenv("STORAGE_BACKEND"))
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStorage keeps objects as files in a directory, serving them itself
+// at BaseURL. Only suitable for a single node.
+type LocalStorage struct {
+	Dir string
+
+	// Where the handler is mounted, e.g. "https://example.com/media"
+	BaseURL string
+}
+
+func (l LocalStorage) path(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", fmt.Errorf("media key: %q is not a valid key", key)
+	}
+
+	return filepath.Join(l.Dir, filepath.FromSlash(key)), nil
+}
+
+func (l LocalStorage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	file, err := l.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+
+	// Written to a temporary file first so a half written object is never
+	// served
+	temp, err := ioutil.TempFile(filepath.Dir(file), ".upload-*")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+
+	if _, err = temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+
+	if err = temp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), file)
+}
+
+func (l LocalStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	file, err := l.path(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(file)
+
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (l LocalStorage) Delete(ctx context.Context, key string) error {
+	file, err := l.path(key)
+
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (l LocalStorage) URL(key string) string {
+	return strings.TrimSuffix(l.BaseURL, "/") + "/" + key
+}
+
+// ServeHTTP serves objects by key, the handler has to be mounted with the
+// prefix of BaseURL stripped
+func (l LocalStorage) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+
+	data, err := l.Get(r.Context(), key)
+
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Only sniffed media is stored, the browser must not guess otherwise
+	w.Header().Set("Content-Type", mime.TypeByExtension(path.Ext(key)))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	w.Write(data)
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+)
+
+// Largest upload accepted by default
+const DefaultMaxSize = 5 << 20
+
+// Types media may have and the extension their keys get. The type is sniffed
+// from the content, whatever the client claims is ignored.
+var ImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+}
+
+// Media checks uploads before putting them in storage
+type Media struct {
+	Storage Storage
+	MaxSize int64
+
+	// Content type to extension of what is allowed
+	Types map[string]string
+}
+
+func NewMedia(storage Storage, maxSize int64) *Media {
+	return &Media{Storage: storage, MaxSize: maxSize, Types: ImageTypes}
+}
+
+// Sniff returns the content type of the data, if it is allowed
+func (m *Media) Sniff(data []byte) (string, error) {
+	if int64(len(data)) > m.MaxSize {
+		return "", fmt.Errorf("media size: uploads are limited to %d bytes", m.MaxSize)
+	}
+
+	if len(data) == 0 {
+		return "", fmt.Errorf("media type: upload is empty")
+	}
+
+	contentType := http.DetectContentType(data)
+
+	if _, ok := m.Types[contentType]; !ok {
+		return "", fmt.Errorf("media type: %s is not allowed", contentType)
+	}
+
+	return contentType, nil
+}
+
+// Store checks the data and puts it under a new key with the prefix
+func (m *Media) Store(ctx context.Context, prefix string, data []byte) (string, string, error) {
+	contentType, err := m.Sniff(data)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	key := NewKey(prefix, m.Types[contentType])
+
+	if err = m.Storage.Put(ctx, key, data, contentType); err != nil {
+		return "", "", err
+	}
+
+	return key, contentType, nil
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// S3Storage keeps objects in a bucket of S3 or a compatible service such as
+// MinIO. Requests use path style URLs, Endpoint/Bucket/key.
+type S3Storage struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+
+	// Where clients load objects from, a CDN or the bucket itself when empty
+	PublicURL string
+
+	Client *http.Client
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+}
+
+func (s S3Storage) objectURL(key string) (string, error) {
+	if !ValidKey(key) {
+		return "", fmt.Errorf("media key: %q is not a valid key", key)
+	}
+
+	return strings.TrimSuffix(s.Endpoint, "/") + "/" + s.Bucket + "/" + key, nil
+}
+
+func (s S3Storage) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	objectURL, err := s.objectURL(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, objectURL, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	payloadHash := emptyPayloadHash
+
+	if body != nil {
+		payloadHash = hashHex(body)
+		request.ContentLength = int64(len(body))
+	}
+
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	signV4(request, payloadHash, s.AccessKey, s.SecretKey, s.Region, "s3", now)
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return client.Do(request)
+}
+
+func (s S3Storage) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	response, err := s.do(ctx, http.MethodPut, key, data, contentType)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return s3Error(response)
+	}
+
+	return nil
+}
+
+func (s S3Storage) Get(ctx context.Context, key string) ([]byte, error) {
+	response, err := s.do(ctx, http.MethodGet, key, nil, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	if response.StatusCode != http.StatusOK {
+		return nil, s3Error(response)
+	}
+
+	return ioutil.ReadAll(response.Body)
+}
+
+func (s S3Storage) Delete(ctx context.Context, key string) error {
+	response, err := s.do(ctx, http.MethodDelete, key, nil, "")
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	// deleting a missing object succeeds on S3 anyway
+	if response.StatusCode != http.StatusNoContent && response.StatusCode != http.StatusOK {
+		return s3Error(response)
+	}
+
+	return nil
+}
+
+func (s S3Storage) URL(key string) string {
+	if s.PublicURL != "" {
+		return strings.TrimSuffix(s.PublicURL, "/") + "/" + key
+	}
+
+	objectURL, _ := s.objectURL(key)
+
+	return objectURL
+}
+
+func s3Error(response *http.Response) error {
+	body, _ := ioutil.ReadAll(io.LimitReader(response.Body, 1024))
+
+	return fmt.Errorf("s3: %s %s", response.Status, strings.TrimSpace(string(body)))
+}
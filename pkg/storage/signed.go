@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidUploadURL = errors.New("invalid: upload URL is invalid or expired")
+
+// UploadSigner makes URLs that let whoever holds them upload media over HTTP
+// for the user until they expire, for clients that would rather not send it
+// over the websocket
+type UploadSigner struct {
+	Secret []byte
+
+	// Where the upload handler is mounted, e.g. "https://example.com/upload"
+	BaseURL string
+	TTL     time.Duration
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+}
+
+func (s *UploadSigner) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+
+	return time.Now()
+}
+
+// Sign returns an upload URL for the user and purpose
+func (s *UploadSigner) Sign(owner, purpose string) string {
+	query := url.Values{}
+	query.Set("owner", owner)
+	query.Set("purpose", purpose)
+	query.Set("expires", strconv.FormatInt(s.now().Add(s.TTL).Unix(), 10))
+	query.Set("signature", s.signature(query))
+
+	return strings.TrimSuffix(s.BaseURL, "/") + "?" + query.Encode()
+}
+
+// Verify returns the user and purpose of a signed upload URL
+func (s *UploadSigner) Verify(query url.Values) (string, string, error) {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+
+	if err != nil || s.now().Unix() >= expires {
+		return "", "", ErrInvalidUploadURL
+	}
+
+	if !hmac.Equal([]byte(query.Get("signature")), []byte(s.signature(query))) {
+		return "", "", ErrInvalidUploadURL
+	}
+
+	return query.Get("owner"), query.Get("purpose"), nil
+}
+
+func (s *UploadSigner) signature(query url.Values) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	fmt.Fprintf(mac, "%s\n%s\n%s", query.Get("owner"), query.Get("purpose"), query.Get("expires"))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+var ErrNotFound = errors.New("media not found: no object with that key")
+
+// Storage keeps uploaded media such as avatars and listing images. Objects
+// are addressed by keys like "listing/3f2a...c1.jpg", which are what is stored
+// in the database, and served from URL(key).
+type Storage interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+
+	// URL clients load the object from
+	URL(key string) string
+}
+
+// NewKey returns a random key under the prefix with the extension
+func NewKey(prefix, extension string) string {
+	random := make([]byte, 16)
+
+	if _, err := rand.Read(random); err != nil {
+		panic(err)
+	}
+
+	return prefix + "/" + hex.EncodeToString(random) + extension
+}
+
+// ValidKey allows keys made of lower case letters, numbers, '.', '-', '_'
+// and '/' separated parts, so they cannot leave the storage directory or
+// need escaping in URLs
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 256 {
+		return false
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+
+		for _, char := range part {
+			if !(char >= 'a' && char <= 'z' || char >= '0' && char <= '9' || strings.ContainsRune(".-_", char)) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Size of every chunk but the last
+	DefaultChunkSize = 256 << 10
+
+	// Uploads a user can have going at once
+	DefaultMaxUploadsPerOwner = 3
+
+	// How long an upload can be resumed for
+	DefaultUploadTTL = time.Hour
+)
+
+var (
+	ErrUploadNotFound   = errors.New("upload not found: no upload with that id")
+	ErrChecksumMismatch = errors.New("checksum: data does not match the checksum")
+	ErrUploadIncomplete = errors.New("upload incomplete: chunks are missing")
+	ErrTooManyUploads   = errors.New("uploads: too many uploads in progress")
+)
+
+// UploadStatus is what a client needs to carry on with an upload
+type UploadStatus struct {
+	ID        string
+	Purpose   string
+	Size      int64
+	ChunkSize int64
+	Chunks    int
+
+	// Indexes of the chunks already received
+	Received []int
+}
+
+type upload struct {
+	UploadStatus
+	owner string
+
+	// SHA-256 of the whole file in hex
+	checksum string
+
+	file      string
+	received  map[int]bool
+	expiresAt time.Time
+}
+
+// Uploads assembles files sent in chunks. Chunks are written to a temporary
+// file, so an upload survives the socket closing and can be resumed from any
+// socket of the same user on this node.
+type Uploads struct {
+	// Where partial uploads are kept, os.TempDir() when empty
+	Dir string
+
+	MaxSize     int64
+	ChunkSize   int64
+	MaxPerOwner int
+	TTL         time.Duration
+
+	// Used in place of time.Now when set
+	Now func() time.Time
+
+	mu      sync.Mutex
+	uploads map[string]*upload
+}
+
+func NewUploads(maxSize int64) *Uploads {
+	return &Uploads{
+		MaxSize:     maxSize,
+		ChunkSize:   DefaultChunkSize,
+		MaxPerOwner: DefaultMaxUploadsPerOwner,
+		TTL:         DefaultUploadTTL,
+		uploads:     make(map[string]*upload),
+	}
+}
+
+func (u *Uploads) now() time.Time {
+	if u.Now != nil {
+		return u.Now()
+	}
+
+	return time.Now()
+}
+
+// Begin starts an upload of size bytes with the SHA-256 checksum in hex,
+// either case is accepted
+func (u *Uploads) Begin(owner, purpose string, size int64, checksum string) (UploadStatus, error) {
+	if size <= 0 {
+		return UploadStatus{}, fmt.Errorf("media type: upload is empty")
+	}
+
+	if size > u.MaxSize {
+		return UploadStatus{}, fmt.Errorf("media size: uploads are limited to %d bytes", u.MaxSize)
+	}
+
+	if decoded, err := hex.DecodeString(checksum); err != nil || len(decoded) != sha256.Size {
+		return UploadStatus{}, fmt.Errorf("checksum: must be the SHA-256 of the file in hex")
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expire()
+
+	count := 0
+	for _, existing := range u.uploads {
+		if existing.owner == owner {
+			count++
+		}
+	}
+
+	if count >= u.MaxPerOwner {
+		return UploadStatus{}, ErrTooManyUploads
+	}
+
+	file, err := ioutil.TempFile(u.Dir, "upload-*")
+
+	if err != nil {
+		return UploadStatus{}, err
+	}
+
+	defer file.Close()
+
+	if err = file.Truncate(size); err != nil {
+		os.Remove(file.Name())
+		return UploadStatus{}, err
+	}
+
+	id := make([]byte, 16)
+
+	if _, err = rand.Read(id); err != nil {
+		os.Remove(file.Name())
+		return UploadStatus{}, err
+	}
+
+	started := &upload{
+		UploadStatus: UploadStatus{
+			ID:        hex.EncodeToString(id),
+			Purpose:   purpose,
+			Size:      size,
+			ChunkSize: u.ChunkSize,
+			Chunks:    int((size + u.ChunkSize - 1) / u.ChunkSize),
+		},
+		owner:     owner,
+		checksum:  strings.ToLower(checksum),
+		file:      file.Name(),
+		received:  make(map[int]bool),
+		expiresAt: u.now().Add(u.TTL),
+	}
+
+	u.uploads[started.ID] = started
+
+	return started.status(), nil
+}
+
+// Chunk writes a chunk of the upload, sending a chunk again replaces it
+func (u *Uploads) Chunk(owner, id string, index int, checksum string, data []byte) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	current, err := u.get(owner, id)
+
+	if err != nil {
+		return err
+	}
+
+	if index < 0 || index >= current.Chunks {
+		return fmt.Errorf("upload: chunk %d is out of range", index)
+	}
+
+	expected := current.ChunkSize
+	if index == current.Chunks-1 {
+		expected = current.Size - int64(index)*current.ChunkSize
+	}
+
+	if int64(len(data)) != expected {
+		return fmt.Errorf("upload: chunk %d must be %d bytes", index, expected)
+	}
+
+	sum := sha256.Sum256(data)
+
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(strings.ToLower(checksum))) != 1 {
+		return ErrChecksumMismatch
+	}
+
+	file, err := os.OpenFile(current.file, os.O_WRONLY, 0)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.WriteAt(data, int64(index)*current.ChunkSize); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	current.received[index] = true
+
+	// an upload that is still moving is kept
+	current.expiresAt = u.now().Add(u.TTL)
+
+	return nil
+}
+
+// Status returns how far the upload got, to resume it
+func (u *Uploads) Status(owner, id string) (UploadStatus, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	current, err := u.get(owner, id)
+
+	if err != nil {
+		return UploadStatus{}, err
+	}
+
+	return current.status(), nil
+}
+
+// Commit returns the whole file and ends the upload. An upload with missing
+// chunks is kept so they can be sent, one that does not match its checksum
+// is dropped.
+func (u *Uploads) Commit(owner, id string) (UploadStatus, []byte, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	current, err := u.get(owner, id)
+
+	if err != nil {
+		return UploadStatus{}, nil, err
+	}
+
+	if len(current.received) != current.Chunks {
+		return UploadStatus{}, nil, ErrUploadIncomplete
+	}
+
+	data, err := ioutil.ReadFile(current.file)
+
+	u.remove(current)
+
+	if err != nil {
+		return UploadStatus{}, nil, err
+	}
+
+	sum := sha256.Sum256(data)
+
+	if subtle.ConstantTimeCompare([]byte(hex.EncodeToString(sum[:])), []byte(current.checksum)) != 1 {
+		return UploadStatus{}, nil, ErrChecksumMismatch
+	}
+
+	return current.status(), data, nil
+}
+
+// Abort drops the upload
+func (u *Uploads) Abort(owner, id string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	current, err := u.get(owner, id)
+
+	if err != nil {
+		return err
+	}
+
+	u.remove(current)
+
+	return nil
+}
+
+// Cleanup drops uploads that were left too long
+func (u *Uploads) Cleanup() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.expire()
+}
+
+func (u *Uploads) get(owner, id string) (*upload, error) {
+	current, ok := u.uploads[id]
+
+	// someone else's upload is treated as missing
+	if !ok || current.owner != owner || !u.now().Before(current.expiresAt) {
+		return nil, ErrUploadNotFound
+	}
+
+	return current, nil
+}
+
+func (u *Uploads) remove(current *upload) {
+	delete(u.uploads, current.ID)
+	os.Remove(current.file)
+}
+
+func (u *Uploads) expire() {
+	for _, existing := range u.uploads {
+		if !u.now().Before(existing.expiresAt) {
+			u.remove(existing)
+		}
+	}
+}
+
+func (current *upload) status() UploadStatus {
+	status := current.UploadStatus
+	status.Received = []int{}
+
+	for index := 0; index < current.Chunks; index++ {
+		if current.received[index] {
+			status.Received = append(status.Received, index)
+		}
+	}
+
+	return status
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])
+}
+
+var _ = Describe("Uploads", func() {
+
+	var dir string
+	var now time.Time
+	var uploads *Uploads
+
+	// 10 bytes in chunks of 4, 4 and 2
+	file := []byte("0123456789")
+
+	BeforeEach(func() {
+		dir, _ = ioutil.TempDir("", "uploads")
+		now = time.Now()
+
+		uploads = NewUploads(1024)
+		uploads.Dir = dir
+		uploads.ChunkSize = 4
+		uploads.Now = func() time.Time { return now }
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	send := func(id string, index int) error {
+		end := (index + 1) * 4
+		if end > len(file) {
+			end = len(file)
+		}
+
+		chunk := file[index*4 : end]
+
+		return uploads.Chunk("some-user", id, index, checksum(chunk), chunk)
+	}
+
+	It("Commit: chunks in any order make the file", func() {
+		status, err := uploads.Begin("some-user", "avatar", int64(len(file)), checksum(file))
+		Expect(err).To(BeNil())
+		Expect(status.Chunks).To(Equal(3))
+
+		Expect(send(status.ID, 2)).To(BeNil())
+		Expect(send(status.ID, 0)).To(BeNil())
+		Expect(send(status.ID, 1)).To(BeNil())
+
+		committed, data, err := uploads.Commit("some-user", status.ID)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(file))
+		Expect(committed.Purpose).To(Equal("avatar"))
+
+		_, err = uploads.Status("some-user", status.ID)
+		Expect(err).To(Equal(ErrUploadNotFound), "Committed upload should be gone")
+	})
+
+	It("Checksum: upper-case hex is accepted", func() {
+		status, err := uploads.Begin("some-user", "avatar", int64(len(file)), strings.ToUpper(checksum(file)))
+		Expect(err).To(BeNil())
+
+		for index := 0; index < status.Chunks; index++ {
+			end := (index + 1) * 4
+			if end > len(file) {
+				end = len(file)
+			}
+
+			chunk := file[index*4 : end]
+
+			Expect(uploads.Chunk("some-user", status.ID, index, strings.ToUpper(checksum(chunk)), chunk)).To(BeNil())
+		}
+
+		_, data, err := uploads.Commit("some-user", status.ID)
+		Expect(err).To(BeNil())
+		Expect(data).To(Equal(file))
+	})
+
+	It("Status: lists received chunks to resume from", func() {
+		status, _ := uploads.Begin("some-user", "avatar", int64(len(file)), checksum(file))
+
+		send(status.ID, 0)
+		send(status.ID, 2)
+
+		status, err := uploads.Status("some-user", status.ID)
+		Expect(err).To(BeNil())
+		Expect(status.Received).To(Equal([]int{0, 2}))
+
+		_, _, err = uploads.Commit("some-user", status.ID)
+		Expect(err).To(Equal(ErrUploadIncomplete))
+
+		Expect(send(status.ID, 1)).To(BeNil(), "Upload should be kept after an early commit")
+
+		_, _, err = uploads.Commit("some-user", status.ID)
+		Expect(err).To(BeNil())
+	})
+
+	It("Chunk: refuses a chunk that does not match its checksum", func() {
+		status, _ := uploads.Begin("some-user", "avatar", int64(len(file)), checksum(file))
+
+		err := uploads.Chunk("some-user", status.ID, 0, checksum([]byte("0123")), []byte("0124"))
+		Expect(err).To(Equal(ErrChecksumMismatch))
+	})
+
+	It("Chunk: refuses chunks of the wrong size or index", func() {
+		status, _ := uploads.Begin("some-user", "avatar", int64(len(file)), checksum(file))
+
+		Expect(uploads.Chunk("some-user", status.ID, 0, checksum([]byte("012")), []byte("012"))).NotTo(BeNil())
+		Expect(uploads.Chunk("some-user", status.ID, 3, checksum([]byte("89")), []byte("89"))).NotTo(BeNil())
+	})
+
+	It("Commit: refuses a file that does not match its checksum", func() {
+		status, _ := uploads.Begin("some-user", "avatar", int64(len(file)), checksum([]byte("another file")))
+
+		send(status.ID, 0)
+		send(status.ID, 1)
+		send(status.ID, 2)
+
+		_, _, err := uploads.Commit("some-user", status.ID)
+		Expect(err).To(Equal(ErrChecksumMismatch))
+	})
+
+	It("Owner: uploads of other users cannot be touched", func() {
+		status, _ := uploads.Begin("some-user", "avatar", int64(len(file)), checksum(file))
+
+		Expect(uploads.Chunk("another-user", status.ID, 0, checksum(file[:4]), file[:4])).To(Equal(ErrUploadNotFound))
+		Expect(uploads.Abort("another-user", status.ID)).To(Equal(ErrUploadNotFound))
+	})
+
+	It("Begin: limits uploads per user and size", func() {
+		for i := 0; i < DefaultMaxUploadsPerOwner; i++ {
+			_, err := uploads.Begin("some-user", "avatar", 10, checksum(file))
+			Expect(err).To(BeNil())
+		}
+
+		_, err := uploads.Begin("some-user", "avatar", 10, checksum(file))
+		Expect(err).To(Equal(ErrTooManyUploads))
+
+		_, err = uploads.Begin("another-user", "avatar", 10, checksum(file))
+		Expect(err).To(BeNil(), "Other users have their own limit")
+
+		_, err = uploads.Begin("another-user", "avatar", 2048, checksum(file))
+		Expect(err).NotTo(BeNil(), "Should refuse uploads over the size limit")
+	})
+
+	It("Expiry: abandoned uploads are dropped with their file", func() {
+		status, _ := uploads.Begin("some-user", "avatar", int64(len(file)), checksum(file))
+
+		now = now.Add(DefaultUploadTTL + time.Minute)
+		uploads.Cleanup()
+
+		_, err := uploads.Status("some-user", status.ID)
+		Expect(err).To(Equal(ErrUploadNotFound))
+
+		files, _ := ioutil.ReadDir(dir)
+		Expect(files).To(BeEmpty())
+	})
+
+	It("Abort: removes the upload", func() {
+		status, _ := uploads.Begin("some-user", "avatar", int64(len(file)), checksum(file))
+
+		Expect(uploads.Abort("some-user", status.ID)).To(BeNil())
+
+		files, _ := ioutil.ReadDir(dir)
+		Expect(files).To(BeEmpty())
+	})
+
+})
@@ -0,0 +1,255 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How often the certificate files are checked for changes by default
+const DefaultReloadInterval = 30 * time.Second
+
+type Config struct {
+	CertFile string
+	KeyFile  string
+
+	// "1.2" or "1.3", defaults to "1.2"
+	MinVersion string
+
+	// IANA names as returned by tls.CipherSuites, empty keeps Go's defaults
+	CipherSuites []string
+
+	// When set, client certificates signed by this CA are verified
+	ClientCAFile string
+
+	// Refuse connections without a client certificate, otherwise they are optional
+	RequireClientCert bool
+
+	ReloadInterval time.Duration
+}
+
+// Build returns a server tls.Config whose certificate is served by the
+// returned reloader.
+func (c Config) Build() (*tls.Config, *CertReloader, error) {
+	minVersion, err := parseVersion(c.MinVersion)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cipherSuites, err := parseCipherSuites(c.CipherSuites)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reloader, err := NewCertReloader(c.CertFile, c.KeyFile)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if c.ReloadInterval > 0 {
+		reloader.Interval = c.ReloadInterval
+	}
+
+	config := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: reloader.GetCertificate,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		pool := x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+
+		if c.RequireClientCert {
+			config.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return config, reloader, nil
+}
+
+func parseVersion(version string) (uint16, error) {
+	switch strings.TrimSpace(version) {
+
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+
+	case "1.3":
+		return tls.VersionTLS13, nil
+
+	}
+
+	return 0, fmt.Errorf("unsupported minimum tls version %q", version)
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+
+	// insecure suites are left out on purpose
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	suites := []uint16{}
+
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+
+		if name == "" {
+			continue
+		}
+
+		id, ok := known[name]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %q", name)
+		}
+
+		suites = append(suites, id)
+	}
+
+	if len(suites) == 0 {
+		return nil, nil
+	}
+
+	return suites, nil
+}
+
+// CertReloader serves a certificate pair and reloads it when either file
+// changes on disk, so certificates can be renewed without a restart.
+type CertReloader struct {
+	CertFile string
+	KeyFile  string
+	Interval time.Duration
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	modified time.Time
+}
+
+func NewCertReloader(certFile, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		CertFile: certFile,
+		KeyFile:  keyFile,
+		Interval: DefaultReloadInterval,
+	}
+
+	if err := reloader.Reload(); err != nil {
+		return nil, err
+	}
+
+	return reloader, nil
+}
+
+// lastModified returns the newest modification time of the two files
+func (r *CertReloader) lastModified() (time.Time, error) {
+	certInfo, err := os.Stat(r.CertFile)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	keyInfo, err := os.Stat(r.KeyFile)
+
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	if keyInfo.ModTime().After(certInfo.ModTime()) {
+		return keyInfo.ModTime(), nil
+	}
+
+	return certInfo.ModTime(), nil
+}
+
+// Reload reads the pair from disk, the current certificate is kept on error
+func (r *CertReloader) Reload() error {
+	modified, err := r.lastModified()
+
+	if err != nil {
+		return err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.CertFile, r.KeyFile)
+
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.modified = modified
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.cert, nil
+}
+
+// Watch polls the files until stop is closed
+func (r *CertReloader) Watch(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if _, err := r.ReloadIfChanged(); err != nil {
+				log.Printf("tls: could not reload certificate: %v", err)
+			}
+
+		case <-stop:
+			return
+		}
+	}
+}
+
+// ReloadIfChanged reloads the pair if a file is newer than the one served
+func (r *CertReloader) ReloadIfChanged() (bool, error) {
+	modified, err := r.lastModified()
+
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := !modified.After(r.modified)
+	r.mu.RUnlock()
+
+	if unchanged {
+		return false, nil
+	}
+
+	if err = r.Reload(); err != nil {
+		return false, err
+	}
+
+	log.Printf("tls: reloaded certificate from %s", r.CertFile)
+
+	return true, nil
+}
@@ -0,0 +1,145 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// writeCert creates a self signed certificate for commonName
+func writeCert(certFile, keyFile, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	Expect(err).To(BeNil())
+
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	Expect(err).To(BeNil())
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	Expect(err).To(BeNil())
+
+	Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)).To(BeNil())
+	Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)).To(BeNil())
+}
+
+func commonName(cert *tls.Certificate) string {
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	Expect(err).To(BeNil())
+
+	return parsed.Subject.CommonName
+}
+
+var _ = Describe("TLS Config", func() {
+
+	var dir string
+	var certFile string
+	var keyFile string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = os.MkdirTemp("", "tlsconfig")
+		Expect(err).To(BeNil())
+
+		certFile = filepath.Join(dir, "cert.pem")
+		keyFile = filepath.Join(dir, "key.pem")
+
+		writeCert(certFile, keyFile, "first")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("Build: defaults to TLS 1.2", func() {
+		config, _, err := Config{CertFile: certFile, KeyFile: keyFile}.Build()
+
+		Expect(err).To(BeNil())
+		Expect(config.MinVersion).To(Equal(uint16(tls.VersionTLS12)))
+		Expect(config.ClientAuth).To(Equal(tls.NoClientCert))
+	})
+
+	It("Build: unknown version and cipher are rejected", func() {
+		_, _, err := Config{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"}.Build()
+		Expect(err).ToNot(BeNil(), "TLS 1.0 should not be allowed")
+
+		_, _, err = Config{CertFile: certFile, KeyFile: keyFile, CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}}.Build()
+		Expect(err).ToNot(BeNil(), "Insecure cipher should not be allowed")
+	})
+
+	It("Build: cipher suites are looked up by name", func() {
+		config, _, err := Config{
+			CertFile:     certFile,
+			KeyFile:      keyFile,
+			CipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+		}.Build()
+
+		Expect(err).To(BeNil())
+		Expect(config.CipherSuites).To(Equal([]uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256}))
+	})
+
+	It("Build: client CA enables mutual TLS", func() {
+		config, _, err := Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile}.Build()
+		Expect(err).To(BeNil())
+		Expect(config.ClientAuth).To(Equal(tls.VerifyClientCertIfGiven))
+
+		config, _, err = Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: certFile, RequireClientCert: true}.Build()
+		Expect(err).To(BeNil())
+		Expect(config.ClientAuth).To(Equal(tls.RequireAndVerifyClientCert))
+	})
+
+	It("Reload: new certificate is served after the files change", func() {
+		reloader, err := NewCertReloader(certFile, keyFile)
+		Expect(err).To(BeNil())
+
+		cert, _ := reloader.GetCertificate(nil)
+		Expect(commonName(cert)).To(Equal("first"))
+
+		changed, err := reloader.ReloadIfChanged()
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeFalse(), "Unchanged files should not reload")
+
+		writeCert(certFile, keyFile, "second")
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(certFile, later, later)
+
+		changed, err = reloader.ReloadIfChanged()
+		Expect(err).To(BeNil())
+		Expect(changed).To(BeTrue())
+
+		cert, _ = reloader.GetCertificate(nil)
+		Expect(commonName(cert)).To(Equal("second"))
+	})
+
+	It("Reload: broken files keep the current certificate", func() {
+		reloader, err := NewCertReloader(certFile, keyFile)
+		Expect(err).To(BeNil())
+
+		Expect(os.WriteFile(keyFile, []byte("garbage"), 0600)).To(BeNil())
+		later := time.Now().Add(time.Minute)
+		os.Chtimes(keyFile, later, later)
+
+		_, err = reloader.ReloadIfChanged()
+		Expect(err).ToNot(BeNil())
+
+		cert, _ := reloader.GetCertificate(nil)
+		Expect(commonName(cert)).To(Equal("first"))
+	})
+
+})
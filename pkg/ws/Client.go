@@ -3,10 +3,15 @@ package ws
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/storage"
 	ws "go-websocket/pkg/ws/messages"
 	"log"
+	"net"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -22,18 +27,72 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Room in a text message for the command, ids, tokens and a password
+	// around any text from the content rules, the smallest read limit.
+	maxEnvelopeSize = 4096
+
+	// Most bytes a character of text can take in JSON, escaped as \uXXXX.
+	maxBytesPerChar = 6
+
+	// Largest binary message with a chunk of an upload.
+	maxChunkSize = storage.DefaultChunkSize
+
+	// Longest password accepted at login, bounds the cost of hashing.
+	maxPasswordLength = 1024
+
+	// How long before the access token expires the client is told to refresh.
+	expiryNoticeBefore = time.Minute
+
+	// How long a login waiting for a 2FA code lasts and how many codes it
+	// can try, after that the password has to be sent again.
+	pendingLoginTTL         = 5 * time.Minute
+	maxPendingLoginAttempts = 5
 
 	// Response codes
-	SUCCESS          byte = 0
-	EMAIL_IN_USE     byte = 1
-	EMAIL_INVALID    byte = 2
-	PASSWORD_INVALID byte = 3
-	USERAME_IN_USE   byte = 4
-	USERAME_INVALID  byte = 5
-	UNKNOWN          byte = 6
-	INVALID_LOGIN    byte = 7
+	SUCCESS             byte = 0
+	EMAIL_IN_USE        byte = 1
+	EMAIL_INVALID       byte = 2
+	PASSWORD_INVALID    byte = 3
+	USERAME_IN_USE      byte = 4
+	USERAME_INVALID     byte = 5
+	UNKNOWN             byte = 6
+	INVALID_LOGIN       byte = 7
+	TOO_MANY_ATTEMPTS   byte = 8
+	ACCOUNT_LOCKED      byte = 9
+	INVALID_TOKEN       byte = 10
+	TOKEN_REUSED        byte = 11
+	NOT_LOGGED_IN       byte = 12
+	SESSION_NOT_FOUND   byte = 13
+	EMAIL_NOT_VERIFIED  byte = 14
+	USERNAME_COOLDOWN   byte = 15
+	TWO_FACTOR_REQUIRED byte = 16
+	INVALID_CODE        byte = 17
+	TWO_FACTOR_STATE    byte = 18
+	PROFILE_INVALID     byte = 19
+	PROFILE_NOT_FOUND   byte = 20
+	MEDIA_INVALID       byte = 21
+	MEDIA_TOO_LARGE     byte = 22
+	LISTING_NOT_FOUND   byte = 23
+	UPLOAD_NOT_FOUND    byte = 24
+	CHECKSUM_MISMATCH   byte = 25
+	TOO_MANY_UPLOADS    byte = 26
+	UPLOAD_INCOMPLETE   byte = 27
+	QUOTA_EXCEEDED      byte = 28
+	BLOCKED             byte = 29
+	REPORT_INVALID      byte = 30
+	REPORT_NOT_FOUND    byte = 31
+	NOT_MODERATOR       byte = 32
+	ACCOUNT_SUSPENDED   byte = 33
+	CONTENT_INVALID     byte = 34
+	CONTENT_TOO_LONG    byte = 35
+	CONTENT_BANNED      byte = 36
+	CONTENT_LINKS       byte = 37
+	MESSAGE_NOT_FOUND   byte = 38
+	EDIT_WINDOW_CLOSED  byte = 39
+	GROUP_NOT_FOUND     byte = 40
+	NOT_GROUP_ADMIN     byte = 41
+	GROUP_INVALID       byte = 42
+	RATING_INVALID      byte = 43
 )
 
 var (
@@ -44,7 +103,6 @@ var (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin:     func(r *http.Request) bool { return true },
 }
 
 // Client is a middleman between the websocket connection and the hub.
@@ -57,11 +115,37 @@ type Client struct {
 	// Buffered channel of outbound messages.
 	Send chan []byte
 
-	// Http connection
-	Web http.ResponseWriter
+	// Expiry of the access token the socket is logged in with.
+	TokenExpiry chan int64
+
+	// Random identifier used to link the socket to a username
+	ID string
+
+	// Address of the peer, used to limit failed logins
+	IP string
+
+	// Device of the peer, shown when listing sessions
+	UserAgent string
 
 	// DB Proxy
 	DB *WebDataProxy
+
+	// Login waiting for a 2FA code, only used by readPump
+	pendingLogin *pendingLogin
+
+	// Largest text message read from the peer, set by readPump
+	readLimit int64
+
+	// Held while writing, readPump replies while writePump sends
+	writeMu sync.Mutex
+}
+
+// pendingLogin is a correct password still waiting for a 2FA code
+type pendingLogin struct {
+	Username  string
+	Email     string
+	ExpiresAt time.Time
+	Attempts  int
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -73,9 +157,14 @@ func (c *Client) readPump() {
 	defer func() {
 		c.Hub.Unregister <- c
 		c.Conn.Close()
+
+		// the socket may never have logged in
+		(*c.DB).LogoutID(c.ID)
 	}()
 
-	c.Conn.SetReadLimit(maxMessageSize)
+	c.readLimit = (*c.DB).MaxMessageSize()
+
+	c.Conn.SetReadLimit(c.readLimit)
 	c.Conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.Conn.SetPongHandler(func(string) error { c.Conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 
@@ -98,82 +187,73 @@ func (c *Client) readPump() {
 			var loginDetails ws.Login
 			json.Unmarshal(jsonData, &loginDetails)
 
-			// Check email
-			if !IsValid(loginDetails.Email) {
+			result := ws.LoginResult{
+				BaseMessage: ws.BaseMessage{
+					Command: "loginResult",
+				},
+				ResponseCode: INVALID_LOGIN,
+			}
 
-				// sent invalid message back to the user
-				result := ws.RegistrationResult{
-					BaseMessage: ws.BaseMessage{
-						Command: "regResult",
-					},
-					ResponseCode: INVALID_LOGIN,
-				}
+			// Check email & password, the password policy is not applied so
+			// it can change without locking anyone out
+			if !IsValid(loginDetails.Email) || loginDetails.Password == "" || len(loginDetails.Password) > maxPasswordLength {
 
 				returnJSON, _ := json.Marshal(result)
 
-				if err = c.Conn.WriteMessage(msgType, returnJSON); err != nil {
+				if err = c.write(msgType, returnJSON); err != nil {
 					return
 				}
 
-				// don't do any more checks -> email should have been checked on frontend
+				// don't do any more checks -> should have been checked on frontend
 				continue
 			}
 
-			// Check password
-			if !IsValidPassword(loginDetails.Password) {
-				// sent invalid message back to the user
-				result := ws.RegistrationResult{
-					BaseMessage: ws.BaseMessage{
-						Command: "regResult",
-					},
-					ResponseCode: INVALID_LOGIN,
+			// Check the login
+			username, err := (*c.DB).CheckLogin(&loginDetails.Email, &loginDetails.Password, c.IP)
+
+			// The password was right but a code is needed, the socket
+			// waits for verify2fa
+			if errors.Is(err, auth.ErrTwoFactorRequired) {
+				c.pendingLogin = &pendingLogin{
+					Username:  username,
+					Email:     loginDetails.Email,
+					ExpiresAt: time.Now().Add(pendingLoginTTL),
 				}
 
-				returnJSON, _ := json.Marshal(result)
+				result.ResponseCode = TWO_FACTOR_REQUIRED
 
-				if err = c.Conn.WriteMessage(msgType, returnJSON); err != nil {
+				if err = c.reply(msgType, result); err != nil {
 					return
 				}
 
-				// don't do any more checks -> email should have been checked on frontend
 				continue
 			}
 
-			// Check the login
-			username, err := (*c.DB).CheckLogin(&loginDetails.Email, &loginDetails.Password)
-
-			expirationTime := time.Now().Add(24 * time.Hour)
-			token, _ := CreateToken(username, expirationTime)
-
-			// Add the HTTP cookie to the clients cookie list
-			http.SetCookie(c.Web, &http.Cookie{
-				Name:     "token",
-				Value:    token,
-				Expires:  expirationTime,
-				Path:     "/",
-				HttpOnly: true,
-			})
+			if err != nil {
+				var lockoutErr *auth.LockoutError
+
+				if errors.As(err, &lockoutErr) {
+					result.ResponseCode = TOO_MANY_ATTEMPTS
+					if lockoutErr.Locked {
+						result.ResponseCode = ACCOUNT_LOCKED
+					}
+
+					// round up so clients never retry early
+					result.RetryAfter = int64((lockoutErr.RetryAfter + time.Second - 1) / time.Second)
+				} else if errorCode(err) == ACCOUNT_SUSPENDED {
+					result.ResponseCode = ACCOUNT_SUSPENDED
+				}
 
-			// Message to tell the client that is was a success
-			result := ws.LoginResult{
-				BaseMessage: ws.BaseMessage{
-					Command: "loginResult",
-				},
-				Result:   true,
-				Username: username,
-			}
+				returnJSON, _ := json.Marshal(result)
 
-			// Convert object to json
-			resultJson, err := json.Marshal(result)
+				if err = c.write(msgType, returnJSON); err != nil {
+					return
+				}
 
-			if err != nil {
-				return
+				continue
 			}
 
-			if err = c.Conn.WriteMessage(msgType, resultJson); err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("error: %v", err)
-				}
+			if err = c.completeLogin(msgType, username); err != nil {
 				return
 			}
 
@@ -206,27 +286,7 @@ func (c *Client) readPump() {
 
 				returnJSON, _ := json.Marshal(result)
 
-				if err = c.Conn.WriteMessage(msgType, returnJSON); err != nil {
-					return
-				}
-
-				// don't do any more checks -> email should have been checked on frontend
-				continue
-			}
-
-			// Check password
-			if !IsValidPassword(reg.Password) {
-				// sent invalid message back to the user
-				result := ws.RegistrationResult{
-					BaseMessage: ws.BaseMessage{
-						Command: "regResult",
-					},
-					ResponseCode: PASSWORD_INVALID,
-				}
-
-				returnJSON, _ := json.Marshal(result)
-
-				if err = c.Conn.WriteMessage(msgType, returnJSON); err != nil {
+				if err = c.write(msgType, returnJSON); err != nil {
 					return
 				}
 
@@ -234,12 +294,14 @@ func (c *Client) readPump() {
 				continue
 			}
 
-			// Create the profile from parameters
+			// Create the profile from parameters, the password policy is
+			// checked by the proxy
 			err = (*c.DB).CreateProfile(&reg.Username, &reg.Email, &reg.Password)
 
 			if err != nil {
 				// by default it is unknown
 				var errorCode byte = UNKNOWN
+				var reasons []string
 
 				// extract the error being referenced from message
 				errorType := strings.Split(err.Error(), ":")[0]
@@ -252,6 +314,14 @@ func (c *Client) readPump() {
 				case "username":
 					errorCode = USERAME_IN_USE
 
+				case "password":
+					errorCode = PASSWORD_INVALID
+
+					var policyErr *auth.PolicyError
+					if errors.As(err, &policyErr) {
+						reasons = policyErr.Reasons
+					}
+
 				}
 
 				result := ws.RegistrationResult{
@@ -259,11 +329,12 @@ func (c *Client) readPump() {
 						Command: "regResult",
 					},
 					ResponseCode: errorCode,
+					Reasons:      reasons,
 				}
 
 				returnJSON, _ := json.Marshal(result)
 
-				if err = c.Conn.WriteMessage(msgType, returnJSON); err != nil {
+				if err = c.write(msgType, returnJSON); err != nil {
 					return
 				}
 
@@ -271,96 +342,481 @@ func (c *Client) readPump() {
 
 			}
 
-			expirationTime := time.Now().Add(24 * time.Hour)
-			token, _ := CreateToken(reg.Username, expirationTime)
+			tokens, err := (*c.DB).IssueTokens(reg.Username, c.UserAgent, c.IP)
 
-			http.SetCookie(c.Web, &http.Cookie{
-				Name:     "token",
-				Value:    token,
-				Expires:  expirationTime,
-				HttpOnly: true,
-			})
+			if err != nil {
+				return
+			}
+
+			if err = c.bind(reg.Username, tokens.SessionID, tokens.ExpiresAt); err != nil {
+				return
+			}
 
 			result := ws.RegistrationResult{
 				BaseMessage: ws.BaseMessage{
 					Command: "regResult",
 				},
 				ResponseCode: SUCCESS,
+				TokenPair:    tokens,
 			}
 
 			returnJSON, _ := json.Marshal(result)
-			if err = c.Conn.WriteMessage(msgType, returnJSON); err != nil {
+			if err = c.write(msgType, returnJSON); err != nil {
 				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 					log.Printf("error: %v", err)
 				}
 				return
 			}
 
+		case "refreshToken":
+			_, jsonData, err := c.Conn.ReadMessage()
+
+			if err != nil {
+				return
+			}
+
+			var refresh ws.Refresh
+			json.Unmarshal(jsonData, &refresh)
+
+			result := ws.RefreshResult{
+				BaseMessage: ws.BaseMessage{
+					Command: "refreshResult",
+				},
+				ResponseCode: INVALID_TOKEN,
+			}
+
+			username, tokens, err := (*c.DB).RefreshTokens(refresh.RefreshToken, c.UserAgent, c.IP)
+
+			switch {
+
+			case errors.Is(err, auth.ErrRefreshReused):
+				result.ResponseCode = TOKEN_REUSED
+
+			case err == nil:
+				// the socket may have been opened with an expired token
+				if err = c.bind(username, tokens.SessionID, tokens.ExpiresAt); err != nil {
+					return
+				}
+
+				result.ResponseCode = SUCCESS
+				result.Username = username
+				result.TokenPair = tokens
+
+			}
+
+			returnJSON, _ := json.Marshal(result)
+
+			if err = c.write(msgType, returnJSON); err != nil {
+				return
+			}
+
+		case "logout":
+			if err = c.logout(msgType); err != nil {
+				return
+			}
+
+		case "listSessions":
+			if err = c.listSessions(msgType); err != nil {
+				return
+			}
+
+		case "revokeSession":
+			if err = c.revokeSession(msgType); err != nil {
+				return
+			}
+
+		case "requestPasswordReset":
+			if err = c.requestPasswordReset(msgType); err != nil {
+				return
+			}
+
+		case "resetPassword":
+			if err = c.resetPassword(msgType); err != nil {
+				return
+			}
+
+		case "verifyEmail":
+			if err = c.verifyEmail(msgType); err != nil {
+				return
+			}
+
+		case "resendVerification":
+			if err = c.resendVerification(msgType); err != nil {
+				return
+			}
+
+		case "changePassword":
+			if err = c.changePassword(msgType); err != nil {
+				return
+			}
+
+		case "changeEmail":
+			if err = c.changeEmail(msgType); err != nil {
+				return
+			}
+
+		case "changeUsername":
+			if err = c.changeUsername(msgType); err != nil {
+				return
+			}
+
+		case "verify2fa":
+			if err = c.verifyTwoFactor(msgType); err != nil {
+				return
+			}
+
+		case "enable2fa":
+			if err = c.enableTwoFactor(msgType); err != nil {
+				return
+			}
+
+		case "confirm2fa":
+			if err = c.confirmTwoFactor(msgType); err != nil {
+				return
+			}
+
+		case "disable2fa":
+			if err = c.disableTwoFactor(msgType); err != nil {
+				return
+			}
+
+		case "getProfile":
+			if err = c.getProfile(msgType); err != nil {
+				return
+			}
+
+		case "updateProfile":
+			if err = c.updateProfile(msgType); err != nil {
+				return
+			}
+
+		case "rateSeller":
+			if err = c.rateSeller(msgType); err != nil {
+				return
+			}
+
+		case "uploadMedia":
+			if err = c.uploadMedia(msgType); err != nil {
+				return
+			}
+
+		case "uploadURL":
+			if err = c.uploadURL(msgType); err != nil {
+				return
+			}
+
+		case "uploadBegin":
+			if err = c.uploadBegin(msgType); err != nil {
+				return
+			}
+
+		case "uploadChunk":
+			if err = c.uploadChunk(msgType); err != nil {
+				return
+			}
+
+		case "uploadStatus":
+			if err = c.uploadStatus(msgType); err != nil {
+				return
+			}
+
+		case "uploadCommit":
+			if err = c.uploadCommit(msgType); err != nil {
+				return
+			}
+
+		case "uploadAbort":
+			if err = c.uploadAbort(msgType); err != nil {
+				return
+			}
+
+		case "uploadListing":
+			if err = c.uploadListing(msgType); err != nil {
+				return
+			}
+
+		case "getListing":
+			if err = c.getListing(msgType); err != nil {
+				return
+			}
+
+		case "sendMessage":
+			if err = c.sendMessage(msgType); err != nil {
+				return
+			}
+
+		case "editMessage":
+			if err = c.editMessage(msgType); err != nil {
+				return
+			}
+
+		case "deleteMessage":
+			if err = c.deleteMessage(msgType); err != nil {
+				return
+			}
+
+		case "getMessages":
+			if err = c.getMessages(msgType); err != nil {
+				return
+			}
+
+		case "getContacts":
+			if err = c.getContacts(msgType); err != nil {
+				return
+			}
+
+		case "createGroup":
+			if err = c.createGroup(msgType); err != nil {
+				return
+			}
+
+		case "addMember":
+			if err = c.addMember(msgType); err != nil {
+				return
+			}
+
+		case "removeMember":
+			if err = c.removeMember(msgType); err != nil {
+				return
+			}
+
+		case "leaveGroup":
+			if err = c.leaveGroup(msgType); err != nil {
+				return
+			}
+
+		case "getGroup":
+			if err = c.getGroup(msgType); err != nil {
+				return
+			}
+
+		case "listGroups":
+			if err = c.listGroups(msgType); err != nil {
+				return
+			}
+
+		case "sendGroupMessage":
+			if err = c.sendGroupMessage(msgType); err != nil {
+				return
+			}
+
+		case "getGroupMessages":
+			if err = c.getGroupMessages(msgType); err != nil {
+				return
+			}
+
+		case "blockUser":
+			if err = c.blockUser(msgType); err != nil {
+				return
+			}
+
+		case "unblockUser":
+			if err = c.unblockUser(msgType); err != nil {
+				return
+			}
+
+		case "listBlocked":
+			if err = c.listBlocked(msgType); err != nil {
+				return
+			}
+
+		case "report":
+			if err = c.report(msgType); err != nil {
+				return
+			}
+
+		case "listReports":
+			if err = c.listReports(msgType); err != nil {
+				return
+			}
+
+		case "getReport":
+			if err = c.getReport(msgType); err != nil {
+				return
+			}
+
+		case "moderate":
+			if err = c.moderate(msgType); err != nil {
+				return
+			}
+
+		case "unlockAccount":
+			if err = c.unlockAccount(msgType); err != nil {
+				return
+			}
+
 		}
 
 	}
 }
 
+// notifyTokenExpiry tells writePump when the access token of the socket
+// expires, replacing any earlier time
+func (c *Client) notifyTokenExpiry(expiresAt int64) {
+	select {
+	case <-c.TokenExpiry:
+	default:
+	}
+
+	select {
+	case c.TokenExpiry <- expiresAt:
+	default:
+	}
+}
+
 // writePump pumps messages from the hub to the websocket connection.
 //
-// A goroutine running writePump is started for each connection. The
-// application ensures that there is at most one writer to a connection by
-// executing all writes from this goroutine.
+// A goroutine running writePump is started for each connection. readPump
+// also replies on the connection, so the application ensures that there is at
+// most one writer by making every write through write or writeQueued.
 func (c *Client) writePump() {
 	ticker := time.NewTicker(pingPeriod)
 
+	// fires shortly before the access token expires, nil until logged in
+	var expiryTimer *time.Timer
+	var expiryNotice <-chan time.Time
+	var expiresAt int64
+
 	defer func() {
 		ticker.Stop()
 		c.Conn.Close()
+
+		if expiryTimer != nil {
+			expiryTimer.Stop()
+		}
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok {
-				// The hub closed the channel.
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+		case expiresAt = <-c.TokenExpiry:
+			if expiryTimer != nil {
+				expiryTimer.Stop()
 			}
 
-			w, err := c.Conn.NextWriter(websocket.TextMessage)
-			if err != nil {
+			expiryTimer = time.NewTimer(time.Until(time.Unix(expiresAt, 0).Add(-expiryNoticeBefore)))
+			expiryNotice = expiryTimer.C
+
+		case <-expiryNotice:
+			expiryNotice = nil
+
+			notice, _ := json.Marshal(ws.TokenExpiring{
+				BaseMessage: ws.BaseMessage{
+					Command: "tokenExpiring",
+				},
+				ExpiresAt: expiresAt,
+			})
+
+			if err := c.write(websocket.TextMessage, notice); err != nil {
 				return
 			}
-			w.Write(message)
 
-			// Add queued chat messages to the current websocket message.
-			n := len(c.Send)
-			for i := 0; i < n; i++ {
-				w.Write(newline)
-				w.Write(<-c.Send)
+		case message, ok := <-c.Send:
+			if !ok {
+				// The hub closed the channel.
+				c.write(websocket.CloseMessage, []byte{})
+				return
 			}
 
-			if err := w.Close(); err != nil {
+			if err := c.writeQueued(message); err != nil {
 				return
 			}
 
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			if err := c.write(websocket.PingMessage, nil); err != nil {
 				return
 			}
 		}
 	}
 }
 
+// write sends a message to the peer. The connection only allows one writer
+// at a time, so every write goes through here or writeQueued.
+func (c *Client) write(messageType int, data []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+	return c.Conn.WriteMessage(messageType, data)
+}
+
+// writeQueued sends the message with any others waiting in Send
+func (c *Client) writeQueued(message []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+
+	w, err := c.Conn.NextWriter(websocket.TextMessage)
+	if err != nil {
+		return err
+	}
+	w.Write(message)
+
+	// Add queued chat messages to the current websocket message.
+	n := len(c.Send)
+	for i := 0; i < n; i++ {
+		w.Write(newline)
+		w.Write(<-c.Send)
+	}
+
+	return w.Close()
+}
+
 // serveWs handles websocket requests from the peer.
+//
+// A token sent with the handshake is checked before upgrading so the socket
+// starts logged in, an invalid token is refused rather than ignored.
 func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, db *WebDataProxy) {
-	conn, err := upgrader.Upgrade(w, r, nil)
-	upgrader.CheckOrigin = func(r *http.Request) bool { return true }
+	username := ""
+	sessionID := ""
+	var expiresAt int64
+	var responseHeader http.Header
+
+	if token, protocol := tokenFromRequest(r); token != "" {
+		claims, err := (*db).ValidateToken(token)
+
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		username = claims.Username
+		sessionID = claims.SessionID
+		expiresAt = claims.ExpiresAt
+
+		// the browser closes the socket unless the subprotocol is echoed
+		if protocol != "" {
+			responseHeader = http.Header{"Sec-Websocket-Protocol": {protocol}}
+		}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, responseHeader)
 
 	if err != nil {
 		log.Println(err)
 		return
 	}
 
-	client := &Client{Hub: hub, Conn: conn, Send: make(chan []byte, 256), Web: w, DB: db}
+	client := &Client{
+		Hub:         hub,
+		Conn:        conn,
+		Send:        make(chan []byte, 256),
+		TokenExpiry: make(chan int64, 1),
+		ID:          newSocketID(),
+		IP:          remoteIP(r),
+		UserAgent:   r.UserAgent(),
+		DB:          db,
+	}
+
+	if username != "" {
+		if err = client.bind(username, sessionID, expiresAt); err != nil {
+			log.Println(err)
+			conn.Close()
+			return
+		}
+	}
+
 	client.Hub.Register <- client
 
 	// Allow collection of memory referenced by the caller by doing all work in
@@ -368,3 +824,14 @@ func ServeWs(hub *Hub, w http.ResponseWriter, r *http.Request, db *WebDataProxy)
 	go client.writePump()
 	go client.readPump()
 }
+
+// remoteIP strips the port from the address of the peer
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
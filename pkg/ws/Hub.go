@@ -1,5 +1,10 @@
 package ws
 
+import (
+	"encoding/json"
+	"log"
+)
+
 type Hub struct {
 	// Registered clients.
 	Clients map[*Client]bool
@@ -12,16 +17,39 @@ type Hub struct {
 
 	// Unregister requests from clients.
 	Unregister chan *Client
+
+	// Events for the sockets of one user.
+	Deliver chan Delivery
+}
+
+// Delivery is an event for every socket a user is logged in on
+type Delivery struct {
+	Username string
+	Data     []byte
 }
 
 func NewHub() *Hub {
 	return &Hub{
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		Deliver:    make(chan Delivery, 256),
 		Clients:    make(map[*Client]bool),
 	}
 }
 
+// Notify sends the event to the sockets the user is logged in on, only
+// sockets connected to this node get it
+func (h *Hub) Notify(username string, event interface{}) {
+	data, err := json.Marshal(event)
+
+	if err != nil {
+		log.Println("error: could not encode event: ", err)
+		return
+	}
+
+	h.Deliver <- Delivery{Username: username, Data: data}
+}
+
 func (h *Hub) Run() {
 	for {
 		select {
@@ -33,6 +61,20 @@ func (h *Hub) Run() {
 				delete(h.Clients, client)
 				close(client.Send)
 			}
+
+		case delivery := <-h.Deliver:
+			for client := range h.Clients {
+				if (*client.DB).UsernameOf(client.ID) != delivery.Username {
+					continue
+				}
+
+				// a socket that is not keeping up misses the event rather
+				// than holding up every other socket
+				select {
+				case client.Send <- delivery.Data:
+				default:
+				}
+			}
 		}
 	}
 }
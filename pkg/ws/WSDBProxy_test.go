@@ -2,9 +2,15 @@ package ws
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/content"
 	"go-websocket/pkg/db"
+	"go-websocket/pkg/mail"
 	"go-websocket/pkg/mocks"
+	"go-websocket/pkg/oidc"
+	"strings"
 	"time"
 
 	"github.com/neo4j/neo4j-go-driver/v4/neo4j"
@@ -13,6 +19,10 @@ import (
 	. "github.com/onsi/gomega"
 )
 
+// Links the emailed tokens are appended to
+const verifyURL = "https://example.com/verify?token="
+const resetURL = "https://example.com/reset?token="
+
 var _ = Describe("WSDB", func() {
 
 	const username = "neo4j"
@@ -76,20 +86,27 @@ var _ = Describe("WSDB", func() {
 		err = smartDB.CreateProfile(&accountUsernameTwo, &emailTwo, &initialPasswordTwo)
 		Expect(err).To(BeNil(), "Transaction should successfully run")
 
+		// Only verified accounts can upload and buy listings
+		err = smartDB.VerifyEmail(&emailOne)
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+
+		err = smartDB.VerifyEmail(&emailTwo)
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+
 		// Add messages
 		message := "first message"
 		secondMessage := "second message"
 		thirdMessage := "third message"
 
-		err = smartDB.CreateMessage(&accountUsernameOne, &accountUsernameTwo, &message)
+		_, err = smartDB.CreateMessage(&accountUsernameOne, &accountUsernameTwo, &message, nil)
 		Expect(err).To(BeNil(), "Transaction should successfully run")
 		time.Sleep(time.Second)
 
-		err = smartDB.CreateMessage(&accountUsernameOne, &accountUsernameTwo, &secondMessage)
+		_, err = smartDB.CreateMessage(&accountUsernameOne, &accountUsernameTwo, &secondMessage, nil)
 		Expect(err).To(BeNil(), "Transaction should successfully run")
 		time.Sleep(time.Second)
 
-		err = smartDB.CreateMessage(&accountUsernameTwo, &accountUsernameOne, &thirdMessage)
+		_, err = smartDB.CreateMessage(&accountUsernameTwo, &accountUsernameOne, &thirdMessage, nil)
 		Expect(err).To(BeNil(), "Transaction should successfully run")
 		time.Sleep(time.Second)
 
@@ -215,7 +232,7 @@ var _ = Describe("WSDB", func() {
 		Expect(isLoggedIn).To(Equal(false), "Socket should not be connected username")
 
 		var time int64 = 0
-		_, err := bridge.GetMessages("socketOne", &accountUsernameTwo, &time)
+		_, err := bridge.GetMessages("socketOne", &accountUsernameTwo, &time, nil)
 		Expect(err).NotTo(BeNil(), "Should be unable to be get messages if not logged in")
 	})
 
@@ -238,7 +255,7 @@ var _ = Describe("WSDB", func() {
 		Expect(isLoggedIn).To(Equal(true), "Socket should be connected username")
 
 		var time int64 = 0
-		messages, err := bridge.GetMessages("socketOne", &accountUsernameTwo, &time)
+		messages, err := bridge.GetMessages("socketOne", &accountUsernameTwo, &time, nil)
 
 		Expect(err).To(BeNil(), "Should be able to be get messages")
 		Expect(len(messages)).To(Equal(3), "3 messages should be found")
@@ -264,11 +281,11 @@ var _ = Describe("WSDB", func() {
 
 		message := "new message"
 
-		err = bridge.CreateMessage("socketOne", &accountUsernameTwo, &message)
+		_, err = bridge.CreateMessage("socketOne", &accountUsernameTwo, &message, nil)
 		Expect(err).To(BeNil(), "Should be able to be create a new message")
 
 		var time int64 = 0
-		messages, err := bridge.GetMessages("socketOne", &accountUsernameTwo, &time)
+		messages, err := bridge.GetMessages("socketOne", &accountUsernameTwo, &time, nil)
 
 		Expect(err).To(BeNil(), "Should be able to be get messages")
 		Expect(len(messages)).To(Equal(4), "4 messages should be found")
@@ -291,11 +308,422 @@ var _ = Describe("WSDB", func() {
 
 		message := "new message"
 
-		err := bridge.CreateMessage("socketOne", &accountUsernameTwo, &message)
+		_, err := bridge.CreateMessage("socketOne", &accountUsernameTwo, &message, nil)
 		Expect(err).NotTo(BeNil(), "Should be unable to be create a new message")
 
 	})
 
+	It("Messages: Cannot create messages that are too long or banned", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		rules := content.DefaultRules()
+		rules.Message.MaxLength = 10
+		rules.Message.Banned = content.NewBannedWords([]string{"scam"})
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+			Content:         rules,
+		}
+
+		err := bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		Expect(err).To(BeNil(), "Socket should not have already username")
+
+		message := "a message that is too long"
+
+		_, err = bridge.CreateMessage("socketOne", &accountUsernameTwo, &message, nil)
+		Expect(err).NotTo(BeNil(), "Should be unable to create a long message")
+		Expect(errorCode(err)).To(Equal(CONTENT_TOO_LONG))
+
+		message = "a Scam"
+
+		_, err = bridge.CreateMessage("socketOne", &accountUsernameTwo, &message, nil)
+		Expect(err).NotTo(BeNil(), "Should be unable to create a banned message")
+		Expect(errorCode(err)).To(Equal(CONTENT_BANNED))
+	})
+
+	It("Messages: Only the sender can edit a message by its ID", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+		}
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+
+		message := "Teh message"
+
+		id, err := bridge.CreateMessage("socketOne", &accountUsernameTwo, &message, nil)
+		Expect(err).To(BeNil(), "Should be able to be create a new message")
+		Expect(id).NotTo(BeEmpty(), "Should be given the ID of the message")
+
+		edited := "The message"
+
+		err = bridge.EditMessage("socketTwo", &id, &edited)
+		Expect(err).NotTo(BeNil(), "Receiver should not be able to edit")
+		Expect(errorCode(err)).To(Equal(MESSAGE_NOT_FOUND))
+
+		err = bridge.EditMessage("socketOne", &id, &edited)
+		Expect(err).To(BeNil(), "Sender should be able to edit")
+
+		err = bridge.DeleteMessage("socketOne", &id)
+		Expect(err).To(BeNil(), "Sender should be able to delete")
+	})
+
+	It("Messages: Messages about a listing are their own conversation", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+		}
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+
+		message := "Is this still for sale?"
+
+		_, err := bridge.CreateMessage("socketTwo", &accountUsernameOne, &message, &productIDTwo)
+		Expect(err).To(BeNil(), "Buyer should be able to ask the seller about a listing")
+
+		about, err := bridge.GetMessages("socketTwo", &accountUsernameOne, new(int64), &productIDTwo)
+		Expect(err).To(BeNil())
+		Expect(about).To(HaveLen(1), "Only the message about the listing should be in its conversation")
+
+		general, _ := bridge.GetMessages("socketTwo", &accountUsernameOne, new(int64), nil)
+		Expect(general).To(HaveLen(3), "Messages about the listing should not be in the general conversation")
+
+		contacts, _ := bridge.GetContacts("socketTwo")
+		Expect(contacts).To(HaveLen(2), "Each conversation should be a contact")
+		Expect(contacts[1].Listing).To(Equal(&productIDTwo))
+		Expect(contacts[1].ListingTitle).To(Equal("Example Listing"))
+
+		missing := int64(-1)
+
+		_, err = bridge.CreateMessage("socketTwo", &accountUsernameOne, &message, &missing)
+		Expect(err).NotTo(BeNil(), "Should not message about a listing that does not exist")
+	})
+
+	It("Groups: Only admins can change members and only members can read", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+		}
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+
+		name := "Bikes"
+
+		id, err := bridge.CreateGroup("socketOne", &name, []string{})
+		Expect(err).To(BeNil(), "Should be able to make a group")
+
+		message := "Hello"
+
+		_, err = bridge.SendGroupMessage("socketTwo", &id, &message)
+		Expect(errorCode(err)).To(Equal(GROUP_NOT_FOUND), "Non members should not send messages")
+
+		err = bridge.AddMember("socketOne", &id, &accountUsernameTwo, "")
+		Expect(err).To(BeNil(), "Admin should be able to add members")
+
+		err = bridge.RemoveMember("socketTwo", &id, &accountUsernameOne)
+		Expect(errorCode(err)).To(Equal(NOT_GROUP_ADMIN), "Members should not remove others")
+
+		_, err = bridge.SendGroupMessage("socketTwo", &id, &message)
+		Expect(err).To(BeNil(), "Members should be able to send messages")
+
+		messages, err := bridge.GetGroupMessages("socketOne", &id, new(int64))
+		Expect(err).To(BeNil())
+		Expect(messages).To(HaveLen(1))
+
+		err = bridge.LeaveGroup("socketTwo", &id)
+		Expect(err).To(BeNil(), "Members should be able to leave")
+
+		_, err = bridge.GetGroup("socketTwo", &id)
+		Expect(errorCode(err)).To(Equal(GROUP_NOT_FOUND), "Former members should not see the group")
+	})
+
+	It("Password reset: the token sets the password once and signs out every session", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		proxy, outbox := accountProxy(&smartDB)
+		bridge = proxy
+
+		tokens, err := bridge.IssueTokens(accountUsernameOne, "test", "127.0.0.1")
+		Expect(err).To(BeNil(), "Should be able to log in")
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectSessionToID(tokens.SessionID, "socketOne")
+
+		err = bridge.RequestPasswordReset(&emailOne)
+		Expect(err).To(BeNil(), "Should be able to ask for a reset")
+
+		token := emailedToken(outbox, emailOne, resetURL)
+		Expect(token).NotTo(BeEmpty(), "The email should have a token")
+
+		newPassword := "a-new-password"
+		err = bridge.ResetPassword(&token, &newPassword)
+		Expect(err).To(BeNil(), "The token should reset the password")
+
+		err = bridge.ResetPassword(&token, &initialPasswordOne)
+		Expect(errorCode(err)).To(Equal(INVALID_TOKEN), "The token can only be used once")
+
+		Expect(bridge.IsLoggedIn("socketOne")).To(BeFalse(), "Sockets should be signed out")
+
+		_, _, err = bridge.RefreshTokens(tokens.RefreshToken, "test", "127.0.0.1")
+		Expect(err).NotTo(BeNil(), "Sessions should be revoked")
+
+		_, err = bridge.CheckLogin(&emailOne, &initialPasswordOne, "127.0.0.1")
+		Expect(errorCode(err)).To(Equal(INVALID_LOGIN), "The old password should not work")
+
+		_, err = bridge.CheckLogin(&emailOne, &newPassword, "127.0.0.1")
+		Expect(err).To(BeNil(), "The new password should work")
+	})
+
+	It("Account: changing the password signs out the other sessions", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		proxy, _ := accountProxy(&smartDB)
+		bridge = proxy
+
+		current, err := bridge.IssueTokens(accountUsernameOne, "test", "127.0.0.1")
+		Expect(err).To(BeNil(), "Should be able to log in")
+
+		other, err := bridge.IssueTokens(accountUsernameOne, "test", "127.0.0.1")
+		Expect(err).To(BeNil(), "Should be able to log in on another device")
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectSessionToID(current.SessionID, "socketOne")
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketTwo")
+		_ = bridge.ConnectSessionToID(other.SessionID, "socketTwo")
+
+		newPassword := "a-new-password"
+		wrongPassword := "wrong-password"
+
+		err = bridge.ChangePassword("socketOne", &wrongPassword, &newPassword)
+		Expect(errorCode(err)).To(Equal(INVALID_LOGIN), "The current password has to be checked")
+
+		err = bridge.ChangePassword("socketOne", &initialPasswordOne, &newPassword)
+		Expect(err).To(BeNil(), "Should be able to change the password")
+
+		Expect(bridge.IsLoggedIn("socketOne")).To(BeTrue(), "The socket that changed it stays logged in")
+		Expect(bridge.IsLoggedIn("socketTwo")).To(BeFalse(), "Other sockets are signed out")
+
+		_, _, err = bridge.RefreshTokens(other.RefreshToken, "test", "127.0.0.1")
+		Expect(err).NotTo(BeNil(), "Other sessions are revoked")
+
+		_, _, err = bridge.RefreshTokens(current.RefreshToken, "test", "127.0.0.1")
+		Expect(err).To(BeNil(), "The current session is kept")
+
+		_, err = bridge.CheckLogin(&emailOne, &newPassword, "127.0.0.1")
+		Expect(err).To(BeNil(), "The new password should work")
+	})
+
+	It("Account: a changed email is verified before it replaces the old one", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		proxy, outbox := accountProxy(&smartDB)
+		bridge = proxy
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+
+		newEmail := "new@example.com"
+		wrongPassword := "wrong-password"
+
+		err := bridge.ChangeEmail("socketOne", &wrongPassword, &newEmail)
+		Expect(errorCode(err)).To(Equal(INVALID_LOGIN), "The password has to be checked")
+
+		err = bridge.ChangeEmail("socketOne", &initialPasswordOne, &emailTwo)
+		Expect(errorCode(err)).To(Equal(EMAIL_IN_USE), "Emails are unique")
+
+		err = bridge.ChangeEmail("socketOne", &initialPasswordOne, &newEmail)
+		Expect(err).To(BeNil(), "Should be able to change to a free email")
+
+		_, notified := outbox.Last(emailOne)
+		Expect(notified).To(BeTrue(), "The old email should be told")
+
+		removed, err := bridge.CleanupUnverified(0)
+		Expect(err).To(BeNil())
+		Expect(removed).To(BeZero(), "The account should not be removed while the new email is unverified")
+
+		token := emailedToken(outbox, newEmail, verifyURL)
+		Expect(bridge.VerifyEmail(&token)).To(BeNil(), "The token should verify the new email")
+
+		_, err = bridge.CheckLogin(&newEmail, &initialPasswordOne, "127.0.0.1")
+		Expect(err).To(BeNil(), "Should log in with the new email")
+	})
+
+	It("Account: renames are unique, wait for the cooldown and keep the old username", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		proxy, _ := accountProxy(&smartDB)
+		bridge = proxy
+
+		tokens, err := bridge.IssueTokens(accountUsernameOne, "test", "127.0.0.1")
+		Expect(err).To(BeNil(), "Should be able to log in")
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectExpiryToID(tokens.ExpiresAt, "socketOne")
+		_ = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+
+		_, err = bridge.ChangeUsername("socketOne", &accountUsernameTwo)
+		Expect(errorCode(err)).To(Equal(USERAME_IN_USE), "Usernames are unique")
+
+		newUsername := "renamed"
+		renamed, err := bridge.ChangeUsername("socketOne", &newUsername)
+		Expect(err).To(BeNil(), "Should be able to rename")
+		Expect(bridge.UsernameOf("socketOne")).To(Equal(newUsername), "The socket follows the rename")
+		Expect(proxy.IdToExpiry["socketOne"]).To(Equal(renamed.ExpiresAt), "The socket lasts as long as the new token")
+
+		claims, err := bridge.ValidateToken(renamed.Token)
+		Expect(err).To(BeNil())
+		Expect(claims.Username).To(Equal(newUsername))
+
+		claims, err = bridge.ValidateToken(tokens.Token)
+		Expect(err).To(BeNil(), "Tokens from before the rename still work")
+		Expect(claims.Username).To(Equal(newUsername), "Tokens from before the rename are for the new username")
+
+		message := "to the old username"
+		_, err = bridge.CreateMessage("socketTwo", &accountUsernameOne, &message, nil)
+		Expect(err).To(BeNil(), "Messages to the old username reach the user")
+
+		var after int64 = 0
+		messages, err := bridge.GetMessages("socketOne", &accountUsernameTwo, &after, nil)
+		Expect(err).To(BeNil())
+		Expect(messages[len(messages)-1].Contents).To(Equal(message))
+
+		again := "renamed-again"
+		_, err = bridge.ChangeUsername("socketOne", &again)
+		Expect(errorCode(err)).To(Equal(USERNAME_COOLDOWN), "Renames have to wait for the cooldown")
+
+		err = smartDB.CreateProfile(&accountUsernameOne, &emailTwo, &initialPasswordTwo)
+		Expect(err).NotTo(BeNil(), "Old usernames cannot be taken by someone else")
+	})
+
+	It("Verification: the emailed token verifies the account once", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		var oneTimeStore auth.OneTimeStore = auth.NewMemoryOneTimeStore()
+		outbox := mail.NewOutbox("")
+		var mailer mail.Mailer = outbox
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+			OneTimeStore:    &oneTimeStore,
+			Mailer:          &mailer,
+			VerifyURL:       verifyURL,
+		}
+
+		usernameThree := "another"
+		emailThree := "another@example.com"
+		err := smartDB.CreateProfile(&usernameThree, &emailThree, &initialPasswordOne)
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+
+		err = bridge.ResendVerification(&emailThree)
+		Expect(err).To(BeNil(), "Should be able to send the verification email")
+
+		token := emailedToken(outbox, emailThree, verifyURL)
+		Expect(token).NotTo(BeEmpty(), "The email should have a token")
+
+		err = bridge.VerifyEmail(&token)
+		Expect(err).To(BeNil(), "The token should verify the account")
+
+		verified, _ := smartDB.IsVerified(&usernameThree)
+		Expect(verified).To(BeTrue(), "The account should be verified")
+
+		err = bridge.VerifyEmail(&token)
+		Expect(errorCode(err)).To(Equal(INVALID_TOKEN), "The token can only be used once")
+
+		err = bridge.ResendVerification(&emailThree)
+		Expect(err).To(BeNil())
+		Expect(outbox.Messages()).To(HaveLen(1), "Verified accounts are not sent another email")
+	})
+
+	It("Verification: unverified accounts cannot upload or buy listings", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+		}
+
+		usernameThree := "another"
+		emailThree := "another@example.com"
+		err := smartDB.CreateProfile(&usernameThree, &emailThree, &initialPasswordOne)
+		Expect(err).To(BeNil(), "Transaction should successfully run")
+
+		_ = bridge.ConnectUsernameToID(&usernameThree, "socketThree")
+
+		listing := db.Listing{
+			Title:      "Example Listing",
+			Decription: "This is a description of a listing",
+			Price:      12,
+			Sym:        "ETH",
+		}
+
+		err = bridge.UploadListing("socketThree", &listing)
+		Expect(errorCode(err)).To(Equal(EMAIL_NOT_VERIFIED), "Unverified accounts cannot sell")
+
+		var amount int64 = 50
+		err = bridge.BuyListing("socketThree", &productIDTwo, &amount)
+		Expect(errorCode(err)).To(Equal(EMAIL_NOT_VERIFIED), "Unverified accounts cannot buy")
+
+		Expect(smartDB.VerifyEmail(&emailThree)).To(BeNil())
+
+		err = bridge.BuyListing("socketThree", &productIDTwo, &amount)
+		Expect(err).To(BeNil(), "Verified accounts can buy")
+	})
+
 	It("Listing: Can upload listing if logged in", func() {
 		session := driver.NewSession(neo4j.SessionConfig{})
 		defer mocks.Close(session, "Session")
@@ -479,6 +907,256 @@ var _ = Describe("WSDB", func() {
 		Expect(err).To(BeNil(), "Should be able to create an account")
 	})
 
+	It("Rating: only the buyer can rate the seller of a listing", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+		}
+
+		err := bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		Expect(err).To(BeNil(), "Socket should not having a username")
+
+		err = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+		Expect(err).To(BeNil(), "Socket should not having a username")
+
+		err = bridge.RateSeller("socketTwo", &productIDOne, 6)
+		Expect(err).To(Not(BeNil()), "Scores above the maximum should be refused")
+
+		err = bridge.RateSeller("socketOne", &productIDOne, 4)
+		Expect(err).To(Not(BeNil()), "Sellers should not be able to rate themselves")
+
+		err = bridge.RateSeller("socketTwo", &productIDOne, 4)
+		Expect(err).To(BeNil(), "The buyer should be able to rate the seller")
+
+		profile, err := bridge.GetProfile("socketTwo", &accountUsernameOne)
+		Expect(err).To(BeNil(), "Should be able to get the seller's profile")
+		Expect(profile.Rating).To(Equal(4.0), "Rating should be the average score")
+		Expect(profile.RatingCount).To(Equal(int64(1)), "Rating should count the buyer once")
+
+		err = bridge.RateSeller("socketTwo", &productIDOne, 2)
+		Expect(err).To(BeNil(), "The buyer should be able to change their score")
+
+		profile, err = bridge.GetProfile("socketTwo", &accountUsernameOne)
+		Expect(err).To(BeNil(), "Should be able to get the seller's profile")
+		Expect(profile.Rating).To(Equal(2.0), "Rating should use the latest score")
+		Expect(profile.RatingCount).To(Equal(int64(1)), "Rating should count the buyer once")
+	})
+
+	It("Blocking: blocked users cannot message, buy or see listings", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+		}
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+
+		err := bridge.BlockUser("socketOne", &accountUsernameOne)
+		Expect(errorCode(err)).To(Equal(BLOCKED), "Should not block yourself")
+
+		err = bridge.BlockUser("socketOne", &accountUsernameTwo)
+		Expect(err).To(BeNil(), "Should be able to block")
+
+		blocked, err := bridge.ListBlocked("socketOne")
+		Expect(err).To(BeNil())
+		Expect(blocked).To(HaveLen(1))
+
+		message := "new message"
+		_, err = bridge.CreateMessage("socketTwo", &accountUsernameOne, &message, nil)
+		Expect(errorCode(err)).To(Equal(BLOCKED), "Blocked users should not send messages")
+
+		_, err = bridge.GetListing("socketTwo", &productIDTwo)
+		Expect(errorCode(err)).To(Equal(LISTING_NOT_FOUND), "Blocked users should not see listings")
+
+		_, err = bridge.GetListing("logged-out", &productIDTwo)
+		Expect(err).To(BeNil(), "Logged out sockets still see listings")
+
+		var amount int64 = 10
+		err = bridge.BuyListing("socketTwo", &productIDTwo, &amount)
+		Expect(errorCode(err)).To(Equal(BLOCKED), "Blocked users should not buy")
+
+		contacts, _ := bridge.GetContacts("socketTwo")
+		Expect(contacts).To(BeEmpty(), "Blocked users should not be contacts")
+
+		err = bridge.UnblockUser("socketOne", &accountUsernameTwo)
+		Expect(err).To(BeNil(), "Should be able to unblock")
+
+		_, err = bridge.CreateMessage("socketTwo", &accountUsernameOne, &message, nil)
+		Expect(err).To(BeNil(), "Unblocked users can send messages again")
+	})
+
+	It("Moderation: only moderators act on reports, suspended users cannot log in", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+		}
+
+		Expect(smartDB.SetModerators([]string{accountUsernameTwo})).To(BeNil())
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+
+		report := db.Report{Type: db.ReportListing, Listing: productIDTwo, Reason: "scam"}
+		err := bridge.Report("socketTwo", &report)
+		Expect(err).To(BeNil(), "Should be able to report a listing")
+
+		_, err = bridge.ListReports("socketOne", db.ReportOpen)
+		Expect(errorCode(err)).To(Equal(NOT_MODERATOR))
+
+		reports, err := bridge.ListReports("socketTwo", db.ReportOpen)
+		Expect(err).To(BeNil())
+		Expect(reports).To(HaveLen(1))
+
+		err = bridge.Moderate("socketTwo", report.ID, &db.ModerationAction{Action: db.ActionDeleteMessage})
+		Expect(errorCode(err)).To(Equal(REPORT_INVALID), "A listing report has no message")
+
+		err = bridge.Moderate("socketTwo", report.ID, &db.ModerationAction{Action: db.ActionHideListing})
+		Expect(err).To(BeNil())
+
+		_, err = bridge.GetListing("socketTwo", &productIDTwo)
+		Expect(err).To(BeNil(), "Moderators still see hidden listings")
+
+		_, err = bridge.GetListing("logged-out", &productIDTwo)
+		Expect(errorCode(err)).To(Equal(LISTING_NOT_FOUND), "Hidden listings are not found")
+
+		err = bridge.Moderate("socketTwo", report.ID, &db.ModerationAction{Action: db.ActionSuspendUser})
+		Expect(err).To(BeNil())
+		Expect(bridge.IsLoggedIn("socketOne")).To(BeFalse(), "Suspended users are signed out")
+
+		_, err = bridge.CheckLogin(&emailOne, &initialPasswordOne, "127.0.0.1")
+		Expect(errorCode(err)).To(Equal(ACCOUNT_SUSPENDED))
+	})
+
+	It("Moderation: only moderators can unlock a locked account", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		limiter := auth.NewLoginLimiter(auth.NewMemoryAttemptStore())
+		limiter.Threshold = 1
+
+		bridge = WSDBProxy{
+			DatabaseManager: &smartDB,
+			IdToUsername:    make(map[string]string),
+			LoginLimiter:    limiter,
+		}
+
+		Expect(smartDB.SetModerators([]string{accountUsernameTwo})).To(BeNil())
+
+		_ = bridge.ConnectUsernameToID(&accountUsernameOne, "socketOne")
+		_ = bridge.ConnectUsernameToID(&accountUsernameTwo, "socketTwo")
+
+		wrongPassword := "wrong-password"
+		_, err := bridge.CheckLogin(&emailOne, &wrongPassword, "10.0.0.1")
+		Expect(errorCode(err)).To(Equal(INVALID_LOGIN))
+
+		_, err = bridge.CheckLogin(&emailOne, &initialPasswordOne, "10.0.0.2")
+		Expect(errorCode(err)).To(Equal(ACCOUNT_LOCKED), "The email should be locked")
+
+		noIP := ""
+		err = bridge.UnlockAccount("socketOne", &emailOne, &noIP)
+		Expect(errorCode(err)).To(Equal(NOT_MODERATOR))
+
+		err = bridge.UnlockAccount("socketTwo", &emailOne, &noIP)
+		Expect(err).To(BeNil(), "Moderators can unlock accounts")
+
+		_, err = bridge.CheckLogin(&emailOne, &initialPasswordOne, "10.0.0.2")
+		Expect(err).To(BeNil(), "The email should be unlocked")
+	})
+
+	It("Verification: an unverified provider account is sent a verification email", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge, outbox := accountProxy(&smartDB)
+
+		identity := oidc.Identity{
+			Provider: "example",
+			Subject:  "some-subject",
+			Email:    "provider-user@example.com",
+		}
+
+		_, _, err := bridge.LoginExternal(identity, "", "")
+		Expect(err).To(BeNil())
+
+		token := emailedToken(outbox, identity.Email, verifyURL)
+		Expect(token).NotTo(BeEmpty(), "The new account should be sent a verification email")
+		Expect(bridge.VerifyEmail(&token)).To(BeNil())
+
+		removed, _ := bridge.CleanupUnverified(-time.Minute)
+		Expect(removed).To(BeZero(), "The verified account should be kept")
+	})
+
+	It("Two-factor: a provider login is finished once with its login token", func() {
+		session := driver.NewSession(neo4j.SessionConfig{})
+		defer mocks.Close(session, "Session")
+
+		smartDB = db.NeoHandler{
+			Session: session,
+		}
+
+		bridge, _ := accountProxy(&smartDB)
+
+		store := auth.NewMemoryTwoFactorStore()
+		bridge.TwoFactor = auth.NewTwoFactor(store, "Conduit")
+
+		secret := auth.NewTOTPSecret()
+		Expect(store.SetPending(accountUsernameOne, secret)).To(BeNil())
+		Expect(store.Enable(accountUsernameOne, nil)).To(BeNil())
+
+		identity := oidc.Identity{
+			Provider:      "example",
+			Subject:       "some-subject",
+			Email:         emailOne,
+			EmailVerified: true,
+		}
+
+		_, _, err := bridge.LoginExternal(identity, "", "")
+		Expect(errors.Is(err, auth.ErrTwoFactorRequired)).To(BeTrue())
+
+		var pendingErr *TwoFactorPendingError
+		Expect(errors.As(err, &pendingErr)).To(BeTrue(), "The login should be finishable")
+
+		username, email, err := bridge.PendingExternalLogin(pendingErr.LoginToken)
+		Expect(err).To(BeNil())
+		Expect(username).To(Equal(accountUsernameOne))
+		Expect(email).To(Equal(emailOne))
+
+		code, _ := bridge.TwoFactor.TOTP.Code(secret, bridge.TwoFactor.TOTP.Counter(time.Now()))
+		Expect(bridge.VerifyTwoFactor(username, email, "", code)).To(BeNil())
+
+		_, _, err = bridge.PendingExternalLogin(pendingErr.LoginToken)
+		Expect(errorCode(err)).To(Equal(INVALID_TOKEN), "The login token only works once")
+	})
+
 	It("Contacts: Can get contacts", func() {
 		session := driver.NewSession(neo4j.SessionConfig{})
 		defer mocks.Close(session, "Session")
@@ -503,3 +1181,54 @@ var _ = Describe("WSDB", func() {
 	})
 
 })
+
+// emailedToken returns the token appended to the link in the latest email
+// sent to the address
+func emailedToken(outbox *mail.Outbox, to, link string) string {
+	message, ok := outbox.Last(to)
+
+	if !ok {
+		return ""
+	}
+
+	start := strings.Index(message.Body, link)
+
+	if start < 0 {
+		return ""
+	}
+
+	fields := strings.Fields(message.Body[start+len(link):])
+
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[0]
+}
+
+// accountProxy can log users in and out, and keeps the emails it sends
+func accountProxy(smartDB *db.ISmartDBWriterReader) (WSDBProxy, *mail.Outbox) {
+	keys, _ := auth.NewKeyManager(auth.AlgorithmHS256)
+	_ = keys.AddSecret([]byte("a-secret-that-is-at-least-32-bytes"), true)
+
+	var refreshStore auth.RefreshStore = auth.NewMemoryRefreshStore()
+	var revocationStore auth.RevocationStore = auth.NewMemoryRevocationStore()
+	var oneTimeStore auth.OneTimeStore = auth.NewMemoryOneTimeStore()
+
+	outbox := mail.NewOutbox("")
+	var mailer mail.Mailer = outbox
+
+	return WSDBProxy{
+		DatabaseManager: smartDB,
+		IdToUsername:    make(map[string]string),
+		IdToSession:     make(map[string]string),
+		IdToExpiry:      make(map[string]int64),
+		RefreshStore:    &refreshStore,
+		RevocationStore: &revocationStore,
+		Keys:            keys,
+		OneTimeStore:    &oneTimeStore,
+		Mailer:          &mailer,
+		ResetURL:        resetURL,
+		VerifyURL:       verifyURL,
+	}, outbox
+}
@@ -1,19 +1,103 @@
 package ws
 
-import "go-websocket/pkg/db"
+import (
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/db"
+	"go-websocket/pkg/oidc"
+	"go-websocket/pkg/storage"
+	dt "go-websocket/pkg/ws/messages"
+	"net/url"
+	"time"
+)
 
 type WebDataProxy interface {
 	// Socket methods
+	MaxMessageSize() int64
 	ConnectUsernameToID(username *string, id string) error
 	IsLoggedIn(id string) bool
+	UsernameOf(id string) string
 	IsIDLinkedToUsername(id string, username *string) bool
 	LogoutID(id string) error
+	ValidateToken(token string) (*dt.Claims, error)
+	IssueTokens(username, userAgent, ip string) (dt.TokenPair, error)
+	RefreshTokens(refreshToken, userAgent, ip string) (string, dt.TokenPair, error)
+
+	// Session methods
+	ConnectSessionToID(sessionID string, id string) error
+	ConnectExpiryToID(expiresAt int64, id string) error
+	SessionOf(id string) string
+	ListSessions(socketID string) ([]auth.Session, error)
+	RevokeSession(socketID string, sessionID string) error
+	Logout(socketID string) error
+
+	// Account recovery methods
+	RequestPasswordReset(email *string) error
+	ResetPassword(token, password *string) error
+	ResendVerification(email *string) error
+	VerifyEmail(token *string) error
+	CleanupUnverified(maxAge time.Duration) (int64, error)
+
+	// Account settings methods
+	ChangePassword(socketID string, currentPassword, newPassword *string) error
+	ChangeEmail(socketID string, password, newEmail *string) error
+	ChangeUsername(socketID string, newUsername *string) (dt.TokenPair, error)
+
+	// Two-factor methods
+	VerifyTwoFactor(username, email, ip, code string) error
+	PendingExternalLogin(loginToken string) (string, string, error)
+	EnableTwoFactor(socketID string) (string, error)
+	ConfirmTwoFactor(socketID string, code *string) ([]string, error)
+	DisableTwoFactor(socketID string, password, code *string) error
+
+	// Profile methods
+	GetProfile(socketID string, username *string) (db.Profile, error)
+	UpdateProfile(socketID string, update *db.ProfileUpdate) error
+	RateSeller(socketID string, listingID *int64, score int64) error
+
+	// Media methods
+	UploadMedia(socketID string, purpose string, data []byte) (string, string, error)
+	UploadURL(socketID string, purpose string) (string, error)
+	UploadSigned(query url.Values, data []byte) (string, string, error)
+	MaxUploadSize() int64
+	BeginUpload(socketID string, purpose string, size int64, checksum string) (storage.UploadStatus, error)
+	UploadChunk(socketID string, uploadID string, index int, checksum string, data []byte) error
+	UploadStatus(socketID string, uploadID string) (storage.UploadStatus, error)
+	CommitUpload(socketID string, uploadID string) (string, string, error)
+	AbortUpload(socketID string, uploadID string) error
+
+	// Blocking methods
+	BlockUser(socketID string, username *string) error
+	UnblockUser(socketID string, username *string) error
+	ListBlocked(socketID string) ([]db.Contact, error)
+
+	// Moderation methods
+	Report(socketID string, report *db.Report) error
+	ListReports(socketID string, status string) ([]db.Report, error)
+	GetReport(socketID string, reportID string) (db.Report, error)
+	Moderate(socketID string, reportID string, action *db.ModerationAction) error
+	UnlockAccount(socketID string, email, ip *string) error
+
+	// Group methods
+	CreateGroup(socketID string, name *string, usernames []string) (string, error)
+	AddMember(socketID string, groupID, username *string, role string) error
+	RemoveMember(socketID string, groupID, username *string) error
+	LeaveGroup(socketID string, groupID *string) error
+	GetGroup(socketID string, groupID *string) (db.Group, error)
+	ListGroups(socketID string) ([]db.Group, error)
+	SendGroupMessage(socketID string, groupID, message *string) (string, error)
+	GetGroupMessages(socketID string, groupID *string, time *int64) ([]db.GroupMessage, error)
+
+	// Identity provider methods
+	LoginExternal(identity oidc.Identity, userAgent, ip string) (string, dt.TokenPair, error)
 
 	// DB based methods
-	CheckLogin(email, password *string) (string, error)
-	GetMessages(socketID string, otherUsername *string, time *int64) ([]db.Messages, error)
-	CreateMessage(socketID string, receiverUsername, message *string) error
+	CheckLogin(email, password *string, ip string) (string, error)
+	GetMessages(socketID string, otherUsername *string, time *int64, listingID *int64) ([]db.Messages, error)
+	CreateMessage(socketID string, receiverUsername, message *string, listingID *int64) (string, error)
+	EditMessage(socketID string, id, message *string) error
+	DeleteMessage(socketID string, id *string) error
 	UploadListing(socketID string, listing *db.Listing) error
+	GetListing(socketID string, listingID *int64) (db.Listing, error)
 	BuyListing(socketID string, listingID *int64, amount *int64) error
 	CreateProfile(username, email, password *string) error
 	GetContacts(socketID string) ([]db.Contact, error)
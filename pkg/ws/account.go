@@ -0,0 +1,191 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/mail"
+	dt "go-websocket/pkg/ws/messages"
+	"log"
+	"time"
+)
+
+// How long a user has to wait between changing their username
+const usernameCooldown = 30 * 24 * time.Hour
+
+// checkPassword confirms the current password of the user, failures count
+// towards the login limit like a login does
+func (ws WSDBProxy) checkPassword(username string, password *string) (string, error) {
+
+	email, err := (*ws.DatabaseManager).GetEmail(&username)
+
+	if err != nil {
+		return "", err
+	}
+
+	// the user already passed 2FA to be logged in
+	if _, err = ws.CheckLogin(&email, password, ""); err != nil && !errors.Is(err, auth.ErrTwoFactorRequired) {
+		var lockoutErr *auth.LockoutError
+
+		if errors.As(err, &lockoutErr) {
+			return "", err
+		}
+
+		return "", fmt.Errorf("login: current password is incorrect")
+	}
+
+	return email, nil
+}
+
+// ChangePassword sets a new password after checking the current one, every
+// other session of the user is signed out
+func (ws WSDBProxy) ChangePassword(socketID string, currentPassword, newPassword *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		email, err := ws.checkPassword(username, currentPassword)
+
+		if err != nil {
+			return err
+		}
+
+		if ws.PasswordPolicy != nil {
+			if err = ws.PasswordPolicy.Check(*newPassword, username, email); err != nil {
+				return err
+			}
+		}
+
+		if err = (*ws.DatabaseManager).SetPassword(&email, newPassword); err != nil {
+			return err
+		}
+
+		return ws.revokeAllSessions(username, ws.SessionOf(socketID))
+
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// ChangeEmail moves the account to a new email after checking the password.
+// The account keeps the old email until the new one is verified, and the old
+// one is told of the change.
+func (ws WSDBProxy) ChangeEmail(socketID string, password, newEmail *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		oldEmail, err := ws.checkPassword(username, password)
+
+		if err != nil {
+			return err
+		}
+
+		if err = (*ws.DatabaseManager).ChangeEmail(&username, newEmail); err != nil {
+			return err
+		}
+
+		if err = ws.sendVerification(*newEmail); err != nil {
+			log.Printf("error: could not send verification email: %v", err)
+		}
+
+		// Let the owner know in case the account was taken over
+		if ws.Mailer != nil {
+			err = (*ws.Mailer).Send(mail.Message{
+				To:      oldEmail,
+				Subject: "Your email is being changed",
+				Body:    "The email of your account " + username + " is being changed to " + *newEmail + ". It changes once the new email is confirmed.\n\nIf it was not you, reset your password and contact support.\n",
+			})
+
+			if err != nil {
+				log.Printf("error: could not send email change notice: %v", err)
+			}
+		}
+
+		return nil
+
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// ChangeUsername renames the user, returning an access token for the new name.
+// Old usernames keep pointing at the user for messages.
+func (ws WSDBProxy) ChangeUsername(socketID string, newUsername *string) (dt.TokenPair, error) {
+
+	if ws.DatabaseManager == nil {
+		return dt.TokenPair{}, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+		changedBefore := time.Now().Add(-usernameCooldown).Unix()
+
+		err := (*ws.DatabaseManager).ChangeUsername(&username, newUsername, changedBefore)
+
+		if err != nil {
+			return dt.TokenPair{}, err
+		}
+
+		ws.renameSockets(username, *newUsername)
+
+		// the old access token still carries the old username
+		sessionID := ws.SessionOf(socketID)
+		expirationTime := time.Now().Add(accessTokenTTL)
+		token, err := CreateToken(ws.Keys, *newUsername, sessionID, expirationTime)
+
+		if err != nil {
+			return dt.TokenPair{}, err
+		}
+
+		// the socket now lasts as long as the new token
+		if err = ws.ConnectExpiryToID(expirationTime.Unix(), socketID); err != nil {
+			return dt.TokenPair{}, err
+		}
+
+		return dt.TokenPair{
+			Token:     token,
+			ExpiresAt: expirationTime.Unix(),
+			SessionID: sessionID,
+		}, nil
+
+	}
+
+	return dt.TokenPair{}, fmt.Errorf("user is not logged in")
+}
+
+// renameSockets moves every socket of the user to the new username
+func (ws WSDBProxy) renameSockets(username, newUsername string) {
+	socketsMu.Lock()
+	defer socketsMu.Unlock()
+
+	for id, name := range ws.IdToUsername {
+		if name == username {
+			ws.IdToUsername[id] = newUsername
+		}
+	}
+}
+
+// resolveUsername follows an old username to the current one, leaving it as
+// is when nobody has had it
+func (ws WSDBProxy) resolveUsername(username *string) *string {
+
+	current, err := (*ws.DatabaseManager).ResolveUsername(username)
+
+	if err != nil {
+		return username
+	}
+
+	return &current
+}
@@ -0,0 +1,90 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/db"
+)
+
+// BlockUser stops the other user from messaging the user, buying their
+// listings or seeing them, and the other way around
+func (ws WSDBProxy) BlockUser(socketID string, username *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		blocker := ws.usernameOf(socketID)
+		blocked := ws.resolveUsername(username)
+
+		if *blocked == blocker {
+			return fmt.Errorf("blocked: cannot block yourself")
+		}
+
+		return (*ws.DatabaseManager).BlockUser(&blocker, blocked)
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// UnblockUser lets the other user reach the user again
+func (ws WSDBProxy) UnblockUser(socketID string, username *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		blocker := ws.usernameOf(socketID)
+
+		return (*ws.DatabaseManager).UnblockUser(&blocker, ws.resolveUsername(username))
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// ListBlocked returns the users the user has blocked
+func (ws WSDBProxy) ListBlocked(socketID string) ([]db.Contact, error) {
+
+	if ws.DatabaseManager == nil {
+		return nil, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		blocked, err := (*ws.DatabaseManager).GetBlocked(&username)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range blocked {
+			blocked[i].AvatarURL = ws.mediaURL(blocked[i].AvatarURL)
+		}
+
+		return blocked, nil
+	}
+
+	return nil, fmt.Errorf("user is not logged in")
+}
+
+// checkBlocked refuses anything between two users when either has blocked
+// the other
+func (ws WSDBProxy) checkBlocked(username, otherUsername string) error {
+
+	blocked, err := (*ws.DatabaseManager).IsBlocked(&username, &otherUsername)
+
+	if err != nil {
+		return err
+	}
+
+	if blocked {
+		return fmt.Errorf("blocked: one of you has blocked the other")
+	}
+
+	return nil
+}
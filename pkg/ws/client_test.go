@@ -0,0 +1,99 @@
+package ws
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gorilla/websocket"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+
+	It("Write: replies and sent messages do not write at the same time", func() {
+		const count = 50
+
+		clients := make(chan *Client, 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			conn, err := upgrader.Upgrade(w, r, nil)
+			Expect(err).To(BeNil())
+
+			clients <- &Client{Conn: conn, Send: make(chan []byte, count)}
+		}))
+		defer server.Close()
+
+		peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		Expect(err).To(BeNil())
+		defer peer.Close()
+
+		client := <-clients
+		go client.writePump()
+
+		go func() {
+			for i := 0; i < count; i++ {
+				client.Send <- []byte(`{"Command":"groupMessage"}`)
+			}
+		}()
+
+		go func() {
+			for i := 0; i < count; i++ {
+				client.reply(websocket.TextMessage, map[string]string{"Command": "loginResult"})
+			}
+		}()
+
+		received := 0
+
+		for received < 2*count {
+			_, message, err := peer.ReadMessage()
+			Expect(err).To(BeNil())
+
+			// queued messages are sent together, one per line
+			for _, line := range bytes.Split(message, newline) {
+				Expect(line).To(Or(MatchJSON(`{"Command":"groupMessage"}`), MatchJSON(`{"Command":"loginResult"}`)))
+				received++
+			}
+		}
+
+		close(client.Send)
+	})
+
+	It("Upload: sockets that are not logged in are refused before the file is read", func() {
+		var proxy WebDataProxy = WSDBProxy{
+			IdToUsername: make(map[string]string),
+		}
+
+		done := make(chan error, 1)
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer GinkgoRecover()
+
+			conn, err := upgrader.Upgrade(w, r, nil)
+			Expect(err).To(BeNil())
+
+			client := &Client{ID: "socketOne", Conn: conn, DB: &proxy}
+
+			done <- client.uploadMedia(websocket.TextMessage)
+		}))
+		defer server.Close()
+
+		peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		Expect(err).To(BeNil())
+		defer peer.Close()
+
+		Expect(peer.WriteMessage(websocket.TextMessage, []byte(`{"Purpose":"avatar"}`))).To(BeNil())
+
+		_, message, err := peer.ReadMessage()
+		Expect(err).To(BeNil())
+		Expect(message).To(MatchJSON(`{"Command":"uploadMediaResult","ResponseCode":12}`))
+
+		Expect(<-done).NotTo(BeNil(), "Socket should be closed")
+	})
+
+})
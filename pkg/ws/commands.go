@@ -0,0 +1,1605 @@
+package ws
+
+import (
+	"encoding/json"
+	"errors"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/db"
+	"go-websocket/pkg/storage"
+	ws "go-websocket/pkg/ws/messages"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// bind connects the socket to the user and session it is authenticated as
+func (c *Client) bind(username, sessionID string, expiresAt int64) error {
+
+	if err := (*c.DB).ConnectUsernameToID(&username, c.ID); err != nil {
+		return err
+	}
+
+	if sessionID != "" {
+		if err := (*c.DB).ConnectSessionToID(sessionID, c.ID); err != nil {
+			return err
+		}
+	}
+
+	if err := (*c.DB).ConnectExpiryToID(expiresAt, c.ID); err != nil {
+		return err
+	}
+
+	c.notifyTokenExpiry(expiresAt)
+
+	return nil
+}
+
+// completeLogin starts a session for the user and sends the tokens back
+func (c *Client) completeLogin(msgType int, username string) error {
+	tokens, err := (*c.DB).IssueTokens(username, c.UserAgent, c.IP)
+
+	if err != nil {
+		return err
+	}
+
+	// Bind the socket to the user for the following commands
+	if err = c.bind(username, tokens.SessionID, tokens.ExpiresAt); err != nil {
+		return err
+	}
+
+	return c.reply(msgType, ws.LoginResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "loginResult",
+		},
+		Result:       true,
+		ResponseCode: SUCCESS,
+		Username:     username,
+		TokenPair:    tokens,
+	})
+}
+
+// reply sends a result back to the socket
+func (c *Client) reply(msgType int, result interface{}) error {
+	returnJSON, err := json.Marshal(result)
+
+	if err != nil {
+		return err
+	}
+
+	return c.write(msgType, returnJSON)
+}
+
+// readData reads the JSON data that follows a command into data
+func (c *Client) readData(data interface{}) error {
+	_, jsonData, err := c.Conn.ReadMessage()
+
+	if err != nil {
+		return err
+	}
+
+	// badly formed data is handled like empty data
+	json.Unmarshal(jsonData, data)
+
+	return nil
+}
+
+// errorCode picks the response code from the "type: message" errors
+// returned by the proxy
+func errorCode(err error) byte {
+	errorType := strings.Split(err.Error(), ":")[0]
+
+	switch errorType {
+
+	case "user is not logged in":
+		return NOT_LOGGED_IN
+
+	case "session":
+		return SESSION_NOT_FOUND
+
+	case "invalid":
+		return INVALID_TOKEN
+
+	case "password":
+		return PASSWORD_INVALID
+
+	case "unverified":
+		return EMAIL_NOT_VERIFIED
+
+	case "login":
+		return INVALID_LOGIN
+
+	case "backoff":
+		return TOO_MANY_ATTEMPTS
+
+	case "locked":
+		return ACCOUNT_LOCKED
+
+	case "email":
+		return EMAIL_IN_USE
+
+	case "username":
+		return USERAME_IN_USE
+
+	case "cooldown":
+		return USERNAME_COOLDOWN
+
+	case "2fa":
+		return INVALID_CODE
+
+	case "2fa state":
+		return TWO_FACTOR_STATE
+
+	case "profile":
+		return PROFILE_INVALID
+
+	case "profile not found":
+		return PROFILE_NOT_FOUND
+
+	case "media", "media type", "media key", "media not found":
+		return MEDIA_INVALID
+
+	case "media size":
+		return MEDIA_TOO_LARGE
+
+	case "listing not found":
+		return LISTING_NOT_FOUND
+
+	case "upload":
+		return MEDIA_INVALID
+
+	case "upload not found":
+		return UPLOAD_NOT_FOUND
+
+	case "checksum":
+		return CHECKSUM_MISMATCH
+
+	case "uploads":
+		return TOO_MANY_UPLOADS
+
+	case "upload incomplete":
+		return UPLOAD_INCOMPLETE
+
+	case "quota":
+		return QUOTA_EXCEEDED
+
+	case "blocked":
+		return BLOCKED
+
+	case "report":
+		return REPORT_INVALID
+
+	case "report not found":
+		return REPORT_NOT_FOUND
+
+	case "moderator":
+		return NOT_MODERATOR
+
+	case "suspended":
+		return ACCOUNT_SUSPENDED
+
+	case "content":
+		return CONTENT_INVALID
+
+	case "content length":
+		return CONTENT_TOO_LONG
+
+	case "content banned":
+		return CONTENT_BANNED
+
+	case "content links":
+		return CONTENT_LINKS
+
+	case "message not found":
+		return MESSAGE_NOT_FOUND
+
+	case "message edit window":
+		return EDIT_WINDOW_CLOSED
+
+	case "group not found":
+		return GROUP_NOT_FOUND
+
+	case "group admin":
+		return NOT_GROUP_ADMIN
+
+	case "group":
+		return GROUP_INVALID
+
+	case "rating":
+		return RATING_INVALID
+
+	}
+
+	return UNKNOWN
+}
+
+func (c *Client) logout(msgType int) error {
+	result := ws.SessionResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "logoutResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).Logout(c.ID); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) listSessions(msgType int) error {
+	result := ws.SessionsResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "sessionsResult",
+		},
+		ResponseCode: SUCCESS,
+		Sessions:     []ws.Session{},
+	}
+
+	sessions, err := (*c.DB).ListSessions(c.ID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	current := (*c.DB).SessionOf(c.ID)
+
+	for _, session := range sessions {
+		result.Sessions = append(result.Sessions, ws.Session{
+			SessionID: session.ID,
+			UserAgent: session.UserAgent,
+			IP:        session.IP,
+			CreatedAt: session.CreatedAt.Unix(),
+			LastUsed:  session.LastUsed.Unix(),
+			Current:   session.ID == current,
+		})
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) revokeSession(msgType int) error {
+	var revoke ws.RevokeSession
+
+	if err := c.readData(&revoke); err != nil {
+		return err
+	}
+
+	result := ws.SessionResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "revokeSessionResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).RevokeSession(c.ID, revoke.SessionID); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) requestPasswordReset(msgType int) error {
+	var request ws.RequestPasswordReset
+
+	if err := c.readData(&request); err != nil {
+		return err
+	}
+
+	result := ws.PasswordResetResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "requestPasswordResetResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if !IsValid(request.Email) {
+		result.ResponseCode = EMAIL_INVALID
+		return c.reply(msgType, result)
+	}
+
+	if err := (*c.DB).RequestPasswordReset(&request.Email); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) resetPassword(msgType int) error {
+	var reset ws.ResetPassword
+
+	if err := c.readData(&reset); err != nil {
+		return err
+	}
+
+	result := ws.PasswordResetResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "resetPasswordResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).ResetPassword(&reset.Token, &reset.Password); err != nil {
+		result.ResponseCode = errorCode(err)
+
+		var policyErr *auth.PolicyError
+		if errors.As(err, &policyErr) {
+			result.Reasons = policyErr.Reasons
+		}
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) verifyEmail(msgType int) error {
+	var verify ws.VerifyEmail
+
+	if err := c.readData(&verify); err != nil {
+		return err
+	}
+
+	result := ws.VerificationResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "verifyEmailResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).VerifyEmail(&verify.Token); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) resendVerification(msgType int) error {
+	var resend ws.ResendVerification
+
+	if err := c.readData(&resend); err != nil {
+		return err
+	}
+
+	result := ws.VerificationResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "resendVerificationResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if !IsValid(resend.Email) {
+		result.ResponseCode = EMAIL_INVALID
+		return c.reply(msgType, result)
+	}
+
+	if err := (*c.DB).ResendVerification(&resend.Email); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) changePassword(msgType int) error {
+	var change ws.ChangePassword
+
+	if err := c.readData(&change); err != nil {
+		return err
+	}
+
+	result := ws.AccountResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "changePasswordResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if change.CurrentPassword == "" || len(change.CurrentPassword) > maxPasswordLength {
+		result.ResponseCode = INVALID_LOGIN
+		return c.reply(msgType, result)
+	}
+
+	if err := (*c.DB).ChangePassword(c.ID, &change.CurrentPassword, &change.NewPassword); err != nil {
+		result.ResponseCode = errorCode(err)
+
+		var policyErr *auth.PolicyError
+		if errors.As(err, &policyErr) {
+			result.Reasons = policyErr.Reasons
+		}
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) changeEmail(msgType int) error {
+	var change ws.ChangeEmail
+
+	if err := c.readData(&change); err != nil {
+		return err
+	}
+
+	result := ws.AccountResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "changeEmailResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if !IsValid(change.Email) {
+		result.ResponseCode = EMAIL_INVALID
+		return c.reply(msgType, result)
+	}
+
+	if change.Password == "" || len(change.Password) > maxPasswordLength {
+		result.ResponseCode = INVALID_LOGIN
+		return c.reply(msgType, result)
+	}
+
+	if err := (*c.DB).ChangeEmail(c.ID, &change.Password, &change.Email); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) changeUsername(msgType int) error {
+	var change ws.ChangeUsername
+
+	if err := c.readData(&change); err != nil {
+		return err
+	}
+
+	result := ws.UsernameResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "changeUsernameResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if !IsValidUsername(change.Username) {
+		result.ResponseCode = USERAME_INVALID
+		return c.reply(msgType, result)
+	}
+
+	tokens, err := (*c.DB).ChangeUsername(c.ID, &change.Username)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	c.notifyTokenExpiry(tokens.ExpiresAt)
+
+	result.Username = change.Username
+	result.Token = tokens.Token
+	result.ExpiresAt = tokens.ExpiresAt
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) verifyTwoFactor(msgType int) error {
+	var verify ws.TwoFactorCode
+
+	if err := c.readData(&verify); err != nil {
+		return err
+	}
+
+	result := ws.LoginResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "loginResult",
+		},
+		ResponseCode: INVALID_LOGIN,
+	}
+
+	// a provider login is finished on the socket, the token only works once
+	if verify.LoginToken != "" {
+		username, email, err := (*c.DB).PendingExternalLogin(verify.LoginToken)
+
+		if err != nil {
+			result.ResponseCode = errorCode(err)
+			return c.reply(msgType, result)
+		}
+
+		c.pendingLogin = &pendingLogin{
+			Username:  username,
+			Email:     email,
+			ExpiresAt: time.Now().Add(pendingLoginTTL),
+		}
+	}
+
+	pending := c.pendingLogin
+
+	// the password has to be sent again
+	if pending == nil || time.Now().After(pending.ExpiresAt) {
+		c.pendingLogin = nil
+		return c.reply(msgType, result)
+	}
+
+	err := (*c.DB).VerifyTwoFactor(pending.Username, pending.Email, c.IP, verify.Code)
+
+	if err != nil {
+		pending.Attempts++
+
+		if pending.Attempts >= maxPendingLoginAttempts {
+			c.pendingLogin = nil
+		}
+
+		result.ResponseCode = errorCode(err)
+
+		var lockoutErr *auth.LockoutError
+		if errors.As(err, &lockoutErr) {
+			result.RetryAfter = int64((lockoutErr.RetryAfter + time.Second - 1) / time.Second)
+		}
+
+		return c.reply(msgType, result)
+	}
+
+	c.pendingLogin = nil
+
+	return c.completeLogin(msgType, pending.Username)
+}
+
+func (c *Client) enableTwoFactor(msgType int) error {
+	result := ws.EnableTwoFactorResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "enable2faResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	uri, err := (*c.DB).EnableTwoFactor(c.ID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	result.URI = uri
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) confirmTwoFactor(msgType int) error {
+	var confirm ws.TwoFactorCode
+
+	if err := c.readData(&confirm); err != nil {
+		return err
+	}
+
+	result := ws.TwoFactorResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "confirm2faResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	codes, err := (*c.DB).ConfirmTwoFactor(c.ID, &confirm.Code)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	result.RecoveryCodes = codes
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) disableTwoFactor(msgType int) error {
+	var disable ws.DisableTwoFactor
+
+	if err := c.readData(&disable); err != nil {
+		return err
+	}
+
+	result := ws.TwoFactorResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "disable2faResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if disable.Password == "" || len(disable.Password) > maxPasswordLength {
+		result.ResponseCode = INVALID_LOGIN
+		return c.reply(msgType, result)
+	}
+
+	if err := (*c.DB).DisableTwoFactor(c.ID, &disable.Password, &disable.Code); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) getProfile(msgType int) error {
+	var get ws.GetProfile
+
+	if err := c.readData(&get); err != nil {
+		return err
+	}
+
+	result := ws.ProfileResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "profileResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	profile, err := (*c.DB).GetProfile(c.ID, &get.Username)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	private := profile.Private
+
+	if private == nil {
+		private = []string{}
+	}
+
+	result.Profile = &ws.Profile{
+		Username:     profile.Username,
+		DisplayName:  profile.DisplayName,
+		Bio:          profile.Bio,
+		Location:     profile.Location,
+		AvatarURL:    profile.AvatarURL,
+		ListingCount: profile.ListingCount,
+		JoinedAt:     profile.JoinedAt,
+		Rating:       profile.Rating,
+		RatingCount:  profile.RatingCount,
+		Private:      private,
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) updateProfile(msgType int) error {
+	var update ws.UpdateProfile
+
+	if err := c.readData(&update); err != nil {
+		return err
+	}
+
+	result := ws.UpdateProfileResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "updateProfileResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	profileUpdate := db.ProfileUpdate{
+		DisplayName: update.DisplayName,
+		Bio:         update.Bio,
+		Location:    update.Location,
+		AvatarURL:   update.AvatarURL,
+		Private:     update.Private,
+	}
+
+	if invalid := ValidateProfile(&profileUpdate); len(invalid) != 0 {
+		result.ResponseCode = PROFILE_INVALID
+		result.Invalid = invalid
+		return c.reply(msgType, result)
+	}
+
+	if err := (*c.DB).UpdateProfile(c.ID, &profileUpdate); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) rateSeller(msgType int) error {
+	var rate ws.RateSeller
+
+	if err := c.readData(&rate); err != nil {
+		return err
+	}
+
+	result := ws.RateSellerResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "rateSellerResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).RateSeller(c.ID, &rate.Listing, rate.Score); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) uploadMedia(msgType int) error {
+	var upload ws.UploadMedia
+
+	if err := c.readData(&upload); err != nil {
+		return err
+	}
+
+	result := ws.MediaResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "uploadMediaResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	// The file is only read for users who are logged in, anyone else is
+	// disconnected before the read limit is raised
+	if !(*c.DB).IsLoggedIn(c.ID) {
+		result.ResponseCode = NOT_LOGGED_IN
+
+		if err := c.reply(msgType, result); err != nil {
+			return err
+		}
+
+		return errors.New("upload: user is not logged in")
+	}
+
+	// Only the file is allowed to be larger than a command
+	limit := (*c.DB).MaxUploadSize()
+
+	if limit < c.readLimit {
+		limit = c.readLimit
+	}
+
+	c.Conn.SetReadLimit(limit)
+	frameType, data, err := c.Conn.ReadMessage()
+	c.Conn.SetReadLimit(c.readLimit)
+
+	if err != nil {
+		return err
+	}
+
+	if frameType != websocket.BinaryMessage {
+		result.ResponseCode = MEDIA_INVALID
+		return c.reply(msgType, result)
+	}
+
+	key, url, err := (*c.DB).UploadMedia(c.ID, upload.Purpose, data)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.Key = key
+	result.URL = url
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) uploadURL(msgType int) error {
+	var upload ws.UploadURL
+
+	if err := c.readData(&upload); err != nil {
+		return err
+	}
+
+	result := ws.UploadURLResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "uploadURLResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	url, err := (*c.DB).UploadURL(c.ID, upload.Purpose)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.URL = url
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) uploadListing(msgType int) error {
+	var upload ws.UploadListing
+
+	if err := c.readData(&upload); err != nil {
+		return err
+	}
+
+	result := ws.UploadListingResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "uploadListingResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	listing := db.Listing{
+		Title:      upload.Title,
+		Decription: upload.Description,
+		Images:     upload.Images,
+		Price:      upload.Price,
+		Sym:        upload.Sym,
+	}
+
+	if listing.Images == nil {
+		listing.Images = []string{}
+	}
+
+	if err := (*c.DB).UploadListing(c.ID, &listing); err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.Id = listing.Id
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) getListing(msgType int) error {
+	var get ws.GetListing
+
+	if err := c.readData(&get); err != nil {
+		return err
+	}
+
+	result := ws.ListingResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "listingResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	listing, err := (*c.DB).GetListing(c.ID, &get.Id)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.Listing = &ws.Listing{
+		Id:            listing.Id,
+		Title:         listing.Title,
+		Description:   listing.Decription,
+		Images:        listing.Images,
+		ImageVariants: listing.ImageVariants,
+		Price:         listing.Price,
+		Sym:           listing.Sym,
+		Active:        listing.Active,
+		Owner:         listing.Owner,
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) uploadBegin(msgType int) error {
+	var begin ws.UploadBegin
+
+	if err := c.readData(&begin); err != nil {
+		return err
+	}
+
+	status, err := (*c.DB).BeginUpload(c.ID, begin.Purpose, begin.Size, begin.Checksum)
+
+	return c.replyUploadStatus(msgType, "uploadBeginResult", status, err)
+}
+
+func (c *Client) uploadChunk(msgType int) error {
+	var chunk ws.UploadChunk
+
+	if err := c.readData(&chunk); err != nil {
+		return err
+	}
+
+	result := ws.UploadChunkResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "uploadChunkResult",
+		},
+		ResponseCode: SUCCESS,
+		UploadID:     chunk.UploadID,
+		Index:        chunk.Index,
+	}
+
+	c.Conn.SetReadLimit(maxChunkSize)
+	frameType, data, err := c.Conn.ReadMessage()
+	c.Conn.SetReadLimit(c.readLimit)
+
+	if err != nil {
+		return err
+	}
+
+	if frameType != websocket.BinaryMessage {
+		result.ResponseCode = MEDIA_INVALID
+		return c.reply(msgType, result)
+	}
+
+	if err = (*c.DB).UploadChunk(c.ID, chunk.UploadID, chunk.Index, chunk.Checksum, data); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) uploadStatus(msgType int) error {
+	var upload ws.Upload
+
+	if err := c.readData(&upload); err != nil {
+		return err
+	}
+
+	status, err := (*c.DB).UploadStatus(c.ID, upload.UploadID)
+
+	return c.replyUploadStatus(msgType, "uploadStatusResult", status, err)
+}
+
+func (c *Client) uploadCommit(msgType int) error {
+	var upload ws.Upload
+
+	if err := c.readData(&upload); err != nil {
+		return err
+	}
+
+	result := ws.MediaResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "uploadCommitResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	key, url, err := (*c.DB).CommitUpload(c.ID, upload.UploadID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.Key = key
+	result.URL = url
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) uploadAbort(msgType int) error {
+	var upload ws.Upload
+
+	if err := c.readData(&upload); err != nil {
+		return err
+	}
+
+	result := ws.UploadAbortResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "uploadAbortResult",
+		},
+		ResponseCode: SUCCESS,
+		UploadID:     upload.UploadID,
+	}
+
+	if err := (*c.DB).AbortUpload(c.ID, upload.UploadID); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) sendMessage(msgType int) error {
+	var send ws.SendMessage
+
+	if err := c.readData(&send); err != nil {
+		return err
+	}
+
+	result := ws.SendMessageResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "sendMessageResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	id, err := (*c.DB).CreateMessage(c.ID, &send.Username, &send.Message, send.Listing)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.ID = id
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) editMessage(msgType int) error {
+	var edit ws.EditMessage
+
+	if err := c.readData(&edit); err != nil {
+		return err
+	}
+
+	result := ws.EditMessageResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "editMessageResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).EditMessage(c.ID, &edit.ID, &edit.Message); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) deleteMessage(msgType int) error {
+	var remove ws.DeleteMessage
+
+	if err := c.readData(&remove); err != nil {
+		return err
+	}
+
+	result := ws.DeleteMessageResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "deleteMessageResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).DeleteMessage(c.ID, &remove.ID); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) getMessages(msgType int) error {
+	var get ws.GetMessages
+
+	if err := c.readData(&get); err != nil {
+		return err
+	}
+
+	result := ws.MessagesResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "messagesResult",
+		},
+		ResponseCode: SUCCESS,
+		Username:     get.Username,
+		Messages:     []ws.Message{},
+	}
+
+	messages, err := (*c.DB).GetMessages(c.ID, &get.Username, &get.After, get.Listing)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	// the thread is still returned when the listing can no longer be seen
+	if get.Listing != nil {
+		if listing, err := (*c.DB).GetListing(c.ID, get.Listing); err == nil {
+			result.Listing = listingSummary(listing)
+		}
+	}
+
+	for _, message := range messages {
+		result.Messages = append(result.Messages, ws.Message{
+			ID:       message.ID,
+			Contents: message.Contents,
+			Time:     message.Time,
+			Read:     message.Read,
+			Sender:   message.Sender,
+			Edited:   message.Edited,
+			Deleted:  message.Deleted,
+		})
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) getContacts(msgType int) error {
+	result := ws.ContactsResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "contactsResult",
+		},
+		ResponseCode: SUCCESS,
+		Contacts:     []ws.Contact{},
+	}
+
+	contacts, err := (*c.DB).GetContacts(c.ID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	for _, contact := range contacts {
+		result.Contacts = append(result.Contacts, ws.Contact{
+			Username:     contact.Username,
+			AvatarURL:    contact.AvatarURL,
+			Listing:      contact.Listing,
+			ListingTitle: contact.ListingTitle,
+		})
+	}
+
+	return c.reply(msgType, result)
+}
+
+func listingSummary(listing db.Listing) *ws.ListingSummary {
+	summary := &ws.ListingSummary{
+		Id:     listing.Id,
+		Title:  listing.Title,
+		Price:  listing.Price,
+		Sym:    listing.Sym,
+		Active: listing.Active,
+		Owner:  listing.Owner,
+	}
+
+	if len(listing.ImageVariants) > 0 && listing.ImageVariants[0]["thumb"] != "" {
+		summary.Image = listing.ImageVariants[0]["thumb"]
+	} else if len(listing.Images) > 0 {
+		summary.Image = listing.Images[0]
+	}
+
+	return summary
+}
+
+func (c *Client) createGroup(msgType int) error {
+	var create ws.CreateGroup
+
+	if err := c.readData(&create); err != nil {
+		return err
+	}
+
+	result := ws.CreateGroupResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "createGroupResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	id, err := (*c.DB).CreateGroup(c.ID, &create.Name, create.Usernames)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.GroupID = id
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) addMember(msgType int) error {
+	var add ws.AddMember
+
+	if err := c.readData(&add); err != nil {
+		return err
+	}
+
+	result := ws.AddMemberResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "addMemberResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).AddMember(c.ID, &add.GroupID, &add.Username, add.Role); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) removeMember(msgType int) error {
+	var remove ws.RemoveMember
+
+	if err := c.readData(&remove); err != nil {
+		return err
+	}
+
+	result := ws.RemoveMemberResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "removeMemberResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).RemoveMember(c.ID, &remove.GroupID, &remove.Username); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) leaveGroup(msgType int) error {
+	var leave ws.LeaveGroup
+
+	if err := c.readData(&leave); err != nil {
+		return err
+	}
+
+	result := ws.LeaveGroupResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "leaveGroupResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).LeaveGroup(c.ID, &leave.GroupID); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) getGroup(msgType int) error {
+	var get ws.GetGroup
+
+	if err := c.readData(&get); err != nil {
+		return err
+	}
+
+	result := ws.GroupResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "groupResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	group, err := (*c.DB).GetGroup(c.ID, &get.GroupID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.Group = groupSummary(group)
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) listGroups(msgType int) error {
+	result := ws.GroupsResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "groupsResult",
+		},
+		ResponseCode: SUCCESS,
+		Groups:       []ws.Group{},
+	}
+
+	groups, err := (*c.DB).ListGroups(c.ID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	for _, group := range groups {
+		result.Groups = append(result.Groups, groupSummary(group))
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) sendGroupMessage(msgType int) error {
+	var send ws.SendGroupMessage
+
+	if err := c.readData(&send); err != nil {
+		return err
+	}
+
+	result := ws.SendGroupMessageResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "sendGroupMessageResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	id, err := (*c.DB).SendGroupMessage(c.ID, &send.GroupID, &send.Message)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.ID = id
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) getGroupMessages(msgType int) error {
+	var get ws.GetGroupMessages
+
+	if err := c.readData(&get); err != nil {
+		return err
+	}
+
+	result := ws.GroupMessagesResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "groupMessagesResult",
+		},
+		ResponseCode: SUCCESS,
+		GroupID:      get.GroupID,
+		Messages:     []ws.GroupMessageSummary{},
+	}
+
+	messages, err := (*c.DB).GetGroupMessages(c.ID, &get.GroupID, &get.After)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	for _, message := range messages {
+		result.Messages = append(result.Messages, ws.GroupMessageSummary{
+			ID:       message.ID,
+			Username: message.Sender,
+			Contents: message.Contents,
+			Time:     message.Time,
+		})
+	}
+
+	return c.reply(msgType, result)
+}
+
+func groupSummary(group db.Group) ws.Group {
+	summary := ws.Group{
+		ID:        group.ID,
+		Name:      group.Name,
+		CreatedAt: group.CreatedAt,
+	}
+
+	for _, member := range group.Members {
+		summary.Members = append(summary.Members, ws.GroupMember{
+			Username:  member.Username,
+			AvatarURL: member.AvatarURL,
+			Role:      member.Role,
+		})
+	}
+
+	return summary
+}
+
+func (c *Client) blockUser(msgType int) error {
+	var block ws.BlockUser
+
+	if err := c.readData(&block); err != nil {
+		return err
+	}
+
+	result := ws.BlockUserResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "blockUserResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).BlockUser(c.ID, &block.Username); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) unblockUser(msgType int) error {
+	var unblock ws.BlockUser
+
+	if err := c.readData(&unblock); err != nil {
+		return err
+	}
+
+	result := ws.BlockUserResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "unblockUserResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).UnblockUser(c.ID, &unblock.Username); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) listBlocked(msgType int) error {
+	result := ws.BlockedResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "blockedResult",
+		},
+		ResponseCode: SUCCESS,
+		Users:        []ws.BlockedUser{},
+	}
+
+	blocked, err := (*c.DB).ListBlocked(c.ID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	for _, user := range blocked {
+		result.Users = append(result.Users, ws.BlockedUser{
+			Username:  user.Username,
+			AvatarURL: user.AvatarURL,
+		})
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) report(msgType int) error {
+	var report ws.Report
+
+	if err := c.readData(&report); err != nil {
+		return err
+	}
+
+	result := ws.ReportResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "reportResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	filed := db.Report{
+		Type:      report.Type,
+		Listing:   report.Listing,
+		Username:  report.Username,
+		MessageID: report.MessageID,
+		Reason:    report.Reason,
+		Details:   report.Details,
+	}
+
+	if err := (*c.DB).Report(c.ID, &filed); err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.ReportID = filed.ID
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) listReports(msgType int) error {
+	var list ws.ListReports
+
+	if err := c.readData(&list); err != nil {
+		return err
+	}
+
+	result := ws.ReportsResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "reportsResult",
+		},
+		ResponseCode: SUCCESS,
+		Reports:      []ws.ReportSummary{},
+	}
+
+	reports, err := (*c.DB).ListReports(c.ID, list.Status)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	for _, report := range reports {
+		result.Reports = append(result.Reports, reportSummary(report))
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) getReport(msgType int) error {
+	var get ws.GetReport
+
+	if err := c.readData(&get); err != nil {
+		return err
+	}
+
+	result := ws.ReportDetailsResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "reportDetailsResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	report, err := (*c.DB).GetReport(c.ID, get.ReportID)
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.Report = &ws.ReportDetails{
+		ReportSummary: reportSummary(report),
+		Actions:       []ws.ModerationAction{},
+	}
+
+	for _, action := range report.Actions {
+		result.Report.Actions = append(result.Report.Actions, ws.ModerationAction{
+			Moderator: action.Moderator,
+			Action:    action.Action,
+			Note:      action.Note,
+			CreatedAt: action.CreatedAt,
+		})
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) moderate(msgType int) error {
+	var moderate ws.Moderate
+
+	if err := c.readData(&moderate); err != nil {
+		return err
+	}
+
+	result := ws.ModerateResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "moderateResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	action := db.ModerationAction{
+		Action: moderate.Action,
+		Note:   moderate.Note,
+	}
+
+	if err := (*c.DB).Moderate(c.ID, moderate.ReportID, &action); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func (c *Client) unlockAccount(msgType int) error {
+	var unlock ws.UnlockAccount
+
+	if err := c.readData(&unlock); err != nil {
+		return err
+	}
+
+	result := ws.UnlockAccountResult{
+		BaseMessage: ws.BaseMessage{
+			Command: "unlockAccountResult",
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err := (*c.DB).UnlockAccount(c.ID, &unlock.Email, &unlock.IP); err != nil {
+		result.ResponseCode = errorCode(err)
+	}
+
+	return c.reply(msgType, result)
+}
+
+func reportSummary(report db.Report) ws.ReportSummary {
+	return ws.ReportSummary{
+		ID:        report.ID,
+		Reporter:  report.Reporter,
+		Type:      report.Type,
+		Listing:   report.Listing,
+		Username:  report.Username,
+		MessageID: report.MessageID,
+		Content:   report.Content,
+		Reason:    report.Reason,
+		Details:   report.Details,
+		Status:    report.Status,
+		CreatedAt: report.CreatedAt,
+	}
+}
+
+// replyUploadStatus sends where an upload is up to
+func (c *Client) replyUploadStatus(msgType int, command string, status storage.UploadStatus, err error) error {
+	result := ws.UploadStatusResult{
+		BaseMessage: ws.BaseMessage{
+			Command: command,
+		},
+		ResponseCode: SUCCESS,
+	}
+
+	if err != nil {
+		result.ResponseCode = errorCode(err)
+		return c.reply(msgType, result)
+	}
+
+	result.UploadID = status.ID
+	result.ChunkSize = status.ChunkSize
+	result.Chunks = status.Chunks
+	result.Received = status.Received
+
+	return c.reply(msgType, result)
+}
@@ -0,0 +1,73 @@
+package ws
+
+import (
+	"encoding/json"
+	"go-websocket/pkg/content"
+	"go-websocket/pkg/db"
+	"go-websocket/pkg/storage"
+	dt "go-websocket/pkg/ws/messages"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Content", func() {
+
+	It("Listing: cleans the title and description", func() {
+		bridge := WSDBProxy{Content: content.DefaultRules()}
+
+		listing := db.Listing{Title: "  Bike <b>cheap</b>\u200b ", Decription: "Line one\r\nLine two"}
+
+		Expect(bridge.cleanListing(&listing)).To(BeNil())
+		Expect(listing.Title).To(Equal("Bike &lt;b&gt;cheap&lt;/b&gt;"))
+		Expect(listing.Decription).To(Equal("Line one\nLine two"))
+	})
+
+	It("Listing: refuses titles that are too long or have links", func() {
+		bridge := WSDBProxy{Content: content.DefaultRules()}
+
+		listing := db.Listing{Title: strings.Repeat("a", 101)}
+		err := bridge.cleanListing(&listing)
+		Expect(err).NotTo(BeNil())
+		Expect(errorCode(err)).To(Equal(CONTENT_TOO_LONG))
+
+		listing = db.Listing{Title: "See https://example.com"}
+		err = bridge.cleanListing(&listing)
+		Expect(err).NotTo(BeNil())
+		Expect(errorCode(err)).To(Equal(CONTENT_LINKS))
+	})
+
+	It("Listing: is stored as sent without rules", func() {
+		bridge := WSDBProxy{}
+
+		listing := db.Listing{Title: " <b> "}
+		Expect(bridge.cleanListing(&listing)).To(BeNil())
+		Expect(listing.Title).To(Equal(" <b> "))
+	})
+
+	It("Read limit: the longest listing fits in a text message", func() {
+		bridge := WSDBProxy{Content: content.DefaultRules()}
+
+		images := make([]string, maxListingImages)
+
+		for i := range images {
+			images[i] = storage.NewKey(MediaListing, ".jpg")
+		}
+
+		// '<' is escaped to the six bytes \u003c
+		listing, _ := json.Marshal(dt.UploadListing{
+			Title:       strings.Repeat("<", bridge.Content.ListingTitle.MaxLength),
+			Description: strings.Repeat("<", bridge.Content.ListingDescription.MaxLength),
+			Images:      images,
+			Price:       12,
+			Sym:         "ETH",
+		})
+
+		Expect(int64(len(listing))).To(BeNumerically("<=", bridge.MaxMessageSize()))
+
+		bridge.Content.ListingDescription.MaxLength = 20000
+		Expect(bridge.MaxMessageSize()).To(BeNumerically(">", 20000*maxBytesPerChar), "The limit should follow the rules")
+	})
+
+})
@@ -0,0 +1,195 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/db"
+	"go-websocket/pkg/oidc"
+	dt "go-websocket/pkg/ws/messages"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// LoginExternal starts a session for someone an identity provider has logged
+// in, making their account the first time
+func (ws WSDBProxy) LoginExternal(identity oidc.Identity, userAgent, ip string) (string, dt.TokenPair, error) {
+
+	if ws.DatabaseManager == nil {
+		return "", dt.TokenPair{}, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if identity.Email == "" || !IsValid(identity.Email) {
+		return "", dt.TokenPair{}, fmt.Errorf("email: the provider did not give a valid email")
+	}
+
+	username, created, err := (*ws.DatabaseManager).LoginExternal(&db.ExternalIdentity{
+		Provider:      identity.Provider,
+		Subject:       identity.Subject,
+		Email:         identity.Email,
+		EmailVerified: identity.EmailVerified,
+		Username:      usernameFor(identity),
+	})
+
+	if err != nil {
+		return "", dt.TokenPair{}, err
+	}
+
+	// otherwise the account is removed with the other unverified ones
+	if created && !identity.EmailVerified {
+		if err = ws.sendVerification(identity.Email); err != nil {
+			log.Printf("error: could not send verification email: %v", err)
+		}
+	}
+
+	if err = ws.checkSuspended(username); err != nil {
+		return "", dt.TokenPair{}, err
+	}
+
+	// The provider only stands in for the password, it cannot skip the code
+	enabled, err := ws.twoFactorEnabled(username)
+
+	if err != nil {
+		return "", dt.TokenPair{}, err
+	}
+
+	if enabled {
+		return "", dt.TokenPair{}, ws.pendingExternalLogin(username)
+	}
+
+	tokens, err := ws.IssueTokens(username, userAgent, ip)
+
+	return username, tokens, err
+}
+
+// TwoFactorPendingError is a provider login that still needs a code, the
+// login token lets a socket finish it with verify2fa
+type TwoFactorPendingError struct {
+	LoginToken string
+}
+
+func (e *TwoFactorPendingError) Error() string {
+	return auth.ErrTwoFactorRequired.Error()
+}
+
+func (e *TwoFactorPendingError) Unwrap() error {
+	return auth.ErrTwoFactorRequired
+}
+
+// pendingExternalLogin issues the login token for a provider login that
+// needs a code, without a OneTimeStore the login cannot be finished
+func (ws WSDBProxy) pendingExternalLogin(username string) error {
+
+	if ws.OneTimeStore == nil {
+		return auth.ErrTwoFactorRequired
+	}
+
+	token, hash := auth.NewRefreshToken()
+
+	err := (*ws.OneTimeStore).Create(auth.OneTimeToken{
+		Hash:      hash,
+		Purpose:   auth.PurposeTwoFactorLogin,
+		Subject:   username,
+		ExpiresAt: time.Now().Add(pendingLoginTTL),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return &TwoFactorPendingError{LoginToken: token}
+}
+
+// usernameFor picks a username for a new account from the name the provider
+// suggests or the email, leaving room for a suffix if it is taken
+func usernameFor(identity oidc.Identity) string {
+	name := identity.PreferredUsername
+
+	if name == "" {
+		name = strings.Split(identity.Email, "@")[0]
+	}
+
+	var username strings.Builder
+
+	for _, char := range name {
+		if char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || strings.ContainsRune("._-", char) {
+			username.WriteRune(char)
+		}
+	}
+
+	result := username.String()
+
+	if len(result) > 27 {
+		result = result[:27]
+	}
+
+	if len(result) < 3 {
+		result = "user" + result
+	}
+
+	return result
+}
+
+// ExternalLogin returns the function that finishes a login through an
+// identity provider. The browser is sent back to redirectURL with the tokens
+// in the fragment, which is never sent to a server, and the access token is
+// also set as the "token" cookie for the websocket handshake.
+func ExternalLogin(proxy *WebDataProxy, redirectURL string) oidc.LoginFunc {
+	return func(w http.ResponseWriter, r *http.Request, identity oidc.Identity) {
+
+		username, tokens, err := (*proxy).LoginExternal(identity, r.UserAgent(), remoteIP(r))
+
+		if err != nil {
+			ExternalLoginError(redirectURL)(w, r, err)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     "token",
+			Value:    tokens.Token,
+			Path:     "/",
+			Expires:  time.Unix(tokens.ExpiresAt, 0),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		fragment := url.Values{}
+		fragment.Set("Username", username)
+		fragment.Set("RefreshToken", tokens.RefreshToken)
+		fragment.Set("RefreshExpiresAt", fmt.Sprint(tokens.RefreshExpiresAt))
+		fragment.Set("SessionID", tokens.SessionID)
+
+		http.Redirect(w, r, redirectURL+"#"+fragment.Encode(), http.StatusFound)
+	}
+}
+
+// ExternalLoginError sends the browser back to redirectURL with the response
+// code of the error in the fragment
+func ExternalLoginError(redirectURL string) oidc.ErrorFunc {
+	return func(w http.ResponseWriter, r *http.Request, err error) {
+
+		log.Println("external login failed: ", err)
+
+		code := errorCode(err)
+
+		if err == oidc.ErrInvalidState {
+			code = INVALID_TOKEN
+		} else if errors.Is(err, auth.ErrTwoFactorRequired) {
+			code = TWO_FACTOR_REQUIRED
+		}
+
+		fragment := url.Values{}
+		fragment.Set("ResponseCode", fmt.Sprint(code))
+
+		var pendingErr *TwoFactorPendingError
+		if errors.As(err, &pendingErr) {
+			fragment.Set("LoginToken", pendingErr.LoginToken)
+		}
+
+		http.Redirect(w, r, redirectURL+"#"+fragment.Encode(), http.StatusFound)
+	}
+}
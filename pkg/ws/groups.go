@@ -0,0 +1,395 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/db"
+	dt "go-websocket/pkg/ws/messages"
+	"strings"
+	"time"
+)
+
+// Most members a group can have, admins included
+const maxGroupMembers = 50
+
+// CreateGroup makes a group with the socket as its admin and the users as
+// members, and returns its ID
+func (ws WSDBProxy) CreateGroup(socketID string, name *string, usernames []string) (string, error) {
+
+	if ws.DatabaseManager == nil {
+		return "", fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		creator := ws.usernameOf(socketID)
+
+		cleaned, err := ws.cleanGroupName(*name)
+
+		if err != nil {
+			return "", err
+		}
+
+		// old usernames reach the renamed user, and each user is added once
+		members := []string{}
+		seen := map[string]bool{creator: true}
+
+		for i := range usernames {
+			member := *ws.resolveUsername(&usernames[i])
+
+			if seen[member] {
+				continue
+			}
+
+			seen[member] = true
+
+			if err = ws.checkBlocked(creator, member); err != nil {
+				return "", err
+			}
+
+			members = append(members, member)
+		}
+
+		if len(members)+1 > maxGroupMembers {
+			return "", fmt.Errorf("group: groups are limited to %d members", maxGroupMembers)
+		}
+
+		id, err := (*ws.DatabaseManager).CreateGroup(&creator, &cleaned, members)
+
+		if err != nil {
+			return "", err
+		}
+
+		ws.notifyGroup(members, "", dt.GroupChanged{
+			BaseMessage: dt.BaseMessage{
+				Command: "groupChanged",
+			},
+			GroupID: id,
+		})
+
+		return id, nil
+	}
+
+	return "", fmt.Errorf("user is not logged in")
+}
+
+// AddMember adds the user to the group or changes their role, only admins
+// can
+func (ws WSDBProxy) AddMember(socketID string, groupID, username *string, role string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		admin := ws.usernameOf(socketID)
+
+		if role == "" {
+			role = db.GroupRoleMember
+		}
+
+		if role != db.GroupRoleMember && role != db.GroupRoleAdmin {
+			return fmt.Errorf("group: %q is not a role", role)
+		}
+
+		group, err := ws.adminGroup(admin, groupID)
+
+		if err != nil {
+			return err
+		}
+
+		member := ws.resolveUsername(username)
+
+		if *member == admin {
+			return fmt.Errorf("group: cannot change your own role")
+		}
+
+		if _, isMember := memberOf(group, *member); !isMember {
+			if len(group.Members) >= maxGroupMembers {
+				return fmt.Errorf("group: groups are limited to %d members", maxGroupMembers)
+			}
+
+			if err = ws.checkBlocked(admin, *member); err != nil {
+				return err
+			}
+		}
+
+		if err = (*ws.DatabaseManager).SetGroupMember(groupID, member, role); err != nil {
+			return err
+		}
+
+		ws.notifyGroup(append(usernamesOf(group), *member), admin, dt.GroupChanged{
+			BaseMessage: dt.BaseMessage{
+				Command: "groupChanged",
+			},
+			GroupID: group.ID,
+		})
+
+		return nil
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// RemoveMember takes the user out of the group, only admins can
+func (ws WSDBProxy) RemoveMember(socketID string, groupID, username *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		admin := ws.usernameOf(socketID)
+
+		group, err := ws.adminGroup(admin, groupID)
+
+		if err != nil {
+			return err
+		}
+
+		if err = (*ws.DatabaseManager).RemoveGroupMember(groupID, ws.resolveUsername(username)); err != nil {
+			return err
+		}
+
+		// the removed member is told too
+		ws.notifyGroup(usernamesOf(group), admin, dt.GroupChanged{
+			BaseMessage: dt.BaseMessage{
+				Command: "groupChanged",
+			},
+			GroupID: group.ID,
+		})
+
+		return nil
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// LeaveGroup takes the socket out of the group, the group is deleted when
+// nobody is left
+func (ws WSDBProxy) LeaveGroup(socketID string, groupID *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		group, err := ws.memberGroup(username, groupID)
+
+		if err != nil {
+			return err
+		}
+
+		if err = (*ws.DatabaseManager).RemoveGroupMember(groupID, &username); err != nil {
+			return err
+		}
+
+		ws.notifyGroup(usernamesOf(group), username, dt.GroupChanged{
+			BaseMessage: dt.BaseMessage{
+				Command: "groupChanged",
+			},
+			GroupID: group.ID,
+		})
+
+		return nil
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// GetGroup returns the group with its members, only to members
+func (ws WSDBProxy) GetGroup(socketID string, groupID *string) (db.Group, error) {
+
+	if ws.DatabaseManager == nil {
+		return db.Group{}, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		group, err := ws.memberGroup(ws.usernameOf(socketID), groupID)
+
+		if err != nil {
+			return db.Group{}, err
+		}
+
+		for i := range group.Members {
+			group.Members[i].AvatarURL = ws.mediaURL(group.Members[i].AvatarURL)
+		}
+
+		return group, nil
+	}
+
+	return db.Group{}, fmt.Errorf("user is not logged in")
+}
+
+// ListGroups returns the groups the socket is a member of
+func (ws WSDBProxy) ListGroups(socketID string) ([]db.Group, error) {
+
+	if ws.DatabaseManager == nil {
+		return nil, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		return (*ws.DatabaseManager).GetGroups(&username)
+	}
+
+	return nil, fmt.Errorf("user is not logged in")
+}
+
+// SendGroupMessage sends the message to the group and every other member,
+// and returns its ID
+func (ws WSDBProxy) SendGroupMessage(socketID string, groupID, message *string) (string, error) {
+
+	if ws.DatabaseManager == nil {
+		return "", fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		group, err := ws.memberGroup(username, groupID)
+
+		if err != nil {
+			return "", err
+		}
+
+		if ws.Content != nil {
+			cleaned, err := ws.Content.Message.Clean(*message)
+
+			if err != nil {
+				return "", err
+			}
+
+			message = &cleaned.Text
+		}
+
+		id, err := (*ws.DatabaseManager).CreateGroupMessage(&username, groupID, message)
+
+		if err != nil {
+			return "", err
+		}
+
+		ws.notifyGroup(usernamesOf(group), username, dt.GroupMessage{
+			BaseMessage: dt.BaseMessage{
+				Command: "groupMessage",
+			},
+			GroupID:  group.ID,
+			ID:       id,
+			Username: username,
+			Contents: *message,
+			Time:     time.Now().Unix(),
+		})
+
+		return id, nil
+	}
+
+	return "", fmt.Errorf("user is not logged in")
+}
+
+// GetGroupMessages returns up to 10 messages of the group sent after the
+// time, only to members
+func (ws WSDBProxy) GetGroupMessages(socketID string, groupID *string, after *int64) ([]db.GroupMessage, error) {
+
+	if ws.DatabaseManager == nil {
+		return nil, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		if _, err := ws.memberGroup(ws.usernameOf(socketID), groupID); err != nil {
+			return nil, err
+		}
+
+		return (*ws.DatabaseManager).GetGroupMessages(groupID, after)
+	}
+
+	return nil, fmt.Errorf("user is not logged in")
+}
+
+// memberGroup returns the group if the user is a member, groups of other
+// users are not found
+func (ws WSDBProxy) memberGroup(username string, groupID *string) (db.Group, error) {
+	group, err := (*ws.DatabaseManager).GetGroup(groupID)
+
+	if err != nil {
+		return db.Group{}, err
+	}
+
+	if _, isMember := memberOf(group, username); !isMember {
+		return db.Group{}, fmt.Errorf("group not found: %s", *groupID)
+	}
+
+	return group, nil
+}
+
+// adminGroup returns the group if the user is one of its admins
+func (ws WSDBProxy) adminGroup(username string, groupID *string) (db.Group, error) {
+	group, err := ws.memberGroup(username, groupID)
+
+	if err != nil {
+		return db.Group{}, err
+	}
+
+	if member, _ := memberOf(group, username); member.Role != db.GroupRoleAdmin {
+		return db.Group{}, fmt.Errorf("group admin: only admins can change members")
+	}
+
+	return group, nil
+}
+
+// cleanGroupName checks the name with the content rules, or only that it is
+// not empty without them
+func (ws WSDBProxy) cleanGroupName(name string) (string, error) {
+	if ws.Content != nil {
+		cleaned, err := ws.Content.GroupName.Clean(name)
+
+		if err != nil {
+			return "", err
+		}
+
+		return cleaned.Text, nil
+	}
+
+	if strings.TrimSpace(name) == "" {
+		return "", fmt.Errorf("group: name is missing")
+	}
+
+	return name, nil
+}
+
+// notifyGroup sends the event to the members except the one who caused it
+func (ws WSDBProxy) notifyGroup(usernames []string, except string, event interface{}) {
+	for _, username := range usernames {
+		if username != except {
+			ws.notify(username, event)
+		}
+	}
+}
+
+func memberOf(group db.Group, username string) (db.GroupMember, bool) {
+	for _, member := range group.Members {
+		if member.Username == username {
+			return member, true
+		}
+	}
+
+	return db.GroupMember{}, false
+}
+
+func usernamesOf(group db.Group) []string {
+	usernames := make([]string, 0, len(group.Members))
+
+	for _, member := range group.Members {
+		usernames = append(usernames, member.Username)
+	}
+
+	return usernames
+}
@@ -0,0 +1,49 @@
+package ws
+
+import (
+	"go-websocket/pkg/content"
+	"go-websocket/pkg/db"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Groups", func() {
+
+	It("Name: is cleaned with the rules", func() {
+		bridge := WSDBProxy{Content: content.DefaultRules()}
+
+		name, err := bridge.cleanGroupName("  Bikes & parts ")
+		Expect(err).To(BeNil())
+		Expect(name).To(Equal("Bikes &amp; parts"))
+
+		_, err = bridge.cleanGroupName(" ")
+		Expect(err).NotTo(BeNil())
+		Expect(errorCode(err)).To(Equal(CONTENT_INVALID))
+	})
+
+	It("Name: is only required without rules", func() {
+		bridge := WSDBProxy{}
+
+		_, err := bridge.cleanGroupName(" ")
+		Expect(err).NotTo(BeNil())
+		Expect(errorCode(err)).To(Equal(GROUP_INVALID))
+	})
+
+	It("Members: are found by username", func() {
+		group := db.Group{Members: []db.GroupMember{
+			{Username: "some", Role: db.GroupRoleAdmin},
+			{Username: "some-user", Role: db.GroupRoleMember},
+		}}
+
+		member, isMember := memberOf(group, "some")
+		Expect(isMember).To(BeTrue())
+		Expect(member.Role).To(Equal(db.GroupRoleAdmin))
+
+		_, isMember = memberOf(group, "another")
+		Expect(isMember).To(BeFalse())
+
+		Expect(usernamesOf(group)).To(Equal([]string{"some", "some-user"}))
+	})
+
+})
@@ -0,0 +1,37 @@
+package ws
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Hub", func() {
+
+	It("Notify: only reaches the sockets of the user", func() {
+		var proxy WebDataProxy = WSDBProxy{
+			IdToUsername: map[string]string{
+				"socketOne":   "some-user",
+				"socketTwo":   "some-user",
+				"socketThree": "some",
+			},
+		}
+
+		hub := NewHub()
+		go hub.Run()
+
+		one := &Client{ID: "socketOne", Send: make(chan []byte, 1), DB: &proxy}
+		two := &Client{ID: "socketTwo", Send: make(chan []byte, 1), DB: &proxy}
+		three := &Client{ID: "socketThree", Send: make(chan []byte, 1), DB: &proxy}
+
+		hub.Register <- one
+		hub.Register <- two
+		hub.Register <- three
+
+		hub.Notify("some-user", map[string]string{"Command": "messageDeleted"})
+
+		Eventually(one.Send).Should(Receive(MatchJSON(`{"Command": "messageDeleted"}`)))
+		Eventually(two.Send).Should(Receive())
+		Consistently(three.Send).ShouldNot(Receive(), "Other users should not get the event")
+	})
+
+})
@@ -0,0 +1,352 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-websocket/pkg/db"
+	"go-websocket/pkg/storage"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// What media can be uploaded for, keys are stored under these prefixes
+const (
+	MediaAvatar  = "avatar"
+	MediaListing = "listing"
+)
+
+// Most images a listing can have
+const maxListingImages = 10
+
+// UploadMedia stores an upload from the socket, returning its key and URL.
+// An avatar replaces the avatar of the user straight away, listing images are
+// referenced by key when the listing is uploaded.
+func (ws WSDBProxy) UploadMedia(socketID string, purpose string, data []byte) (string, string, error) {
+
+	if ws.Media == nil {
+		return "", "", fmt.Errorf("Media has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+		return ws.storeMedia(ws.usernameOf(socketID), purpose, data)
+	}
+
+	return "", "", fmt.Errorf("user is not logged in")
+}
+
+// UploadURL returns a URL the user can upload media to over HTTP until it
+// expires
+func (ws WSDBProxy) UploadURL(socketID string, purpose string) (string, error) {
+
+	if ws.UploadSigner == nil {
+		return "", fmt.Errorf("UploadSigner has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		if err := validPurpose(purpose); err != nil {
+			return "", err
+		}
+
+		return ws.UploadSigner.Sign(ws.usernameOf(socketID), purpose), nil
+
+	}
+
+	return "", fmt.Errorf("user is not logged in")
+}
+
+// UploadSigned stores an upload sent to a signed upload URL
+func (ws WSDBProxy) UploadSigned(query url.Values, data []byte) (string, string, error) {
+
+	if ws.Media == nil || ws.UploadSigner == nil {
+		return "", "", fmt.Errorf("Media has not been intialised")
+	}
+
+	username, purpose, err := ws.UploadSigner.Verify(query)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	// the user may have been renamed since the URL was signed
+	return ws.storeMedia(*ws.resolveUsername(&username), purpose, data)
+}
+
+// MaxUploadSize is the largest upload accepted, 0 when uploads are disabled
+func (ws WSDBProxy) MaxUploadSize() int64 {
+	if ws.Media == nil {
+		return 0
+	}
+
+	return ws.Media.MaxSize
+}
+
+func (ws WSDBProxy) storeMedia(username, purpose string, data []byte) (string, string, error) {
+
+	if ws.DatabaseManager == nil {
+		return "", "", fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if err := validPurpose(purpose); err != nil {
+		return "", "", err
+	}
+
+	if err := ws.requireVerified(username); err != nil {
+		return "", "", err
+	}
+
+	if err := ws.checkQuota(username, int64(len(data))); err != nil {
+		return "", "", err
+	}
+
+	ctx := context.Background()
+
+	media, err := ws.putMedia(ctx, purpose, data)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if err = (*ws.DatabaseManager).AddMedia(&username, &media); err != nil {
+		ws.deleteMedia(ctx, media)
+		return "", "", err
+	}
+
+	if purpose == MediaAvatar {
+		if err = ws.setAvatar(username, media.Key); err != nil {
+			return "", "", err
+		}
+	}
+
+	return media.Key, ws.mediaURL(media.Key), nil
+}
+
+// putMedia puts the upload in storage. With Imaging it is re-encoded first,
+// which leaves its metadata behind, and listing images get their variants.
+func (ws WSDBProxy) putMedia(ctx context.Context, purpose string, data []byte) (db.Media, error) {
+
+	if ws.Imaging == nil {
+		key, contentType, err := ws.Media.Store(ctx, purpose, data)
+
+		return db.Media{Key: key, ContentType: contentType, Size: int64(len(data)), Purpose: purpose}, err
+	}
+
+	// checked as uploaded, re-encoding may make it larger
+	if _, err := ws.Media.Sniff(data); err != nil {
+		return db.Media{}, err
+	}
+
+	processed, err := ws.Imaging.Process(data, purpose == MediaListing)
+
+	if err != nil {
+		return db.Media{}, err
+	}
+
+	media := db.Media{
+		Key:         storage.NewKey(purpose, processed.Extension),
+		ContentType: processed.ContentType,
+		Size:        int64(len(processed.Data)),
+		Purpose:     purpose,
+	}
+
+	if err = ws.Media.Storage.Put(ctx, media.Key, processed.Data, media.ContentType); err != nil {
+		return db.Media{}, err
+	}
+
+	for _, variant := range ws.Imaging.Variants {
+		output, ok := processed.Variants[variant.Name]
+
+		if !ok {
+			continue
+		}
+
+		stored := db.MediaVariant{
+			Name:        variant.Name,
+			Key:         variantKey(media.Key, variant.Name, output.Extension),
+			ContentType: output.ContentType,
+			Size:        int64(len(output.Data)),
+		}
+
+		if err = ws.Media.Storage.Put(ctx, stored.Key, output.Data, stored.ContentType); err != nil {
+			ws.deleteMedia(ctx, media)
+			return db.Media{}, err
+		}
+
+		media.Variants = append(media.Variants, stored)
+	}
+
+	return media, nil
+}
+
+// deleteMedia removes the objects of media that could not be recorded
+func (ws WSDBProxy) deleteMedia(ctx context.Context, media db.Media) {
+	ws.Media.Storage.Delete(ctx, media.Key)
+
+	for _, variant := range media.Variants {
+		ws.Media.Storage.Delete(ctx, variant.Key)
+	}
+}
+
+// variantKey is the key of the image with the variant name added, so
+// "listing/abc.jpg" has its thumb at "listing/abc-thumb.jpg"
+func variantKey(key, name, extension string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + "-" + name + extension
+}
+
+// setAvatar points the profile at the key, removing the avatar it replaces
+// if it was an upload
+func (ws WSDBProxy) setAvatar(username, key string) error {
+
+	previous, err := (*ws.DatabaseManager).GetProfile(&username)
+
+	if err != nil {
+		return err
+	}
+
+	if err = (*ws.DatabaseManager).UpdateProfile(&username, &db.ProfileUpdate{AvatarURL: &key}); err != nil {
+		return err
+	}
+
+	if storage.ValidKey(previous.AvatarURL) {
+		if err = ws.Media.Storage.Delete(context.Background(), previous.AvatarURL); err != nil {
+			log.Printf("error: could not delete old avatar: %v", err)
+		} else if err = (*ws.DatabaseManager).RemoveMedia(&previous.AvatarURL); err != nil {
+			log.Printf("error: could not remove old avatar: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// checkQuota refuses media that would take the user over MediaQuota
+func (ws WSDBProxy) checkQuota(username string, size int64) error {
+
+	if ws.MediaQuota <= 0 {
+		return nil
+	}
+
+	usage, err := (*ws.DatabaseManager).MediaUsage(&username)
+
+	if err != nil {
+		return err
+	}
+
+	if usage+size > ws.MediaQuota {
+		return fmt.Errorf("quota: uploads are limited to %d bytes per user", ws.MediaQuota)
+	}
+
+	return nil
+}
+
+// checkListingImages makes sure the images of a listing are uploads of the
+// seller. Without storage any image URL is accepted.
+func (ws WSDBProxy) checkListingImages(username string, images []string) error {
+
+	if ws.Media == nil {
+		return nil
+	}
+
+	if len(images) > maxListingImages {
+		return fmt.Errorf("media: a listing can have at most %d images", maxListingImages)
+	}
+
+	for _, key := range images {
+		if !storage.ValidKey(key) || !strings.HasPrefix(key, MediaListing+"/") {
+			return fmt.Errorf("media: %q is not an uploaded listing image", key)
+		}
+	}
+
+	owns, err := (*ws.DatabaseManager).OwnsMedia(&username, images)
+
+	if err != nil {
+		return err
+	}
+
+	if !owns {
+		return fmt.Errorf("media: images must be uploaded by the seller")
+	}
+
+	return nil
+}
+
+// mediaURL turns a stored key into the URL clients load it from, links that
+// were stored before storage existed are left as they are
+func (ws WSDBProxy) mediaURL(value string) string {
+	if ws.Media == nil || !storage.ValidKey(value) {
+		return value
+	}
+
+	return ws.Media.Storage.URL(value)
+}
+
+func validPurpose(purpose string) error {
+	if purpose != MediaAvatar && purpose != MediaListing {
+		return fmt.Errorf("media: %q is not avatar or listing", purpose)
+	}
+
+	return nil
+}
+
+// UploadHandler receives uploads sent to signed upload URLs, answering with
+// the key and URL of the stored media as JSON
+func UploadHandler(proxy *WebDataProxy) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+
+		// The signed URL is the credential, so any page may use it
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+
+		if r.Method == http.MethodOptions {
+			w.Header().Set("Access-Control-Allow-Methods", "PUT, POST")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		if r.Method != http.MethodPut && r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// one byte over the limit is enough to refuse it
+		data, err := io.ReadAll(io.LimitReader(r.Body, (*proxy).MaxUploadSize()+1))
+
+		if err != nil {
+			http.Error(w, "could not read upload", http.StatusBadRequest)
+			return
+		}
+
+		key, mediaURL, err := (*proxy).UploadSigned(r.URL.Query(), data)
+
+		result := struct {
+			ResponseCode byte
+			Key          string `json:",omitempty"`
+			URL          string `json:",omitempty"`
+		}{SUCCESS, key, mediaURL}
+
+		status := http.StatusOK
+
+		if err != nil {
+			result.ResponseCode = errorCode(err)
+			status = http.StatusBadRequest
+
+			switch result.ResponseCode {
+			case INVALID_TOKEN:
+				status = http.StatusForbidden
+			case MEDIA_TOO_LARGE:
+				status = http.StatusRequestEntityTooLarge
+			case UNKNOWN:
+				log.Printf("error: upload failed: %v", err)
+				status = http.StatusInternalServerError
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,100 @@
+package ws
+
+import (
+	"bytes"
+	"context"
+	"go-websocket/pkg/imaging"
+	"go-websocket/pkg/storage"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Media", func() {
+
+	proxy := WSDBProxy{
+		Media: storage.NewMedia(storage.LocalStorage{BaseURL: "https://example.com/media"}, storage.DefaultMaxSize),
+	}
+
+	It("URL: stored keys become URLs", func() {
+		Expect(proxy.mediaURL("avatar/abc.png")).To(Equal("https://example.com/media/avatar/abc.png"))
+	})
+
+	It("URL: links and empty values are left as they are", func() {
+		Expect(proxy.mediaURL("https://img.example.com/a.png")).To(Equal("https://img.example.com/a.png"))
+		Expect(proxy.mediaURL("")).To(Equal(""))
+	})
+
+	It("URL: keys are left as they are without storage", func() {
+		Expect(WSDBProxy{}.mediaURL("avatar/abc.png")).To(Equal("avatar/abc.png"))
+	})
+
+	It("Purpose: only avatar and listing", func() {
+		Expect(validPurpose(MediaAvatar)).To(BeNil())
+		Expect(validPurpose(MediaListing)).To(BeNil())
+		Expect(validPurpose("document")).NotTo(BeNil())
+	})
+
+	It("Listing: images have to be listing uploads", func() {
+		err := proxy.checkListingImages("some-user", []string{"https://img.example.com/a.png"})
+		Expect(err).NotTo(BeNil())
+		Expect(errorCode(err)).To(Equal(MEDIA_INVALID))
+
+		err = proxy.checkListingImages("some-user", []string{"avatar/abc.png"})
+		Expect(err).NotTo(BeNil(), "Avatars are not listing images")
+	})
+
+	It("Listing: number of images is limited", func() {
+		images := make([]string, maxListingImages+1)
+
+		for i := range images {
+			images[i] = "listing/abc.png"
+		}
+
+		Expect(proxy.checkListingImages("some-user", images)).NotTo(BeNil())
+	})
+
+	It("Variants: keys are next to the image", func() {
+		Expect(variantKey("listing/abc.jpg", "thumb", ".jpg")).To(Equal("listing/abc-thumb.jpg"))
+		Expect(variantKey("listing/abc.gif", "thumb", ".png")).To(Equal("listing/abc-thumb.png"))
+	})
+
+	It("Variants: listing images are processed and get variants", func() {
+		dir, _ := ioutil.TempDir("", "media")
+		defer os.RemoveAll(dir)
+
+		processed := WSDBProxy{
+			Media:   storage.NewMedia(storage.LocalStorage{Dir: dir, BaseURL: "https://example.com/media"}, storage.DefaultMaxSize),
+			Imaging: imaging.NewProcessor(),
+		}
+
+		var buffer bytes.Buffer
+		png.Encode(&buffer, image.NewRGBA(image.Rect(0, 0, 400, 200)))
+
+		media, err := processed.putMedia(context.Background(), MediaListing, buffer.Bytes())
+		Expect(err).To(BeNil())
+		Expect(media.ContentType).To(Equal("image/png"))
+		Expect(media.Variants).To(HaveLen(3))
+		Expect(media.Variants[0].Name).To(Equal("thumb"))
+		Expect(media.Variants[0].Key).To(Equal(variantKey(media.Key, "thumb", ".png")))
+
+		thumb, err := processed.Media.Storage.Get(context.Background(), media.Variants[0].Key)
+		Expect(err).To(BeNil())
+
+		config, _ := png.DecodeConfig(bytes.NewReader(thumb))
+		Expect(config.Width).To(Equal(160))
+
+		avatar, err := processed.putMedia(context.Background(), MediaAvatar, buffer.Bytes())
+		Expect(err).To(BeNil())
+		Expect(avatar.Variants).To(BeEmpty(), "Only listing images get variants")
+	})
+
+	It("Listing: any image is accepted without storage", func() {
+		Expect(WSDBProxy{}.checkListingImages("some-user", []string{"https://img.example.com/a.png"})).To(BeNil())
+	})
+
+})
@@ -0,0 +1,34 @@
+package ws
+
+type ChangePassword struct {
+	CurrentPassword string
+	NewPassword     string
+}
+
+type ChangeEmail struct {
+	// Current password of the account
+	Password string
+	Email    string
+}
+
+type ChangeUsername struct {
+	Username string
+}
+
+type AccountResult struct {
+	BaseMessage
+	ResponseCode byte
+
+	// Why the password was refused when ResponseCode is PASSWORD_INVALID
+	Reasons []string `json:",omitempty"`
+}
+
+type UsernameResult struct {
+	BaseMessage
+	ResponseCode byte
+	Username     string
+
+	// Access token for the new username, the refresh token is unchanged
+	Token     string `json:",omitempty"`
+	ExpiresAt int64  `json:",omitempty"`
+}
@@ -0,0 +1,22 @@
+package ws
+
+// BlockUser is sent with both blockUser and unblockUser
+type BlockUser struct {
+	Username string
+}
+
+type BlockUserResult struct {
+	BaseMessage
+	ResponseCode byte
+}
+
+type BlockedUser struct {
+	Username  string
+	AvatarURL string
+}
+
+type BlockedResult struct {
+	BaseMessage
+	ResponseCode byte
+	Users        []BlockedUser
+}
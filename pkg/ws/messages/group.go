@@ -0,0 +1,124 @@
+package ws
+
+type CreateGroup struct {
+	Name string
+
+	// Members besides the user creating the group
+	Usernames []string
+}
+
+type CreateGroupResult struct {
+	BaseMessage
+	ResponseCode byte
+	GroupID      string `json:",omitempty"`
+}
+
+type AddMember struct {
+	GroupID  string
+	Username string
+
+	// "member" when empty, or "admin"
+	Role string
+}
+
+type AddMemberResult struct {
+	BaseMessage
+	ResponseCode byte
+}
+
+type RemoveMember struct {
+	GroupID  string
+	Username string
+}
+
+type RemoveMemberResult struct {
+	BaseMessage
+	ResponseCode byte
+}
+
+type LeaveGroup struct {
+	GroupID string
+}
+
+type LeaveGroupResult struct {
+	BaseMessage
+	ResponseCode byte
+}
+
+type GetGroup struct {
+	GroupID string
+}
+
+type GroupMember struct {
+	Username  string
+	AvatarURL string
+	Role      string
+}
+
+type Group struct {
+	ID        string
+	Name      string
+	CreatedAt int64
+	Members   []GroupMember `json:",omitempty"`
+}
+
+type GroupResult struct {
+	BaseMessage
+	ResponseCode byte
+	Group        Group
+}
+
+type GroupsResult struct {
+	BaseMessage
+	ResponseCode byte
+	Groups       []Group
+}
+
+type SendGroupMessage struct {
+	GroupID string
+	Message string
+}
+
+type SendGroupMessageResult struct {
+	BaseMessage
+	ResponseCode byte
+	ID           string `json:",omitempty"`
+}
+
+type GetGroupMessages struct {
+	GroupID string
+
+	// Only messages after this unix time, every message when 0
+	After int64
+}
+
+type GroupMessageSummary struct {
+	ID       string
+	Username string
+	Contents string
+	Time     int64
+}
+
+type GroupMessagesResult struct {
+	BaseMessage
+	ResponseCode byte
+	GroupID      string
+	Messages     []GroupMessageSummary
+}
+
+// GroupMessage is sent to the other members when a member sends a message
+type GroupMessage struct {
+	BaseMessage
+	GroupID  string
+	ID       string
+	Username string
+	Contents string
+	Time     int64
+}
+
+// GroupChanged is sent to the members when members are added, removed or
+// leave, or their roles change
+type GroupChanged struct {
+	BaseMessage
+	GroupID string
+}
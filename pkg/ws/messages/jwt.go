@@ -4,5 +4,19 @@ import "github.com/dgrijalva/jwt-go"
 
 type Claims struct {
 	Username string `json:"username"`
+
+	// Session the token belongs to, used to revoke it
+	SessionID string `json:"sid,omitempty"`
 	jwt.StandardClaims
 }
+
+// TokenPair is sent to the client whenever it is logged in. The short lived
+// access token authenticates sockets, the refresh token is exchanged for a
+// new pair with the "refreshToken" command.
+type TokenPair struct {
+	Token            string
+	ExpiresAt        int64
+	RefreshToken     string
+	RefreshExpiresAt int64
+	SessionID        string
+}
@@ -0,0 +1,43 @@
+package ws
+
+type UploadListing struct {
+	Title       string
+	Description string
+
+	// Keys of uploaded images
+	Images []string
+	Price  int64
+	Sym    string
+}
+
+type UploadListingResult struct {
+	BaseMessage
+	ResponseCode byte
+	Id           int64 `json:",omitempty"`
+}
+
+type GetListing struct {
+	Id int64
+}
+
+type Listing struct {
+	Id          int64
+	Title       string
+	Description string
+
+	// URLs of the images
+	Images []string
+
+	// Variant name to URL for each of the images, such as "thumb"
+	ImageVariants []map[string]string `json:",omitempty"`
+	Price         int64
+	Sym           string
+	Active        bool
+	Owner         string
+}
+
+type ListingResult struct {
+	BaseMessage
+	ResponseCode byte
+	Listing      *Listing `json:",omitempty"`
+}
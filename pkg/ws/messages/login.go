@@ -7,6 +7,24 @@ type Login struct {
 
 type LoginResult struct {
 	BaseMessage
-	Result   bool
-	Username string
+	Result       bool
+	ResponseCode byte
+	Username     string
+
+	// Sent in-band as cookies cannot be set after the upgrade
+	TokenPair
+
+	// Seconds until another login attempt is allowed
+	RetryAfter int64
+}
+
+// UnlockAccount removes a login lockout, either can be empty
+type UnlockAccount struct {
+	Email string
+	IP    string
+}
+
+type UnlockAccountResult struct {
+	BaseMessage
+	ResponseCode byte
 }
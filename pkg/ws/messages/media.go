@@ -0,0 +1,26 @@
+package ws
+
+// UploadMedia is followed by a binary message with the file
+type UploadMedia struct {
+	// "avatar" or "listing"
+	Purpose string
+}
+
+type MediaResult struct {
+	BaseMessage
+	ResponseCode byte
+
+	// Key to put in a listing, and the URL to show the media from
+	Key string `json:",omitempty"`
+	URL string `json:",omitempty"`
+}
+
+type UploadURL struct {
+	Purpose string
+}
+
+type UploadURLResult struct {
+	BaseMessage
+	ResponseCode byte
+	URL          string `json:",omitempty"`
+}
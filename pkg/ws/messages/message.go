@@ -0,0 +1,118 @@
+package ws
+
+type SendMessage struct {
+	Username string
+	Message  string
+
+	// Listing the message is about, optional
+	Listing *int64
+}
+
+type SendMessageResult struct {
+	BaseMessage
+	ResponseCode byte
+	ID           string `json:",omitempty"`
+}
+
+type GetMessages struct {
+	Username string
+
+	// Only messages after this unix time, every message when 0
+	After int64
+
+	// Only messages about this listing, or messages not about any listing
+	// when left out
+	Listing *int64
+}
+
+type Message struct {
+	ID       string
+	Contents string
+	Time     int64
+	Read     int64
+
+	// true when the user asking sent it
+	Sender bool
+
+	// Unix time of the last edit, 0 if never edited
+	Edited int64
+
+	// Deleted messages are sent without their contents
+	Deleted bool
+}
+
+// ListingSummary is the listing a conversation is about
+type ListingSummary struct {
+	Id     int64
+	Title  string
+	Price  int64
+	Sym    string
+	Active bool
+	Owner  string
+
+	// URL of the thumbnail of the first image, or of the image itself when
+	// there is none
+	Image string `json:",omitempty"`
+}
+
+type MessagesResult struct {
+	BaseMessage
+	ResponseCode byte
+	Username     string
+	Listing      *ListingSummary `json:",omitempty"`
+	Messages     []Message
+}
+
+type Contact struct {
+	Username  string
+	AvatarURL string
+
+	// Listing the conversation is about, left out when it is not about one
+	Listing      *int64 `json:",omitempty"`
+	ListingTitle string `json:",omitempty"`
+}
+
+type ContactsResult struct {
+	BaseMessage
+	ResponseCode byte
+	Contacts     []Contact
+}
+
+type EditMessage struct {
+	ID      string
+	Message string
+}
+
+type EditMessageResult struct {
+	BaseMessage
+	ResponseCode byte
+}
+
+type DeleteMessage struct {
+	ID string
+}
+
+type DeleteMessageResult struct {
+	BaseMessage
+	ResponseCode byte
+}
+
+// MessageEdited is sent to the receiver when the sender edits a message
+type MessageEdited struct {
+	BaseMessage
+	ID       string
+	Username string
+	Time     int64
+	Listing  *int64 `json:",omitempty"`
+	Contents string
+	Edited   int64
+}
+
+// MessageDeleted is sent to the receiver when the sender deletes a message
+type MessageDeleted struct {
+	BaseMessage
+	ID       string
+	Username string
+	Time     int64
+	Listing  *int64 `json:",omitempty"`
+}
@@ -0,0 +1,55 @@
+package ws
+
+type GetProfile struct {
+	Username string
+}
+
+type Profile struct {
+	Username     string
+	DisplayName  string
+	Bio          string
+	Location     string
+	AvatarURL    string
+	ListingCount int64
+	JoinedAt     int64
+	Rating       float64
+	RatingCount  int64
+
+	// Fields hidden from everyone but the owner, they are left empty for
+	// anyone else
+	Private []string
+}
+
+type ProfileResult struct {
+	BaseMessage
+	ResponseCode byte
+	Profile      *Profile `json:",omitempty"`
+}
+
+// UpdateProfile changes the fields that are sent, "" clears a field
+type UpdateProfile struct {
+	DisplayName *string
+	Bio         *string
+	Location    *string
+	AvatarURL   *string
+	Private     *[]string
+}
+
+// RateSeller scores the seller of a listing the user bought
+type RateSeller struct {
+	Listing int64
+	Score   int64
+}
+
+type RateSellerResult struct {
+	BaseMessage
+	ResponseCode byte
+}
+
+type UpdateProfileResult struct {
+	BaseMessage
+	ResponseCode byte
+
+	// Fields that were refused when ResponseCode is PROFILE_INVALID
+	Invalid []string `json:",omitempty"`
+}
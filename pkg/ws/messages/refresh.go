@@ -0,0 +1,18 @@
+package ws
+
+type Refresh struct {
+	RefreshToken string
+}
+
+type RefreshResult struct {
+	BaseMessage
+	ResponseCode byte
+	Username     string
+	TokenPair
+}
+
+// TokenExpiring is sent by the server shortly before the access token expires
+type TokenExpiring struct {
+	BaseMessage
+	ExpiresAt int64
+}
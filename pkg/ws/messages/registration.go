@@ -9,4 +9,10 @@ type Registration struct {
 type RegistrationResult struct {
 	BaseMessage
 	ResponseCode byte
+
+	// Why the password was refused when ResponseCode is PASSWORD_INVALID
+	Reasons []string `json:",omitempty"`
+
+	// Tokens for the new account on success
+	TokenPair
 }
@@ -0,0 +1,76 @@
+package ws
+
+// Report is about a listing by Listing, a user by Username, or a message
+// sent to the user by MessageID
+type Report struct {
+	Type      string
+	Listing   int64
+	Username  string
+	MessageID string
+	Reason    string
+	Details   string
+}
+
+type ReportResult struct {
+	BaseMessage
+	ResponseCode byte
+	ReportID     string `json:",omitempty"`
+}
+
+type ListReports struct {
+	// Reports with this status, every report when empty
+	Status string
+}
+
+type ReportSummary struct {
+	ID        string
+	Reporter  string
+	Type      string
+	Listing   int64
+	Username  string
+	MessageID string
+	Content   string
+	Reason    string
+	Details   string
+	Status    string
+	CreatedAt int64
+}
+
+type ReportsResult struct {
+	BaseMessage
+	ResponseCode byte
+	Reports      []ReportSummary
+}
+
+type GetReport struct {
+	ReportID string
+}
+
+type ModerationAction struct {
+	Moderator string
+	Action    string
+	Note      string
+	CreatedAt int64
+}
+
+type ReportDetails struct {
+	ReportSummary
+	Actions []ModerationAction
+}
+
+type ReportDetailsResult struct {
+	BaseMessage
+	ResponseCode byte
+	Report       *ReportDetails `json:",omitempty"`
+}
+
+type Moderate struct {
+	ReportID string
+	Action   string
+	Note     string
+}
+
+type ModerateResult struct {
+	BaseMessage
+	ResponseCode byte
+}
@@ -0,0 +1,19 @@
+package ws
+
+type RequestPasswordReset struct {
+	Email string
+}
+
+type ResetPassword struct {
+	// Token from the reset email
+	Token    string
+	Password string
+}
+
+type PasswordResetResult struct {
+	BaseMessage
+	ResponseCode byte
+
+	// Why the password was refused when ResponseCode is PASSWORD_INVALID
+	Reasons []string `json:",omitempty"`
+}
@@ -0,0 +1,27 @@
+package ws
+
+type Session struct {
+	SessionID string
+	UserAgent string
+	IP        string
+	CreatedAt int64
+	LastUsed  int64
+
+	// true for the session of the socket asking
+	Current bool
+}
+
+type SessionsResult struct {
+	BaseMessage
+	ResponseCode byte
+	Sessions     []Session
+}
+
+type RevokeSession struct {
+	SessionID string
+}
+
+type SessionResult struct {
+	BaseMessage
+	ResponseCode byte
+}
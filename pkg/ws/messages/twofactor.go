@@ -0,0 +1,31 @@
+package ws
+
+type TwoFactorCode struct {
+	// Code from the authenticator app, or a recovery code when logging in
+	Code string
+
+	// From the fragment of a provider login that answered TWO_FACTOR_REQUIRED,
+	// only sent when the socket did not log in with a password
+	LoginToken string `json:",omitempty"`
+}
+
+type DisableTwoFactor struct {
+	Password string
+	Code     string
+}
+
+type EnableTwoFactorResult struct {
+	BaseMessage
+	ResponseCode byte
+
+	// otpauth URI to show as a QR code
+	URI string `json:",omitempty"`
+}
+
+type TwoFactorResult struct {
+	BaseMessage
+	ResponseCode byte
+
+	// Only sent once, when 2FA is confirmed
+	RecoveryCodes []string `json:",omitempty"`
+}
@@ -0,0 +1,48 @@
+package ws
+
+type UploadBegin struct {
+	// "avatar" or "listing"
+	Purpose string
+	Size    int64
+
+	// SHA-256 of the whole file in hex
+	Checksum string
+}
+
+// UploadChunk is followed by a binary message with the chunk
+type UploadChunk struct {
+	UploadID string
+	Index    int
+
+	// SHA-256 of the chunk in hex
+	Checksum string
+}
+
+// Upload names the upload for uploadStatus, uploadCommit and uploadAbort
+type Upload struct {
+	UploadID string
+}
+
+type UploadStatusResult struct {
+	BaseMessage
+	ResponseCode byte
+	UploadID     string `json:",omitempty"`
+	ChunkSize    int64  `json:",omitempty"`
+	Chunks       int    `json:",omitempty"`
+
+	// Chunks already received
+	Received []int `json:",omitempty"`
+}
+
+type UploadChunkResult struct {
+	BaseMessage
+	ResponseCode byte
+	UploadID     string
+	Index        int
+}
+
+type UploadAbortResult struct {
+	BaseMessage
+	ResponseCode byte
+	UploadID     string
+}
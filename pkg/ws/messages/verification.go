@@ -0,0 +1,15 @@
+package ws
+
+type VerifyEmail struct {
+	// Token from the verification email
+	Token string
+}
+
+type ResendVerification struct {
+	Email string
+}
+
+type VerificationResult struct {
+	BaseMessage
+	ResponseCode byte
+}
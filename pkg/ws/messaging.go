@@ -0,0 +1,145 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/db"
+	dt "go-websocket/pkg/ws/messages"
+	"time"
+)
+
+// EditMessage replaces the text of a message the socket sent and tells the
+// receiver
+func (ws WSDBProxy) EditMessage(socketID string, id, message *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		sent, err := ws.sentMessage(username, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := ws.checkBlocked(username, sent.Receiver); err != nil {
+			return err
+		}
+
+		if ws.Content != nil {
+			cleaned, err := ws.Content.Message.Clean(*message)
+
+			if err != nil {
+				return err
+			}
+
+			message = &cleaned.Text
+		}
+
+		if err := (*ws.DatabaseManager).EditMessage(&username, id, message); err != nil {
+			return err
+		}
+
+		ws.notify(sent.Receiver, dt.MessageEdited{
+			BaseMessage: dt.BaseMessage{
+				Command: "messageEdited",
+			},
+			ID:       *id,
+			Username: username,
+			Time:     sent.Time,
+			Listing:  sent.Listing,
+			Contents: *message,
+			Edited:   time.Now().Unix(),
+		})
+
+		return nil
+
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// DeleteMessage removes the text of a message the socket sent, leaving a
+// tombstone, and tells the receiver
+func (ws WSDBProxy) DeleteMessage(socketID string, id *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		sent, err := ws.sentMessage(username, id)
+
+		if err != nil {
+			return err
+		}
+
+		if err := (*ws.DatabaseManager).DeleteMessage(&username, id); err != nil {
+			return err
+		}
+
+		ws.notify(sent.Receiver, dt.MessageDeleted{
+			BaseMessage: dt.BaseMessage{
+				Command: "messageDeleted",
+			},
+			ID:       *id,
+			Username: username,
+			Time:     sent.Time,
+			Listing:  sent.Listing,
+		})
+
+		return nil
+
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// sentMessage returns the message if the user sent it and it can still be
+// changed, other users' messages are not found
+func (ws WSDBProxy) sentMessage(username string, id *string) (db.Message, error) {
+	message, err := (*ws.DatabaseManager).GetMessage(id)
+
+	if err != nil {
+		return db.Message{}, err
+	}
+
+	if message.Sender != username || message.Deleted {
+		return db.Message{}, fmt.Errorf("message not found: %s", *id)
+	}
+
+	if err = ws.checkEditWindow(message.Time); err != nil {
+		return db.Message{}, err
+	}
+
+	return message, nil
+}
+
+// checkEditWindow refuses changes to messages sent longer ago than the
+// window
+func (ws WSDBProxy) checkEditWindow(sentAt int64) error {
+	if ws.EditWindow == 0 {
+		return nil
+	}
+
+	if time.Since(time.Unix(sentAt, 0)) > ws.EditWindow {
+		return fmt.Errorf("message edit window: messages can only be changed for %v after they are sent", ws.EditWindow)
+	}
+
+	return nil
+}
+
+// notify sends the event to the sockets of the user, if there is a hub
+func (ws WSDBProxy) notify(username string, event interface{}) {
+	if ws.Hub == nil {
+		return
+	}
+
+	ws.Hub.Notify(username, event)
+}
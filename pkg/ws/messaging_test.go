@@ -0,0 +1,43 @@
+package ws
+
+import (
+	"go-websocket/pkg/db"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Messaging", func() {
+
+	It("Edit window: refuses changes to old messages", func() {
+		bridge := WSDBProxy{EditWindow: 15 * time.Minute}
+
+		Expect(bridge.checkEditWindow(time.Now().Add(-time.Minute).Unix())).To(BeNil())
+
+		err := bridge.checkEditWindow(time.Now().Add(-time.Hour).Unix())
+		Expect(err).NotTo(BeNil())
+		Expect(errorCode(err)).To(Equal(EDIT_WINDOW_CLOSED))
+	})
+
+	It("Edit window: allows changes for ever when not set", func() {
+		bridge := WSDBProxy{}
+
+		Expect(bridge.checkEditWindow(0)).To(BeNil())
+	})
+
+	It("Listing summary: shows the thumbnail of the first image", func() {
+		listing := db.Listing{
+			Id:            7,
+			Title:         "Bike",
+			Images:        []string{"https://example.com/bike.jpg"},
+			ImageVariants: []map[string]string{{"thumb": "https://example.com/bike-thumb.jpg"}},
+		}
+
+		Expect(listingSummary(listing).Image).To(Equal("https://example.com/bike-thumb.jpg"))
+
+		listing.ImageVariants = nil
+		Expect(listingSummary(listing).Image).To(Equal("https://example.com/bike.jpg"), "Should fall back to the image")
+	})
+
+})
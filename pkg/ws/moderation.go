@@ -0,0 +1,202 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/db"
+	"log"
+	"unicode/utf8"
+)
+
+// Reasons a report can be made for
+var reportReasons = map[string]bool{
+	"scam":          true,
+	"spam":          true,
+	"harassment":    true,
+	"inappropriate": true,
+	"other":         true,
+}
+
+const (
+	// Longest details of a report and note of a moderator in characters
+	maxReportDetailsLength  = 500
+	maxModerationNoteLength = 500
+
+	// Most reports listed at once
+	reportPageSize = 50
+)
+
+// Report files a report about a listing, a message sent to the user or their
+// group, or another user for the moderators
+func (ws WSDBProxy) Report(socketID string, report *db.Report) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		if err := ValidateReport(report); err != nil {
+			return err
+		}
+
+		report.Reporter = ws.usernameOf(socketID)
+
+		if report.Type == db.ReportUser {
+			report.Username = *ws.resolveUsername(&report.Username)
+		}
+
+		return (*ws.DatabaseManager).CreateReport(report)
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// ListReports returns the oldest reports with the status, every status when
+// it is ""
+func (ws WSDBProxy) ListReports(socketID string, status string) ([]db.Report, error) {
+
+	if ws.DatabaseManager == nil {
+		return nil, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if _, err := ws.requireModerator(socketID); err != nil {
+		return nil, err
+	}
+
+	if status != "" && status != db.ReportOpen && status != db.ReportActioned && status != db.ReportDismissed {
+		return nil, fmt.Errorf("report: %q is not a status", status)
+	}
+
+	return (*ws.DatabaseManager).GetReports(status, reportPageSize)
+}
+
+// GetReport returns a report with its audit trail
+func (ws WSDBProxy) GetReport(socketID string, reportID string) (db.Report, error) {
+
+	if ws.DatabaseManager == nil {
+		return db.Report{}, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if _, err := ws.requireModerator(socketID); err != nil {
+		return db.Report{}, err
+	}
+
+	return (*ws.DatabaseManager).GetReport(&reportID)
+}
+
+// Moderate acts on a report, every action is recorded against it with the
+// moderator who took it. A suspended user is signed out everywhere.
+func (ws WSDBProxy) Moderate(socketID string, reportID string, action *db.ModerationAction) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	moderator, err := ws.requireModerator(socketID)
+
+	if err != nil {
+		return err
+	}
+
+	if utf8.RuneCountInString(action.Note) > maxModerationNoteLength {
+		return fmt.Errorf("report: notes are limited to %d characters", maxModerationNoteLength)
+	}
+
+	report, err := (*ws.DatabaseManager).GetReport(&reportID)
+
+	if err != nil {
+		return err
+	}
+
+	if (action.Action == db.ActionHideListing && report.Type != db.ReportListing) ||
+		(action.Action == db.ActionDeleteMessage && report.Type != db.ReportMessage) {
+		return fmt.Errorf("report: %s does not apply to a %s report", action.Action, report.Type)
+	}
+
+	if err = (*ws.DatabaseManager).ModerateReport(&moderator, &reportID, action); err != nil {
+		return err
+	}
+
+	if action.Action == db.ActionSuspendUser {
+		if err = ws.revokeAllSessions(report.Username, ""); err != nil {
+			log.Printf("error: could not sign out suspended user: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// ValidateReport checks what is reported and why before it reaches the
+// database
+func ValidateReport(report *db.Report) error {
+
+	switch report.Type {
+
+	case db.ReportListing:
+		if report.Listing < 0 {
+			return fmt.Errorf("report: listing is missing")
+		}
+
+	case db.ReportUser:
+		if report.Username == "" {
+			return fmt.Errorf("report: username is missing")
+		}
+
+	case db.ReportMessage:
+		if report.MessageID == "" {
+			return fmt.Errorf("report: message is missing")
+		}
+
+	default:
+		return fmt.Errorf("report: cannot report a %q", report.Type)
+
+	}
+
+	if !reportReasons[report.Reason] {
+		return fmt.Errorf("report: %q is not a reason", report.Reason)
+	}
+
+	if utf8.RuneCountInString(report.Details) > maxReportDetailsLength {
+		return fmt.Errorf("report: details are limited to %d characters", maxReportDetailsLength)
+	}
+
+	return nil
+}
+
+// requireModerator returns the username of the socket if it is a moderator
+func (ws WSDBProxy) requireModerator(socketID string) (string, error) {
+
+	if !ws.IsLoggedIn(socketID) {
+		return "", fmt.Errorf("user is not logged in")
+	}
+
+	username := ws.usernameOf(socketID)
+
+	moderator, err := (*ws.DatabaseManager).IsModerator(&username)
+
+	if err != nil {
+		return "", err
+	}
+
+	if !moderator {
+		return "", fmt.Errorf("moderator: only moderators can do that")
+	}
+
+	return username, nil
+}
+
+// checkSuspended refuses users a moderator has suspended
+func (ws WSDBProxy) checkSuspended(username string) error {
+
+	suspended, err := (*ws.DatabaseManager).IsSuspended(&username)
+
+	if err != nil {
+		return err
+	}
+
+	if suspended {
+		return fmt.Errorf("suspended: the account has been suspended")
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+package ws
+
+import (
+	"go-websocket/pkg/db"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Moderation", func() {
+
+	It("Report: accepts each kind of report", func() {
+		Expect(ValidateReport(&db.Report{Type: db.ReportListing, Listing: 0, Reason: "scam"})).To(BeNil())
+		Expect(ValidateReport(&db.Report{Type: db.ReportUser, Username: "some-user", Reason: "harassment"})).To(BeNil())
+		Expect(ValidateReport(&db.Report{Type: db.ReportMessage, MessageID: "01ARYZ6S410000000000000000", Reason: "spam", Details: "Keeps sending links"})).To(BeNil())
+	})
+
+	It("Report: refuses reports missing what they are about", func() {
+		Expect(ValidateReport(&db.Report{Type: db.ReportUser, Reason: "spam"})).NotTo(BeNil())
+		Expect(ValidateReport(&db.Report{Type: db.ReportMessage, Username: "some-user", Reason: "spam"})).NotTo(BeNil())
+		Expect(ValidateReport(&db.Report{Type: db.ReportListing, Listing: -1, Reason: "spam"})).NotTo(BeNil())
+		Expect(ValidateReport(&db.Report{Type: "profile", Username: "some-user", Reason: "spam"})).NotTo(BeNil())
+	})
+
+	It("Report: refuses unknown reasons and long details", func() {
+		err := ValidateReport(&db.Report{Type: db.ReportUser, Username: "some-user", Reason: "boring"})
+		Expect(err).NotTo(BeNil())
+		Expect(errorCode(err)).To(Equal(REPORT_INVALID))
+
+		err = ValidateReport(&db.Report{Type: db.ReportUser, Username: "some-user", Reason: "other", Details: strings.Repeat("a", maxReportDetailsLength+1)})
+		Expect(err).NotTo(BeNil())
+	})
+
+})
@@ -0,0 +1,113 @@
+package ws
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+// OriginChecker decides which origins may open a websocket. Patterns are
+// either an exact origin such as "https://example.com" or a wildcard
+// subdomain such as "https://*.example.com".
+type OriginChecker struct {
+	Allowed []string
+
+	// Accepts every origin, only for local development
+	DevMode bool
+
+	rejected uint64
+}
+
+func NewOriginChecker(allowed []string, devMode bool) *OriginChecker {
+	origins := []string{}
+
+	for _, origin := range allowed {
+		origin = strings.ToLower(strings.TrimRight(strings.TrimSpace(origin), "/"))
+
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+
+	return &OriginChecker{Allowed: origins, DevMode: devMode}
+}
+
+// Check is used as the CheckOrigin of the upgrader
+func (o *OriginChecker) Check(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	// Non-browser clients do not send an origin
+	if origin == "" {
+		return true
+	}
+
+	if o.DevMode || o.IsAllowed(origin) {
+		return true
+	}
+
+	// Without a configured list only the same host is trusted, as gorilla
+	// does by default
+	if len(o.Allowed) == 0 && sameHost(origin, r.Host) {
+		return true
+	}
+
+	atomic.AddUint64(&o.rejected, 1)
+	log.Printf("rejected websocket upgrade from origin %q (%s)", origin, r.RemoteAddr)
+
+	return false
+}
+
+func (o *OriginChecker) IsAllowed(origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return false
+	}
+
+	for _, pattern := range o.Allowed {
+		if matchOrigin(pattern, u) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Rejected returns the number of upgrades refused so far
+func (o *OriginChecker) Rejected() uint64 {
+	return atomic.LoadUint64(&o.rejected)
+}
+
+func sameHost(origin, host string) bool {
+	u, err := url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, host)
+}
+
+func matchOrigin(pattern string, origin *url.URL) bool {
+	p, err := url.Parse(pattern)
+
+	if err != nil || p.Scheme != origin.Scheme {
+		return false
+	}
+
+	if !strings.HasPrefix(p.Host, "*.") {
+		return p.Host == origin.Host
+	}
+
+	// "*.example.com" matches "a.example.com" and "a.b.example.com" but not
+	// "example.com" itself
+	return strings.HasSuffix(origin.Host, p.Host[1:])
+}
+
+// SetOriginChecker replaces the origin policy used for every upgrade. Without
+// one the upgrader only accepts requests from the same host.
+func SetOriginChecker(checker *OriginChecker) {
+	upgrader.CheckOrigin = checker.Check
+}
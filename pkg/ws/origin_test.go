@@ -0,0 +1,67 @@
+package ws
+
+import (
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("OriginChecker", func() {
+
+	checker := NewOriginChecker([]string{"https://example.com", " https://*.example.org/ "}, false)
+
+	It("Origin: exact match is allowed", func() {
+		Expect(checker.IsAllowed("https://example.com")).To(BeTrue())
+		Expect(checker.IsAllowed("https://EXAMPLE.com")).To(BeTrue())
+	})
+
+	It("Origin: scheme and host must both match", func() {
+		Expect(checker.IsAllowed("http://example.com")).To(BeFalse())
+		Expect(checker.IsAllowed("https://example.com.evil.com")).To(BeFalse())
+		Expect(checker.IsAllowed("https://evilexample.com")).To(BeFalse())
+	})
+
+	It("Origin: wildcard matches subdomains only", func() {
+		Expect(checker.IsAllowed("https://shop.example.org")).To(BeTrue())
+		Expect(checker.IsAllowed("https://a.b.example.org")).To(BeTrue())
+		Expect(checker.IsAllowed("https://example.org")).To(BeFalse())
+		Expect(checker.IsAllowed("https://evilexample.org")).To(BeFalse())
+	})
+
+	It("Origin: rejected upgrades are counted", func() {
+		counting := NewOriginChecker([]string{"https://example.com"}, false)
+
+		request := httptest.NewRequest("GET", "/ws", nil)
+		request.Header.Set("Origin", "https://evil.com")
+
+		Expect(counting.Check(request)).To(BeFalse())
+		Expect(counting.Rejected()).To(Equal(uint64(1)))
+	})
+
+	It("Origin: without allowed origins only the same host is accepted", func() {
+		empty := NewOriginChecker([]string{""}, false)
+
+		request := httptest.NewRequest("GET", "/ws", nil)
+		request.Host = "example.com"
+		request.Header.Set("Origin", "https://example.com")
+
+		Expect(empty.Check(request)).To(BeTrue())
+
+		request.Header.Set("Origin", "https://evil.com")
+
+		Expect(empty.Check(request)).To(BeFalse())
+		Expect(empty.Rejected()).To(Equal(uint64(1)))
+	})
+
+	It("Origin: dev mode allows anything", func() {
+		dev := NewOriginChecker(nil, true)
+
+		request := httptest.NewRequest("GET", "/ws", nil)
+		request.Header.Set("Origin", "http://localhost:3000")
+
+		Expect(dev.Check(request)).To(BeTrue())
+		Expect(dev.Rejected()).To(Equal(uint64(0)))
+	})
+
+})
@@ -0,0 +1,193 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/db"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Longest profile fields in characters, updates have to fit in a message
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxLocationLength    = 60
+	maxAvatarURLLength   = 256
+)
+
+// Scores a buyer can rate a seller with
+const (
+	minRating = 1
+	maxRating = 5
+)
+
+// Fields of a profile that can be made private
+var privateProfileFields = map[string]bool{
+	db.ProfileBio:          true,
+	db.ProfileLocation:     true,
+	db.ProfileListingCount: true,
+	db.ProfileJoinedAt:     true,
+	db.ProfileRating:       true,
+}
+
+// GetProfile returns the profile of the user, with private fields left empty
+// unless the socket is logged in as them. Logged out sockets can see profiles.
+func (ws WSDBProxy) GetProfile(socketID string, username *string) (db.Profile, error) {
+
+	if ws.DatabaseManager == nil {
+		return db.Profile{}, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	profile, err := (*ws.DatabaseManager).GetProfile(ws.resolveUsername(username))
+
+	if err != nil {
+		return db.Profile{}, err
+	}
+
+	profile.AvatarURL = ws.mediaURL(profile.AvatarURL)
+
+	if ws.IsLoggedIn(socketID) && ws.usernameOf(socketID) == profile.Username {
+		return profile, nil
+	}
+
+	return hidePrivate(profile), nil
+}
+
+// UpdateProfile changes the profile of the logged in user
+func (ws WSDBProxy) UpdateProfile(socketID string, update *db.ProfileUpdate) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		if invalid := ValidateProfile(update); len(invalid) != 0 {
+			return fmt.Errorf("profile: invalid %s", strings.Join(invalid, ", "))
+		}
+
+		username := ws.usernameOf(socketID)
+
+		return (*ws.DatabaseManager).UpdateProfile(&username, update)
+
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// RateSeller lets the logged in user score the seller of a listing they
+// bought from 1 to 5
+func (ws WSDBProxy) RateSeller(socketID string, listingID *int64, score int64) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		if score < minRating || score > maxRating {
+			return fmt.Errorf("rating: a rating is from %d to %d", minRating, maxRating)
+		}
+
+		username := ws.usernameOf(socketID)
+
+		return (*ws.DatabaseManager).RateSeller(&username, listingID, score)
+
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// hidePrivate empties the fields the owner made private
+func hidePrivate(profile db.Profile) db.Profile {
+	for _, field := range profile.Private {
+		switch field {
+
+		case db.ProfileBio:
+			profile.Bio = ""
+
+		case db.ProfileLocation:
+			profile.Location = ""
+
+		case db.ProfileListingCount:
+			profile.ListingCount = 0
+
+		case db.ProfileJoinedAt:
+			profile.JoinedAt = 0
+
+		case db.ProfileRating:
+			profile.Rating = 0
+			profile.RatingCount = 0
+
+		}
+	}
+
+	return profile
+}
+
+// ValidateProfile returns the names of the fields of the update that are
+// not allowed
+func ValidateProfile(update *db.ProfileUpdate) []string {
+	invalid := []string{}
+
+	if update.DisplayName != nil && !isValidText(*update.DisplayName, maxDisplayNameLength, false) {
+		invalid = append(invalid, "DisplayName")
+	}
+
+	if update.Bio != nil && !isValidText(*update.Bio, maxBioLength, true) {
+		invalid = append(invalid, "Bio")
+	}
+
+	if update.Location != nil && !isValidText(*update.Location, maxLocationLength, false) {
+		invalid = append(invalid, "Location")
+	}
+
+	if update.AvatarURL != nil && *update.AvatarURL != "" && !isValidAvatarURL(*update.AvatarURL) {
+		invalid = append(invalid, "AvatarURL")
+	}
+
+	if update.Private != nil {
+		for _, field := range *update.Private {
+			if !privateProfileFields[field] {
+				invalid = append(invalid, "Private")
+				break
+			}
+		}
+	}
+
+	return invalid
+}
+
+// isValidText allows printable text without surrounding spaces, new lines
+// only when multiline
+func isValidText(text string, maxLength int, multiline bool) bool {
+	if !utf8.ValidString(text) || utf8.RuneCountInString(text) > maxLength || strings.TrimSpace(text) != text {
+		return false
+	}
+
+	for _, char := range text {
+		if char == '\n' && multiline {
+			continue
+		}
+
+		if !unicode.IsPrint(char) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isValidAvatarURL only allows https links, so pages showing the avatar are
+// not downgraded to http
+func isValidAvatarURL(avatarURL string) bool {
+	if len(avatarURL) > maxAvatarURLLength {
+		return false
+	}
+
+	parsed, err := url.Parse(avatarURL)
+
+	return err == nil && parsed.Scheme == "https" && parsed.Host != "" && parsed.User == nil
+}
@@ -0,0 +1,78 @@
+package ws
+
+import (
+	"go-websocket/pkg/db"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Profile", func() {
+
+	text := func(value string) *string { return &value }
+
+	It("Validate: accepts a normal update", func() {
+		private := []string{db.ProfileLocation, db.ProfileRating}
+
+		Expect(ValidateProfile(&db.ProfileUpdate{
+			DisplayName: text("Some User"),
+			Bio:         text("Selling things\nand buying others"),
+			Location:    text("Zürich"),
+			AvatarURL:   text("https://img.example.com/some.png"),
+			Private:     &private,
+		})).To(BeEmpty())
+	})
+
+	It("Validate: empty fields clear them", func() {
+		Expect(ValidateProfile(&db.ProfileUpdate{
+			DisplayName: text(""),
+			AvatarURL:   text(""),
+		})).To(BeEmpty())
+	})
+
+	It("Validate: refuses long and unprintable text", func() {
+		Expect(ValidateProfile(&db.ProfileUpdate{
+			DisplayName: text(strings.Repeat("a", maxDisplayNameLength+1)),
+			Bio:         text("bell\a"),
+			Location:    text("two\nlines"),
+		})).To(Equal([]string{"DisplayName", "Bio", "Location"}))
+	})
+
+	It("Validate: length is counted in characters", func() {
+		Expect(ValidateProfile(&db.ProfileUpdate{
+			DisplayName: text(strings.Repeat("ü", maxDisplayNameLength)),
+		})).To(BeEmpty())
+	})
+
+	It("Validate: avatar has to be an https link", func() {
+		for _, avatar := range []string{"http://img.example.com/a.png", "javascript:alert(1)", "https://user@img.example.com/a.png", "/a.png"} {
+			Expect(ValidateProfile(&db.ProfileUpdate{AvatarURL: text(avatar)})).To(Equal([]string{"AvatarURL"}), avatar)
+		}
+	})
+
+	It("Validate: refuses unknown private fields", func() {
+		private := []string{"Email"}
+
+		Expect(ValidateProfile(&db.ProfileUpdate{Private: &private})).To(Equal([]string{"Private"}))
+	})
+
+	It("Privacy: private fields are emptied", func() {
+		profile := hidePrivate(db.Profile{
+			Username:    "some-user",
+			Bio:         "Selling things",
+			Location:    "Zürich",
+			JoinedAt:    1600000000,
+			Rating:      4.5,
+			RatingCount: 2,
+			Private:     []string{db.ProfileLocation, db.ProfileRating},
+		})
+
+		Expect(profile.Location).To(Equal(""))
+		Expect(profile.Rating).To(BeZero())
+		Expect(profile.RatingCount).To(BeZero())
+		Expect(profile.Bio).To(Equal("Selling things"), "Public fields should stay")
+		Expect(profile.JoinedAt).To(Equal(int64(1600000000)))
+	})
+
+})
@@ -0,0 +1,105 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/mail"
+	"strings"
+	"time"
+)
+
+// How long a password reset email can be used for
+const resetTokenTTL = time.Hour
+
+// RequestPasswordReset emails a reset token to the account. It succeeds even
+// when there is no account, so it cannot be used to find out who has one.
+func (ws WSDBProxy) RequestPasswordReset(email *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if ws.OneTimeStore == nil || ws.Mailer == nil {
+		return fmt.Errorf("password reset has not been intialised")
+	}
+
+	if _, err := (*ws.DatabaseManager).GetUsername(email); err != nil {
+		if strings.HasPrefix(err.Error(), "email:") {
+			return nil
+		}
+
+		return err
+	}
+
+	token, hash := auth.NewRefreshToken()
+
+	err := (*ws.OneTimeStore).Create(auth.OneTimeToken{
+		Hash:      hash,
+		Purpose:   auth.PurposePasswordReset,
+		Subject:   *email,
+		ExpiresAt: time.Now().Add(resetTokenTTL),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return (*ws.Mailer).Send(mail.Message{
+		To:      *email,
+		Subject: "Reset your password",
+		Body: "Someone asked to reset the password of your account. Use the link below within an hour to choose a new one.\n\n" +
+			ws.ResetURL + token + "\n\n" +
+			"If it was not you, ignore this email and your password will stay the same.\n",
+	})
+}
+
+// ResetPassword sets a new password with a token from the reset email, every
+// session of the account is signed out
+func (ws WSDBProxy) ResetPassword(token, password *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if ws.OneTimeStore == nil {
+		return fmt.Errorf("password reset has not been intialised")
+	}
+
+	hash := auth.HashToken(*token)
+
+	// Look before using the token up, so a refused password can be retried
+	reset, err := (*ws.OneTimeStore).Get(hash, auth.PurposePasswordReset, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	username, err := (*ws.DatabaseManager).GetUsername(&reset.Subject)
+
+	if err != nil {
+		return err
+	}
+
+	if ws.PasswordPolicy != nil {
+		if err = ws.PasswordPolicy.Check(*password, username, reset.Subject); err != nil {
+			return err
+		}
+	}
+
+	if _, err = (*ws.OneTimeStore).Consume(hash, auth.PurposePasswordReset, time.Now()); err != nil {
+		return err
+	}
+
+	if err = (*ws.DatabaseManager).SetPassword(&reset.Subject, password); err != nil {
+		return err
+	}
+
+	// Owning the email proves who they are, so failed logins no longer count
+	if ws.LoginLimiter != nil {
+		if err = ws.LoginLimiter.Unlock(reset.Subject); err != nil {
+			return err
+		}
+	}
+
+	return ws.revokeAllSessions(username, "")
+}
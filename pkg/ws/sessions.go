@@ -0,0 +1,285 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+	dt "go-websocket/pkg/ws/messages"
+	"log"
+	"time"
+)
+
+const (
+	// Access tokens are short lived, clients keep sockets alive with the
+	// refresh token
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+func (ws WSDBProxy) ConnectSessionToID(sessionID string, id string) error {
+
+	if ws.IdToSession == nil {
+		return fmt.Errorf("map has not been intialised")
+	}
+
+	socketsMu.Lock()
+	ws.IdToSession[id] = sessionID
+	socketsMu.Unlock()
+
+	return nil
+}
+
+// ConnectExpiryToID logs the socket out once the access token it was
+// authenticated with expires
+func (ws WSDBProxy) ConnectExpiryToID(expiresAt int64, id string) error {
+
+	if ws.IdToExpiry == nil {
+		return nil
+	}
+
+	socketsMu.Lock()
+	ws.IdToExpiry[id] = expiresAt
+	socketsMu.Unlock()
+
+	return nil
+}
+
+func (ws WSDBProxy) isExpired(id string) bool {
+	if ws.IdToExpiry == nil {
+		return false
+	}
+
+	socketsMu.RLock()
+	expiresAt, ok := ws.IdToExpiry[id]
+	socketsMu.RUnlock()
+
+	return ok && time.Now().Unix() >= expiresAt
+}
+
+// SessionOf returns the session connected to the socket id, or "" if none
+func (ws WSDBProxy) SessionOf(id string) string {
+	if ws.IdToSession == nil {
+		return ""
+	}
+
+	socketsMu.RLock()
+	defer socketsMu.RUnlock()
+
+	return ws.IdToSession[id]
+}
+
+func (ws WSDBProxy) isRevoked(sessionID string) bool {
+	if sessionID == "" || ws.RevocationStore == nil {
+		return false
+	}
+
+	revoked, err := (*ws.RevocationStore).IsRevoked(sessionID)
+
+	// fail closed, the user can log in again
+	if err != nil {
+		log.Printf("error: could not check revocation: %v", err)
+		return true
+	}
+
+	return revoked
+}
+
+func (ws WSDBProxy) ValidateToken(token string) (*dt.Claims, error) {
+	claims, err := ParseToken(ws.Keys, token)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if ws.isRevoked(claims.SessionID) {
+		return nil, fmt.Errorf("token has been revoked")
+	}
+
+	// Tokens on other devices still carry the username from before a rename
+	if ws.DatabaseManager != nil {
+		claims.Username = *ws.resolveUsername(&claims.Username)
+	}
+
+	return claims, nil
+}
+
+// IssueTokens starts a new session for a fresh login
+func (ws WSDBProxy) IssueTokens(username, userAgent, ip string) (dt.TokenPair, error) {
+
+	if ws.RefreshStore == nil {
+		return dt.TokenPair{}, fmt.Errorf("RefreshStore has not been intialised")
+	}
+
+	now := time.Now()
+	refreshToken, hash := auth.NewRefreshToken()
+
+	record := auth.RefreshRecord{
+		Hash:      hash,
+		Family:    auth.NewFamily(),
+		Username:  username,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+
+	if err := (*ws.RefreshStore).Create(record); err != nil {
+		return dt.TokenPair{}, err
+	}
+
+	return ws.pairFor(username, refreshToken, record)
+}
+
+// RefreshTokens exchanges a refresh token for a new pair, the old refresh
+// token cannot be used again
+func (ws WSDBProxy) RefreshTokens(refreshToken, userAgent, ip string) (string, dt.TokenPair, error) {
+
+	if ws.RefreshStore == nil {
+		return "", dt.TokenPair{}, fmt.Errorf("RefreshStore has not been intialised")
+	}
+
+	now := time.Now()
+	nextToken, hash := auth.NewRefreshToken()
+
+	next := auth.RefreshRecord{
+		Hash:      hash,
+		IssuedAt:  now,
+		ExpiresAt: now.Add(refreshTokenTTL),
+		UserAgent: userAgent,
+		IP:        ip,
+	}
+
+	old, err := (*ws.RefreshStore).Rotate(auth.HashToken(refreshToken), next, now)
+
+	if err != nil {
+		return "", dt.TokenPair{}, err
+	}
+
+	next.Family = old.Family
+	pair, err := ws.pairFor(old.Username, nextToken, next)
+
+	return old.Username, pair, err
+}
+
+func (ws WSDBProxy) pairFor(username, refreshToken string, record auth.RefreshRecord) (dt.TokenPair, error) {
+	expirationTime := record.IssuedAt.Add(accessTokenTTL)
+	token, err := CreateToken(ws.Keys, username, record.Family, expirationTime)
+
+	if err != nil {
+		return dt.TokenPair{}, err
+	}
+
+	return dt.TokenPair{
+		Token:            token,
+		ExpiresAt:        expirationTime.Unix(),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: record.ExpiresAt.Unix(),
+		SessionID:        record.Family,
+	}, nil
+}
+
+func (ws WSDBProxy) ListSessions(socketID string) ([]auth.Session, error) {
+
+	if ws.RefreshStore == nil {
+		return nil, fmt.Errorf("RefreshStore has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+		return (*ws.RefreshStore).ListSessions(ws.usernameOf(socketID), time.Now())
+	}
+
+	return nil, fmt.Errorf("user is not logged in")
+}
+
+// RevokeSession signs a session of the logged in user out everywhere
+func (ws WSDBProxy) RevokeSession(socketID string, sessionID string) error {
+
+	sessions, err := ws.ListSessions(socketID)
+
+	if err != nil {
+		return err
+	}
+
+	// only the owner may revoke a session
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			return ws.revokeSession(sessionID)
+		}
+	}
+
+	return fmt.Errorf("session: session does not exist")
+}
+
+func (ws WSDBProxy) revokeSession(sessionID string) error {
+
+	if err := (*ws.RefreshStore).RevokeFamily(sessionID); err != nil {
+		return err
+	}
+
+	if ws.RevocationStore == nil {
+		return nil
+	}
+
+	// access tokens of the session are refused until they expire
+	return (*ws.RevocationStore).Revoke(sessionID, time.Now().Add(accessTokenTTL))
+}
+
+// revokeAllSessions signs the user out of every session and socket, except
+// for the session keep when it is not ""
+func (ws WSDBProxy) revokeAllSessions(username string, keep string) error {
+
+	if ws.RefreshStore != nil {
+		sessions, err := (*ws.RefreshStore).ListSessions(username, time.Now())
+
+		if err != nil {
+			return err
+		}
+
+		for _, session := range sessions {
+			if session.ID == keep {
+				continue
+			}
+
+			if err = ws.revokeSession(session.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	// sockets may have logged in before sessions were revocable
+	if ws.IdToUsername != nil {
+		socketsMu.Lock()
+		defer socketsMu.Unlock()
+
+		for id, name := range ws.IdToUsername {
+			if name == username && (keep == "" || ws.IdToSession[id] != keep) {
+				delete(ws.IdToUsername, id)
+
+				if ws.IdToSession != nil {
+					delete(ws.IdToSession, id)
+				}
+
+				if ws.IdToExpiry != nil {
+					delete(ws.IdToExpiry, id)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// Logout revokes the session of the socket and disconnects it from the user
+func (ws WSDBProxy) Logout(socketID string) error {
+
+	if !ws.IsLoggedIn(socketID) {
+		return fmt.Errorf("user is not logged in")
+	}
+
+	if sessionID := ws.SessionOf(socketID); sessionID != "" && ws.RefreshStore != nil {
+		if err := ws.revokeSession(sessionID); err != nil {
+			return err
+		}
+	}
+
+	return ws.LogoutID(socketID)
+}
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"go-websocket/pkg/auth"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Sessions", func() {
+
+	It("Expiry: a socket is logged out once its access token expires", func() {
+		proxy := WSDBProxy{
+			IdToUsername: make(map[string]string),
+			IdToSession:  make(map[string]string),
+			IdToExpiry:   make(map[string]int64),
+		}
+
+		username := "some-user"
+
+		Expect(proxy.ConnectUsernameToID(&username, "socketOne")).To(BeNil())
+		Expect(proxy.ConnectExpiryToID(time.Now().Add(time.Minute).Unix(), "socketOne")).To(BeNil())
+		Expect(proxy.IsLoggedIn("socketOne")).To(BeTrue())
+
+		Expect(proxy.ConnectExpiryToID(time.Now().Add(-time.Second).Unix(), "socketOne")).To(BeNil())
+		Expect(proxy.IsLoggedIn("socketOne")).To(BeFalse(), "The socket has to refresh its token")
+		Expect(proxy.usernameOf("socketOne")).To(BeEmpty())
+	})
+
+	It("Expiry: a revoked socket does not come back when the revocation lapses", func() {
+		revocations := auth.NewMemoryRevocationStore()
+
+		var store auth.RevocationStore = revocations
+
+		proxy := WSDBProxy{
+			IdToUsername:    make(map[string]string),
+			IdToSession:     make(map[string]string),
+			IdToExpiry:      make(map[string]int64),
+			RevocationStore: &store,
+		}
+
+		username := "some-user"
+
+		// the socket logged in with a token that has now expired, and its
+		// session was revoked for as long as the token lasted
+		issuedAt := time.Now().Add(-accessTokenTTL - time.Second)
+
+		Expect(proxy.ConnectUsernameToID(&username, "socketOne")).To(BeNil())
+		Expect(proxy.ConnectSessionToID("session", "socketOne")).To(BeNil())
+		Expect(proxy.ConnectExpiryToID(issuedAt.Add(accessTokenTTL).Unix(), "socketOne")).To(BeNil())
+		Expect(revocations.Revoke("session", issuedAt.Add(accessTokenTTL))).To(BeNil())
+
+		Expect(proxy.isRevoked("session")).To(BeFalse(), "The revocation has lapsed")
+		Expect(proxy.IsLoggedIn("socketOne")).To(BeFalse(), "The token the socket logged in with has expired too")
+	})
+
+})
@@ -0,0 +1,131 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+	"time"
+)
+
+// twoFactorEnabled is false for everyone when 2FA is not configured
+func (ws WSDBProxy) twoFactorEnabled(username string) (bool, error) {
+	if ws.TwoFactor == nil {
+		return false, nil
+	}
+
+	return ws.TwoFactor.Enabled(username)
+}
+
+// VerifyTwoFactor finishes a login that needed a code, wrong codes count as
+// failed logins for the email and ip
+func (ws WSDBProxy) VerifyTwoFactor(username, email, ip, code string) error {
+
+	if ws.TwoFactor == nil {
+		return fmt.Errorf("TwoFactor has not been intialised")
+	}
+
+	if ws.LoginLimiter != nil {
+		if err := ws.LoginLimiter.Check(email, ip); err != nil {
+			return err
+		}
+	}
+
+	if err := ws.TwoFactor.Verify(username, code); err != nil {
+		if ws.LoginLimiter != nil {
+			if limitErr := ws.LoginLimiter.RecordFailure(email, ip); limitErr != nil {
+				return limitErr
+			}
+		}
+
+		return err
+	}
+
+	if ws.LoginLimiter != nil {
+		return ws.LoginLimiter.RecordSuccess(email)
+	}
+
+	return nil
+}
+
+// PendingExternalLogin exchanges the login token of a provider login that
+// needed a code for the username and email of the account, it only works once
+func (ws WSDBProxy) PendingExternalLogin(loginToken string) (string, string, error) {
+
+	if ws.DatabaseManager == nil {
+		return "", "", fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if ws.OneTimeStore == nil {
+		return "", "", auth.ErrOneTimeInvalid
+	}
+
+	pending, err := (*ws.OneTimeStore).Consume(auth.HashToken(loginToken), auth.PurposeTwoFactorLogin, time.Now())
+
+	if err != nil {
+		return "", "", err
+	}
+
+	username := pending.Subject
+	email, err := (*ws.DatabaseManager).GetEmail(&username)
+
+	return username, email, err
+}
+
+// EnableTwoFactor starts enrolling the user, returning the provisioning URI
+// for their authenticator app
+func (ws WSDBProxy) EnableTwoFactor(socketID string) (string, error) {
+
+	if ws.TwoFactor == nil {
+		return "", fmt.Errorf("TwoFactor has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		return ws.TwoFactor.Enroll(username, username)
+
+	}
+
+	return "", fmt.Errorf("user is not logged in")
+}
+
+// ConfirmTwoFactor enables 2FA with the first code from the app, returning
+// the recovery codes
+func (ws WSDBProxy) ConfirmTwoFactor(socketID string, code *string) ([]string, error) {
+
+	if ws.TwoFactor == nil {
+		return nil, fmt.Errorf("TwoFactor has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+		return ws.TwoFactor.Confirm(ws.usernameOf(socketID), *code)
+	}
+
+	return nil, fmt.Errorf("user is not logged in")
+}
+
+// DisableTwoFactor turns 2FA off, needing both the password and a code
+func (ws WSDBProxy) DisableTwoFactor(socketID string, password, code *string) error {
+
+	if ws.TwoFactor == nil {
+		return fmt.Errorf("TwoFactor has not been intialised")
+	}
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		if _, err := ws.checkPassword(username, password); err != nil {
+			return err
+		}
+
+		return ws.TwoFactor.Disable(username, *code)
+
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
@@ -0,0 +1,109 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/storage"
+)
+
+// BeginUpload starts a file sent in chunks, size bytes with the SHA-256
+// checksum in hex. The quota is checked now so a large upload is not sent
+// only to be refused.
+func (ws WSDBProxy) BeginUpload(socketID string, purpose string, size int64, checksum string) (storage.UploadStatus, error) {
+
+	if ws.Uploads == nil || ws.Media == nil {
+		return storage.UploadStatus{}, fmt.Errorf("Uploads has not been intialised")
+	}
+
+	if ws.DatabaseManager == nil {
+		return storage.UploadStatus{}, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		if err := validPurpose(purpose); err != nil {
+			return storage.UploadStatus{}, err
+		}
+
+		if err := ws.requireVerified(username); err != nil {
+			return storage.UploadStatus{}, err
+		}
+
+		if err := ws.checkQuota(username, size); err != nil {
+			return storage.UploadStatus{}, err
+		}
+
+		return ws.Uploads.Begin(username, purpose, size, checksum)
+
+	}
+
+	return storage.UploadStatus{}, fmt.Errorf("user is not logged in")
+}
+
+// UploadChunk adds a chunk to an upload of the user
+func (ws WSDBProxy) UploadChunk(socketID string, uploadID string, index int, checksum string, data []byte) error {
+
+	if ws.Uploads == nil {
+		return fmt.Errorf("Uploads has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+		return ws.Uploads.Chunk(ws.usernameOf(socketID), uploadID, index, checksum, data)
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
+
+// UploadStatus tells a reconnected client which chunks it still has to send
+func (ws WSDBProxy) UploadStatus(socketID string, uploadID string) (storage.UploadStatus, error) {
+
+	if ws.Uploads == nil {
+		return storage.UploadStatus{}, fmt.Errorf("Uploads has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+		return ws.Uploads.Status(ws.usernameOf(socketID), uploadID)
+	}
+
+	return storage.UploadStatus{}, fmt.Errorf("user is not logged in")
+}
+
+// CommitUpload stores the finished file like a single message upload,
+// returning its key and URL
+func (ws WSDBProxy) CommitUpload(socketID string, uploadID string) (string, string, error) {
+
+	if ws.Uploads == nil || ws.Media == nil {
+		return "", "", fmt.Errorf("Uploads has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+
+		username := ws.usernameOf(socketID)
+
+		status, data, err := ws.Uploads.Commit(username, uploadID)
+
+		if err != nil {
+			return "", "", err
+		}
+
+		return ws.storeMedia(username, status.Purpose, data)
+
+	}
+
+	return "", "", fmt.Errorf("user is not logged in")
+}
+
+// AbortUpload drops an upload of the user
+func (ws WSDBProxy) AbortUpload(socketID string, uploadID string) error {
+
+	if ws.Uploads == nil {
+		return fmt.Errorf("Uploads has not been intialised")
+	}
+
+	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
+		return ws.Uploads.Abort(ws.usernameOf(socketID), uploadID)
+	}
+
+	return fmt.Errorf("user is not logged in")
+}
@@ -1,138 +1,120 @@
 package ws
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"go-websocket/pkg/auth"
 	dt "go-websocket/pkg/ws/messages"
 	"net/http"
 	"net/mail"
-	"os"
+	"strings"
 	"time"
-	"unicode"
 
 	"github.com/dgrijalva/jwt-go"
+	"github.com/gorilla/websocket"
 )
 
-func CreateToken(username string, expirationTime time.Time) (string, error) {
-	var err error
+func CreateToken(keys *auth.KeyManager, username, sessionID string, expirationTime time.Time) (string, error) {
+
+	if keys == nil {
+		return "", fmt.Errorf("KeyManager has not been intialised")
+	}
 
 	//Creating Access Token
 	claims := &dt.Claims{
-		Username: username,
+		Username:  username,
+		SessionID: sessionID,
 		StandardClaims: jwt.StandardClaims{
 			// In JWT, the expiry time is expressed as unix milliseconds
 			ExpiresAt: expirationTime.Unix(),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenStr, err := token.SignedString([]byte(os.Getenv("ACCESS_SECRET")))
-
-	if err != nil {
-		return "", err
-	}
-
-	return tokenStr, nil
+	return keys.Sign(claims)
 }
 
-func IsValidToken(tokenStr string) bool {
-
-	//Creating Access Token
-	claims := &dt.Claims{}
-
-	// Parse the JWT string and store the result in `claims`.
-	_, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return os.Getenv("ACCESS_SECRET"), nil
-	})
+func IsValidToken(keys *auth.KeyManager, tokenStr string) bool {
+	_, err := ParseToken(keys, tokenStr)
 
 	//False if any err is returned
 	return err == nil
-
 }
 
-func RefreshToken(w http.ResponseWriter, r *http.Request, expirationTime time.Time) error {
+// ParseToken verifies the token and returns the claims it carries
+func ParseToken(keys *auth.KeyManager, tokenStr string) (*dt.Claims, error) {
 
-	c, err := r.Cookie("token")
-	if err != nil {
-		return err
+	if keys == nil {
+		return nil, fmt.Errorf("KeyManager has not been intialised")
 	}
 
-	tknStr := c.Value
 	claims := &dt.Claims{}
 
-	tkn, err := jwt.ParseWithClaims(tknStr, claims, func(token *jwt.Token) (interface{}, error) {
-		return os.Getenv("ACCESS_SECRET"), nil
-	})
+	// Parse the JWT string and store the result in `claims`.
+	token, err := jwt.ParseWithClaims(tokenStr, claims, keys.Keyfunc)
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	if !tkn.Valid {
-		return fmt.Errorf("token is invalid")
+	if !token.Valid || claims.Username == "" {
+		return nil, fmt.Errorf("token is invalid")
 	}
 
-	// We ensure that a new token is not issued until enough time has elapsed
-	// In this case, a new token will only be issued if the old token is within
-	// 30 seconds of expiry. Otherwise, return a bad request status
-	if time.Unix(claims.ExpiresAt, 0).Sub(time.Now()) > 30*time.Minute {
-		return fmt.Errorf("token is not valid")
+	return claims, nil
+}
+
+// tokenFromRequest finds a token sent with the websocket handshake. Browsers
+// cannot set headers on a websocket, so the token may also be sent as the
+// subprotocols "bearer", "<token>". The subprotocol to echo back is returned.
+func tokenFromRequest(r *http.Request) (string, string) {
+
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")), ""
 	}
 
-	// Now, create a new token for the current use, with a renewed expiration time
-	claims.ExpiresAt = expirationTime.Unix()
+	protocols := websocket.Subprotocols(r)
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(os.Getenv("ACCESS_SECRET"))
+	for i := 0; i+1 < len(protocols); i++ {
+		if protocols[i] == "bearer" {
+			return protocols[i+1], "bearer"
+		}
+	}
 
-	if err != nil {
-		return err
+	if cookie, err := r.Cookie("token"); err == nil {
+		return cookie.Value, ""
 	}
 
-	// Set the new token as the users `token` cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    tokenString,
-		Expires:  expirationTime,
-		HttpOnly: true,
-	})
+	return "", ""
+}
 
-	return nil
+// newSocketID returns a random identifier for a connection
+func newSocketID() string {
+	id := make([]byte, 16)
 
-}
+	if _, err := rand.Read(id); err != nil {
+		panic(err)
+	}
 
-func IsValid(email string) bool {
-	_, err := mail.ParseAddress(email)
-	return err == nil
+	return hex.EncodeToString(id)
 }
 
-func IsValidPassword(password string) bool {
-	// if length is invalid don't bother checking the rest
-	if len(password) < 10 {
+// IsValidUsername allows 3 to 32 letters, numbers, '.', '-' and '_'
+func IsValidUsername(username string) bool {
+	if len(username) < 3 || len(username) > 32 {
 		return false
 	}
 
-	var (
-		hasUpper  = false
-		hasLower  = false
-		hasNumber = false
-	)
-
-	for _, char := range password {
-		switch {
-		case unicode.IsUpper(char):
-			hasUpper = true
-		case unicode.IsLower(char):
-			hasLower = true
-		case unicode.IsNumber(char):
-			hasNumber = true
-		}
-
-		// check if we have found all
-		if hasLower && hasUpper && hasNumber {
-			return true
+	for _, char := range username {
+		if !(char >= 'a' && char <= 'z' || char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || strings.ContainsRune("._-", char)) {
+			return false
 		}
 	}
 
-	// if we get here then we can't have found them all
-	return false
+	return true
+}
+
+func IsValid(email string) bool {
+	_, err := mail.ParseAddress(email)
+	return err == nil
 }
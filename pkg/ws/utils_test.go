@@ -0,0 +1,108 @@
+package ws
+
+import (
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/oidc"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Utils", func() {
+
+	keys, _ := auth.NewKeyManager(auth.AlgorithmHS256)
+	keys.AddSecret([]byte("a-secret-that-is-at-least-32-bytes"), true)
+
+	It("Token: created token can be parsed", func() {
+		token, err := CreateToken(keys, "some-user", "session", time.Now().Add(time.Hour))
+		Expect(err).To(BeNil())
+
+		claims, err := ParseToken(keys, token)
+		Expect(err).To(BeNil(), "Token should be valid")
+		Expect(claims.Username).To(Equal("some-user"))
+	})
+
+	It("Token: expired token is invalid", func() {
+		token, _ := CreateToken(keys, "some-user", "session", time.Now().Add(-time.Hour))
+
+		Expect(IsValidToken(keys, token)).To(BeFalse(), "Token should have expired")
+	})
+
+	It("Token: token from another key is invalid", func() {
+		other, _ := auth.NewKeyManager(auth.AlgorithmHS256)
+		other.AddSecret([]byte("another-secret-of-at-least-32-bytes"), true)
+
+		token, _ := CreateToken(other, "some-user", "session", time.Now().Add(time.Hour))
+
+		Expect(IsValidToken(keys, token)).To(BeFalse(), "Token should not verify")
+	})
+
+	It("Handshake: token from authorization header", func() {
+		request := httptest.NewRequest("GET", "/ws", nil)
+		request.Header.Set("Authorization", "Bearer abc")
+
+		token, protocol := tokenFromRequest(request)
+		Expect(token).To(Equal("abc"))
+		Expect(protocol).To(Equal(""))
+	})
+
+	It("Handshake: token from subprotocol", func() {
+		request := httptest.NewRequest("GET", "/ws", nil)
+		request.Header.Set("Sec-WebSocket-Protocol", "bearer, abc")
+
+		token, protocol := tokenFromRequest(request)
+		Expect(token).To(Equal("abc"))
+		Expect(protocol).To(Equal("bearer"), "Subprotocol should be echoed back")
+	})
+
+	It("Handshake: token from cookie", func() {
+		request := httptest.NewRequest("GET", "/ws", nil)
+		request.AddCookie(&http.Cookie{Name: "token", Value: "abc"})
+
+		token, _ := tokenFromRequest(request)
+		Expect(token).To(Equal("abc"))
+	})
+
+	It("Handshake: no token", func() {
+		request := httptest.NewRequest("GET", "/ws", nil)
+
+		token, _ := tokenFromRequest(request)
+		Expect(token).To(Equal(""))
+	})
+
+	It("Username: allows letters, numbers and separators", func() {
+		Expect(IsValidUsername("some-user_1.2")).To(BeTrue())
+	})
+
+	It("Username: refuses short, long and unusual usernames", func() {
+		Expect(IsValidUsername("ab")).To(BeFalse())
+		Expect(IsValidUsername("a-username-that-is-far-too-long-to-use")).To(BeFalse())
+		Expect(IsValidUsername("some user")).To(BeFalse())
+		Expect(IsValidUsername("sömeuser")).To(BeFalse())
+	})
+
+	It("Username: external accounts get a valid username", func() {
+		Expect(usernameFor(oidc.Identity{PreferredUsername: "Some User!"})).To(Equal("SomeUser"))
+		Expect(usernameFor(oidc.Identity{Email: "someone@example.com"})).To(Equal("someone"))
+		Expect(usernameFor(oidc.Identity{Email: "ab@example.com"})).To(Equal("userab"))
+		Expect(len(usernameFor(oidc.Identity{PreferredUsername: "a-username-that-is-far-too-long-to-use"}))).To(Equal(27))
+	})
+
+	It("External login: a login needing 2FA sends its login token back", func() {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/auth/example/callback", nil)
+
+		ExternalLoginError("https://example.com/login")(recorder, request, &TwoFactorPendingError{LoginToken: "some-token"})
+
+		Expect(recorder.Header().Get("Location")).To(Equal("https://example.com/login#LoginToken=some-token&ResponseCode=16"))
+
+		recorder = httptest.NewRecorder()
+		ExternalLoginError("https://example.com/login")(recorder, request, auth.ErrTwoFactorRequired)
+
+		Expect(recorder.Header().Get("Location")).To(Equal("https://example.com/login#ResponseCode=16"))
+	})
+
+})
@@ -0,0 +1,117 @@
+package ws
+
+import (
+	"fmt"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/db"
+	"go-websocket/pkg/mail"
+	"strings"
+	"time"
+)
+
+// How long a verification email can be used for, a changed email is held
+// for the account as long
+const verifyTokenTTL = db.PendingEmailTTL
+
+// sendVerification emails a token confirming the address belongs to the user
+func (ws WSDBProxy) sendVerification(email string) error {
+
+	if ws.OneTimeStore == nil || ws.Mailer == nil {
+		return fmt.Errorf("email verification has not been intialised")
+	}
+
+	token, hash := auth.NewRefreshToken()
+
+	err := (*ws.OneTimeStore).Create(auth.OneTimeToken{
+		Hash:      hash,
+		Purpose:   auth.PurposeVerifyEmail,
+		Subject:   email,
+		ExpiresAt: time.Now().Add(verifyTokenTTL),
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return (*ws.Mailer).Send(mail.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body: "Use the link below within two days to confirm the email of your new account.\n\n" +
+			ws.VerifyURL + token + "\n\n" +
+			"If you did not create an account, ignore this email and it will be removed.\n",
+	})
+}
+
+// ResendVerification emails a new verification token, earlier ones stop
+// working. Like a password reset it succeeds when there is no account.
+func (ws WSDBProxy) ResendVerification(email *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	username, err := (*ws.DatabaseManager).GetUsername(email)
+
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "email:") {
+			return nil
+		}
+
+		return err
+	}
+
+	verified, err := (*ws.DatabaseManager).IsVerified(&username)
+
+	if err != nil || verified {
+		return err
+	}
+
+	return ws.sendVerification(*email)
+}
+
+// VerifyEmail confirms the email with a token from the verification email
+func (ws WSDBProxy) VerifyEmail(token *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if ws.OneTimeStore == nil {
+		return fmt.Errorf("email verification has not been intialised")
+	}
+
+	verification, err := (*ws.OneTimeStore).Consume(auth.HashToken(*token), auth.PurposeVerifyEmail, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	return (*ws.DatabaseManager).VerifyEmail(&verification.Subject)
+}
+
+// requireVerified refuses users who have not confirmed their email
+func (ws WSDBProxy) requireVerified(username string) error {
+
+	verified, err := (*ws.DatabaseManager).IsVerified(&username)
+
+	if err != nil {
+		return err
+	}
+
+	if !verified {
+		return fmt.Errorf("unverified: email has not been verified")
+	}
+
+	return nil
+}
+
+// CleanupUnverified removes accounts that did not confirm their email within
+// maxAge of registering
+func (ws WSDBProxy) CleanupUnverified(maxAge time.Duration) (int64, error) {
+
+	if ws.DatabaseManager == nil {
+		return 0, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	return (*ws.DatabaseManager).DeleteUnverified(time.Now().Add(-maxAge).Unix())
+}
@@ -2,12 +2,83 @@ package ws
 
 import (
 	"fmt"
+	"go-websocket/pkg/auth"
+	"go-websocket/pkg/content"
 	"go-websocket/pkg/db"
+	"go-websocket/pkg/imaging"
+	"go-websocket/pkg/mail"
+	"go-websocket/pkg/storage"
+	"log"
+	"sync"
+	"time"
 )
 
+// Guards IdToUsername, IdToSession and IdToExpiry, each socket runs in its
+// own goroutine
+var socketsMu sync.RWMutex
+
 type WSDBProxy struct {
 	DatabaseManager *db.ISmartDBWriterReader
 	IdToUsername    map[string]string
+
+	// Session of the token each socket logged in with
+	IdToSession map[string]string
+
+	// When the access token of each socket expires, sockets stay logged in
+	// until they log out when nil
+	IdToExpiry map[string]int64
+
+	// Optional, failed logins are not limited when nil
+	LoginLimiter *auth.LoginLimiter
+
+	// Optional, new passwords are not checked when nil
+	PasswordPolicy *auth.PasswordPolicy
+
+	RefreshStore *auth.RefreshStore
+
+	// Optional, revoked sessions are only refused at refresh when nil
+	RevocationStore *auth.RevocationStore
+
+	// Signs and verifies access tokens
+	Keys *auth.KeyManager
+
+	// Tokens sent by email, password resets and verification are refused
+	// when nil
+	OneTimeStore *auth.OneTimeStore
+	Mailer       *mail.Mailer
+
+	// Links in the emails, the token is appended to them
+	ResetURL  string
+	VerifyURL string
+
+	// Optional, nobody can enable 2FA when nil
+	TwoFactor *auth.TwoFactor
+
+	// Uploaded avatars and listing images, uploads are refused and listings
+	// keep image URLs from the client when nil
+	Media *storage.Media
+
+	// Optional, images are stored as they were uploaded when nil
+	Imaging *imaging.Processor
+
+	// Optional, uploads only go over the websocket when nil
+	UploadSigner *storage.UploadSigner
+
+	// Optional, files can only be sent in one message when nil
+	Uploads *storage.Uploads
+
+	// Bytes of media each user can have, unlimited when 0
+	MediaQuota int64
+
+	// Cleans messages and listing text, they are stored as sent when nil
+	Content *content.Rules
+
+	// Messages can be edited and deleted for this long after they are sent,
+	// for ever when 0
+	EditWindow time.Duration
+
+	// Optional, other sockets are not told about changes when nil
+	Hub *Hub
 }
 
 func (ws WSDBProxy) ConnectUsernameToID(username *string, id string) error {
@@ -16,7 +87,9 @@ func (ws WSDBProxy) ConnectUsernameToID(username *string, id string) error {
 		return fmt.Errorf("map has not been intialised")
 	}
 
+	socketsMu.Lock()
 	ws.IdToUsername[id] = *username
+	socketsMu.Unlock()
 
 	fmt.Println("id: ", id, " username", *username)
 
@@ -24,13 +97,48 @@ func (ws WSDBProxy) ConnectUsernameToID(username *string, id string) error {
 
 }
 
+// usernameOf returns the username connected to the socket id, or "" if none
+func (ws WSDBProxy) usernameOf(id string) string {
+	if ws.IdToUsername == nil {
+		return ""
+	}
+
+	socketsMu.RLock()
+	defer socketsMu.RUnlock()
+
+	return ws.IdToUsername[id]
+}
+
+// UsernameOf returns the username the socket is logged in as, or "" if none
+func (ws WSDBProxy) UsernameOf(id string) string {
+	return ws.usernameOf(id)
+}
+
 func (ws WSDBProxy) IsLoggedIn(id string) bool {
 	fmt.Println("id is: ", id)
-	return ws.IdToUsername != nil && ws.IdToUsername[id] != ""
+
+	if ws.usernameOf(id) == "" {
+		return false
+	}
+
+	// A session revoked from another device signs this socket out
+	if ws.isRevoked(ws.SessionOf(id)) {
+		ws.LogoutID(id)
+		return false
+	}
+
+	// Revocations only last as long as access tokens, so a socket has to
+	// refresh its token to stay logged in
+	if ws.isExpired(id) {
+		ws.LogoutID(id)
+		return false
+	}
+
+	return true
 }
 
 func (ws WSDBProxy) IsIDLinkedToUsername(id string, username *string) bool {
-	return ws.IdToUsername != nil && ws.IdToUsername[id] != *username
+	return ws.IdToUsername != nil && ws.usernameOf(id) != *username
 }
 
 func (ws WSDBProxy) LogoutID(id string) error {
@@ -38,32 +146,119 @@ func (ws WSDBProxy) LogoutID(id string) error {
 		return fmt.Errorf("map has not been intialised")
 	}
 
+	socketsMu.Lock()
+	defer socketsMu.Unlock()
+
 	if ws.IdToUsername[id] == "" {
 		return fmt.Errorf("id has no logged in value")
 	}
 
-	// set back to the default value
-	ws.IdToUsername[id] = ""
+	// remove so closed sockets do not build up
+	delete(ws.IdToUsername, id)
+
+	if ws.IdToSession != nil {
+		delete(ws.IdToSession, id)
+	}
+
+	if ws.IdToExpiry != nil {
+		delete(ws.IdToExpiry, id)
+	}
 
 	return nil
 }
 
-func (ws WSDBProxy) CheckLogin(email, password *string) (string, error) {
+func (ws WSDBProxy) CheckLogin(email, password *string, ip string) (string, error) {
 
 	if ws.DatabaseManager == nil {
 		return "", fmt.Errorf("DatabaseManager has not been intialised")
 	}
 
+	// Refuse before touching the password if the email or ip is backing off
+	if ws.LoginLimiter != nil {
+		if err := ws.LoginLimiter.Check(*email, ip); err != nil {
+			return "", err
+		}
+	}
+
 	username, err := (*ws.DatabaseManager).CheckLogin(email, password)
 
+	if err != nil {
+		if ws.LoginLimiter != nil {
+			if limitErr := ws.LoginLimiter.RecordFailure(*email, ip); limitErr != nil {
+				return "", limitErr
+			}
+		}
+
+		return "", err
+	}
+
+	if err = ws.checkSuspended(username); err != nil {
+		return "", err
+	}
+
+	// The password alone is not a successful login with 2FA, so failures
+	// are kept until the code is checked
+	enabled, err := ws.twoFactorEnabled(username)
+
 	if err != nil {
 		return "", err
 	}
 
+	if enabled {
+		return username, auth.ErrTwoFactorRequired
+	}
+
+	if ws.LoginLimiter != nil {
+		if err = ws.LoginLimiter.RecordSuccess(*email); err != nil {
+			return "", err
+		}
+	}
+
 	return username, nil
 }
 
-func (ws WSDBProxy) GetMessages(socketID string, otherUsername *string, time *int64) ([]db.Messages, error) {
+// UnlockAccount removes the lockout on the email and the ip address before it
+// expires, only moderators can. Either can be left empty.
+func (ws WSDBProxy) UnlockAccount(socketID string, email, ip *string) error {
+
+	if ws.DatabaseManager == nil {
+		return fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	if ws.LoginLimiter == nil {
+		return fmt.Errorf("LoginLimiter has not been intialised")
+	}
+
+	moderator, err := ws.requireModerator(socketID)
+
+	if err != nil {
+		return err
+	}
+
+	if *email == "" && *ip == "" {
+		return fmt.Errorf("login: an email or ip address is needed to unlock")
+	}
+
+	if *email != "" {
+		if err = ws.LoginLimiter.Unlock(*email); err != nil {
+			return err
+		}
+	}
+
+	if *ip != "" {
+		if err = ws.LoginLimiter.UnlockIP(*ip); err != nil {
+			return err
+		}
+	}
+
+	log.Printf("moderator %s unlocked logins for %q %q", moderator, *email, *ip)
+
+	return nil
+}
+
+// GetMessages returns the messages with the other user about the listing, or
+// not about any listing when it is nil
+func (ws WSDBProxy) GetMessages(socketID string, otherUsername *string, time *int64, listingID *int64) ([]db.Messages, error) {
 
 	if ws.DatabaseManager == nil {
 		return nil, fmt.Errorf("DatabaseManager has not been intialised")
@@ -71,9 +266,10 @@ func (ws WSDBProxy) GetMessages(socketID string, otherUsername *string, time *in
 
 	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
 
-		username := ws.IdToUsername[socketID]
+		username := ws.usernameOf(socketID)
 
-		messages, err := (*ws.DatabaseManager).GetMessages(&username, otherUsername, time)
+		// Messages sent to an old username belong to the renamed user
+		messages, err := (*ws.DatabaseManager).GetMessages(&username, ws.resolveUsername(otherUsername), time, listingID)
 
 		if err != nil {
 			return nil, err
@@ -86,29 +282,66 @@ func (ws WSDBProxy) GetMessages(socketID string, otherUsername *string, time *in
 	return nil, fmt.Errorf("user is not logged in")
 }
 
-func (ws WSDBProxy) CreateMessage(socketID string, receiverUsername, message *string) error {
+// CreateMessage sends the message and returns its ID. A message about a
+// listing has to be to or from its seller.
+func (ws WSDBProxy) CreateMessage(socketID string, receiverUsername, message *string, listingID *int64) (string, error) {
 
 	if ws.DatabaseManager == nil {
-		return fmt.Errorf("DatabaseManager has not been intialised")
+		return "", fmt.Errorf("DatabaseManager has not been intialised")
 	}
 
 	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
 
-		username := ws.IdToUsername[socketID]
+		username := ws.usernameOf(socketID)
+		receiver := ws.resolveUsername(receiverUsername)
+
+		if err := ws.checkBlocked(username, *receiver); err != nil {
+			return "", err
+		}
+
+		if listingID != nil {
+			if err := ws.checkListingThread(username, *receiver, listingID); err != nil {
+				return "", err
+			}
+		}
 
-		// TODO: Add Validation to check message length and validation for attacks
+		if ws.Content != nil {
+			cleaned, err := ws.Content.Message.Clean(*message)
 
-		err := (*ws.DatabaseManager).CreateMessage(&username, receiverUsername, message)
+			if err != nil {
+				return "", err
+			}
+
+			message = &cleaned.Text
+		}
+
+		id, err := (*ws.DatabaseManager).CreateMessage(&username, receiver, message, listingID)
 
 		if err != nil {
-			return err
+			return "", err
 		}
 
-		return nil
+		return id, nil
 
 	}
 
-	return fmt.Errorf("user is not logged in")
+	return "", fmt.Errorf("user is not logged in")
+}
+
+// checkListingThread refuses messages about listings that are hidden or
+// that neither user sells
+func (ws WSDBProxy) checkListingThread(username, receiver string, listingID *int64) error {
+	listing, err := (*ws.DatabaseManager).GetListing(listingID)
+
+	if err != nil {
+		return err
+	}
+
+	if listing.Hidden || (listing.Owner != username && listing.Owner != receiver) {
+		return fmt.Errorf("listing not found: neither user sells that listing")
+	}
+
+	return nil
 }
 
 func (ws WSDBProxy) UploadListing(socketID string, listing *db.Listing) error {
@@ -119,16 +352,28 @@ func (ws WSDBProxy) UploadListing(socketID string, listing *db.Listing) error {
 
 	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
 
-		username := ws.IdToUsername[socketID]
+		username := ws.usernameOf(socketID)
+
+		if err := ws.requireVerified(username); err != nil {
+			return err
+		}
+
+		if err := ws.checkListingImages(username, listing.Images); err != nil {
+			return err
+		}
 
-		// TODO: Add Validation to listing before it is unloaded
+		if err := ws.cleanListing(listing); err != nil {
+			return err
+		}
 
-		_, err := (*ws.DatabaseManager).UploadListing(&username, listing)
+		id, err := (*ws.DatabaseManager).UploadListing(&username, listing)
 
 		if err != nil {
 			return err
 		}
 
+		listing.Id = id
+
 		return nil
 
 	}
@@ -136,6 +381,109 @@ func (ws WSDBProxy) UploadListing(socketID string, listing *db.Listing) error {
 	return fmt.Errorf("user is not logged in")
 }
 
+// cleanListing cleans the title and description of the listing in place
+func (ws WSDBProxy) cleanListing(listing *db.Listing) error {
+
+	if ws.Content == nil {
+		return nil
+	}
+
+	title, err := ws.Content.ListingTitle.Clean(listing.Title)
+
+	if err != nil {
+		return err
+	}
+
+	description, err := ws.Content.ListingDescription.Clean(listing.Decription)
+
+	if err != nil {
+		return err
+	}
+
+	listing.Title = title.Text
+	listing.Decription = description.Text
+
+	return nil
+}
+
+// MaxMessageSize is the largest text message a socket can send, with room for
+// the longest message or listing the content rules allow
+func (ws WSDBProxy) MaxMessageSize() int64 {
+	rules := ws.Content
+
+	if rules == nil {
+		rules = content.DefaultRules()
+	}
+
+	defaults := content.DefaultRules()
+
+	// text without a limit is still read up to the default limit
+	lengthOf := func(policy, fallback content.Policy) int64 {
+		if policy.MaxLength > 0 {
+			return int64(policy.MaxLength)
+		}
+
+		return int64(fallback.MaxLength)
+	}
+
+	text := lengthOf(rules.Message, defaults.Message)
+	listing := lengthOf(rules.ListingTitle, defaults.ListingTitle) + lengthOf(rules.ListingDescription, defaults.ListingDescription)
+
+	if listing > text {
+		text = listing
+	}
+
+	// an image is a storage key, or a link when there is no storage
+	images := int64(maxListingImages * maxAvatarURLLength)
+
+	return text*maxBytesPerChar + images + maxEnvelopeSize
+}
+
+// GetListing returns the listing with the URLs of its images, logged out
+// sockets can see listings. Listings of users that blocked the socket, or
+// that it blocked, and listings hidden by moderators are not found.
+func (ws WSDBProxy) GetListing(socketID string, listingID *int64) (db.Listing, error) {
+
+	if ws.DatabaseManager == nil {
+		return db.Listing{}, fmt.Errorf("DatabaseManager has not been intialised")
+	}
+
+	listing, err := (*ws.DatabaseManager).GetListing(listingID)
+
+	if err != nil {
+		return db.Listing{}, err
+	}
+
+	if listing.Owner == "" {
+		return db.Listing{}, fmt.Errorf("listing not found: no listing with that id")
+	}
+
+	if ws.IsLoggedIn(socketID) {
+		if err = ws.checkBlocked(ws.usernameOf(socketID), listing.Owner); err != nil {
+			return db.Listing{}, fmt.Errorf("listing not found: no listing with that id")
+		}
+	}
+
+	// only moderators still see listings they hid
+	if listing.Hidden {
+		if _, err = ws.requireModerator(socketID); err != nil {
+			return db.Listing{}, fmt.Errorf("listing not found: no listing with that id")
+		}
+	}
+
+	for i, image := range listing.Images {
+		listing.Images[i] = ws.mediaURL(image)
+	}
+
+	for _, variants := range listing.ImageVariants {
+		for name, key := range variants {
+			variants[name] = ws.mediaURL(key)
+		}
+	}
+
+	return listing, nil
+}
+
 func (ws WSDBProxy) BuyListing(socketID string, listingID *int64, amount *int64) error {
 
 	if ws.DatabaseManager == nil {
@@ -144,11 +492,31 @@ func (ws WSDBProxy) BuyListing(socketID string, listingID *int64, amount *int64)
 
 	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
 
-		username := ws.IdToUsername[socketID]
+		username := ws.usernameOf(socketID)
+
+		if err := ws.requireVerified(username); err != nil {
+			return err
+		}
+
+		listing, err := (*ws.DatabaseManager).GetListing(listingID)
+
+		if err != nil {
+			return err
+		}
+
+		if listing.Hidden {
+			return fmt.Errorf("listing not found: no listing with that id")
+		}
+
+		if listing.Owner != "" {
+			if err = ws.checkBlocked(username, listing.Owner); err != nil {
+				return err
+			}
+		}
 
 		// TODO: Add Validation to check amount makes sense
 
-		err := (*ws.DatabaseManager).BuyListing(&username, listingID, amount)
+		err = (*ws.DatabaseManager).BuyListing(&username, listingID, amount)
 
 		if err != nil {
 			return err
@@ -167,7 +535,11 @@ func (ws WSDBProxy) CreateProfile(username, email, password *string) error {
 		return fmt.Errorf("DatabaseManager has not been intialised")
 	}
 
-	// TODO: Add Validation to check amount makes sense
+	if ws.PasswordPolicy != nil {
+		if err := ws.PasswordPolicy.Check(*password, *username, *email); err != nil {
+			return err
+		}
+	}
 
 	err := (*ws.DatabaseManager).CreateProfile(username, email, password)
 
@@ -175,6 +547,11 @@ func (ws WSDBProxy) CreateProfile(username, email, password *string) error {
 		return err
 	}
 
+	// The account exists either way, the user can ask for another email
+	if err = ws.sendVerification(*email); err != nil {
+		log.Printf("error: could not send verification email: %v", err)
+	}
+
 	return nil
 }
 
@@ -186,7 +563,7 @@ func (ws WSDBProxy) GetContacts(socketID string) ([]db.Contact, error) {
 
 	if isLoggedIn := ws.IsLoggedIn(socketID); isLoggedIn {
 
-		username := ws.IdToUsername[socketID]
+		username := ws.usernameOf(socketID)
 
 		contacts, err := (*ws.DatabaseManager).GetContacts(&username)
 
@@ -194,6 +571,10 @@ func (ws WSDBProxy) GetContacts(socketID string) ([]db.Contact, error) {
 			return nil, err
 		}
 
+		for i := range contacts {
+			contacts[i].AvatarURL = ws.mediaURL(contacts[i].AvatarURL)
+		}
+
 		return contacts, nil
 
 	}